@@ -7,13 +7,20 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"regexp"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/kube-sentinel/kube-sentinel/internal/config"
+	"github.com/kube-sentinel/kube-sentinel/internal/elasticsearch"
+	"github.com/kube-sentinel/kube-sentinel/internal/kubewatch"
 	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	"github.com/kube-sentinel/kube-sentinel/internal/otlp"
+	"github.com/kube-sentinel/kube-sentinel/internal/pipeline"
 	"github.com/kube-sentinel/kube-sentinel/internal/remediation"
 	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+	"github.com/kube-sentinel/kube-sentinel/internal/source"
 	"github.com/kube-sentinel/kube-sentinel/internal/store"
 	"github.com/kube-sentinel/kube-sentinel/internal/web"
 	"k8s.io/client-go/kubernetes"
@@ -28,6 +35,11 @@ var (
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
+
 	// Parse flags
 	configPath := flag.String("config", "", "Path to config file")
 	rulesPath := flag.String("rules", "", "Path to rules file (overrides config)")
@@ -99,12 +111,20 @@ func main() {
 	// Initialize store
 	dataStore := store.NewMemoryStore()
 
+	// Rule expressions see how often an error was stored
+	ruleEngine.SetOccurrenceCounter(func(fingerprint string) int {
+		if stored, err := dataStore.GetErrorByFingerprint(fingerprint); err == nil {
+			return stored.Count
+		}
+		return 0
+	})
+
 	// Initialize Kubernetes client (optional)
 	var k8sClient kubernetes.Interface
-	if cfg.Remediation.Enabled {
+	if cfg.Remediation.Enabled || cfg.Kubernetes.WatchEvents || cfg.Kubernetes.WatchPods {
 		k8sClient, err = createK8sClient(cfg.Kubernetes)
 		if err != nil {
-			logger.Warn("failed to create kubernetes client, remediation will be disabled", "error", err)
+			logger.Warn("failed to create kubernetes client, remediation and kubernetes watchers will be disabled", "error", err)
 		}
 	}
 
@@ -114,6 +134,7 @@ func main() {
 		DryRun:             cfg.Remediation.DryRun,
 		MaxActionsPerHour:  cfg.Remediation.MaxActionsPerHour,
 		ExcludedNamespaces: cfg.Remediation.ExcludedNamespaces,
+		Tenants:            tenantPolicies(cfg.Remediation.Tenants),
 	}, logger)
 
 	// Initialize web server
@@ -137,96 +158,225 @@ func main() {
 		cancel()
 	}()
 
-	// Initialize Loki client
-	lokiOpts := []loki.ClientOption{}
-	if cfg.Loki.TenantID != "" {
-		lokiOpts = append(lokiOpts, loki.WithTenantID(cfg.Loki.TenantID))
-	}
-	if cfg.Loki.Username != "" && cfg.Loki.Password != "" {
-		lokiOpts = append(lokiOpts, loki.WithBasicAuth(cfg.Loki.Username, cfg.Loki.Password))
+	// Processing pipeline - sources submit errors to bounded queues in front
+	// of the match/store, remediation and notification workers, so a slow
+	// Kubernetes API doesn't stall log ingestion
+	proc := pipeline.New(ruleEngine, remEngine, dataStore, webServer, pipeline.Config{
+		Match:     pipelineStage(cfg.Pipeline.Match),
+		Remediate: pipelineStage(cfg.Pipeline.Remediate),
+		Notify:    pipelineStage(cfg.Pipeline.Notify),
+	}, logger)
+	webServer.SetPipeline(proc)
+	errorHandler := proc.Submit
+
+	// Checkpoint stores are shared per file so sources writing the same
+	// file don't race each other
+	checkpointStores := make(map[string]loki.CheckpointStore)
+	checkpointStore := func(path string) loki.CheckpointStore {
+		if _, ok := checkpointStores[path]; !ok {
+			checkpointStores[path] = loki.NewFileCheckpointStore(path)
+		}
+		return checkpointStores[path]
 	}
 
-	lokiClient := loki.NewClient(cfg.Loki.URL, lokiOpts...)
+	fingerprint := fingerprintConfig(cfg.Fingerprint)
+	if fingerprint.Templates != nil {
+		webServer.SetTemplates(fingerprint.Templates)
+	}
 
-	// Error handler - processes errors from Loki
-	errorHandler := func(errors []loki.ParsedError) {
-		for _, e := range errors {
-			// Match against rules
-			matched := ruleEngine.Match(e)
-			if matched == nil {
-				continue
-			}
+	var sources []source.LogSource
 
-			// Store the error
-			storeErr := &store.Error{
-				ID:          matched.ID,
-				Fingerprint: matched.Fingerprint,
-				Timestamp:   matched.Timestamp,
-				Namespace:   matched.Namespace,
-				Pod:         matched.Pod,
-				Container:   matched.Container,
-				Message:     matched.Message,
-				Priority:    matched.Priority,
-				Count:       matched.Count,
-				FirstSeen:   matched.FirstSeen,
-				LastSeen:    matched.LastSeen,
-				RuleMatched: matched.RuleName,
-				Labels:      matched.Labels,
-			}
+	// Create a poller or tailer for each named Loki query source
+	if cfg.Loki.Enabled {
+		lokiOpts, err := lokiClientOptions(cfg.Loki)
+		if err != nil {
+			logger.Error("failed to configure loki client", "error", err)
+			os.Exit(1)
+		}
 
-			if err := dataStore.SaveError(storeErr); err != nil {
-				logger.Error("failed to save error", "error", err)
-				continue
-			}
+		// All sources query the same Loki, so they share a circuit breaker
+		if cb := cfg.Loki.CircuitBreaker; cb.Enabled {
+			breaker := loki.NewCircuitBreaker(cb.FailureThreshold, cb.OpenTimeout)
+			lokiOpts = append(lokiOpts, loki.WithCircuitBreaker(breaker))
+			webServer.SetLokiBreaker(breaker)
+		}
 
-			// Broadcast to WebSocket clients
-			webServer.BroadcastError(storeErr)
+		// Each source gets its own client per tenant it fans out to
+		newClient := func(tenantID string) *loki.Client {
+			opts := append([]loki.ClientOption{loki.WithTenantID(tenantID)}, lokiOpts...)
+			return loki.NewClient(cfg.Loki.URL, opts...)
+		}
 
-			// Execute remediation
-			if remEngine.IsEnabled() {
-				log, err := remEngine.ProcessError(ctx, matched, ruleEngine)
-				if err != nil {
-					logger.Error("remediation failed", "error", err)
+		for _, q := range cfg.Loki.QuerySources() {
+			tenants := q.ClientTenants()
+			for _, tenant := range tenants {
+				lokiClient := newClient(tenant)
+
+				pollerOpts := []loki.PollerOption{
+					loki.WithSource(q.Name),
+					loki.WithLogger(logger),
+					loki.WithPageSize(cfg.Loki.PageSize),
+					loki.WithMaxPages(cfg.Loki.MaxPages),
+					loki.WithMaxCatchUp(cfg.Loki.MaxCatchUp),
+					loki.WithFieldMapping(fieldMapping(q.LogFields)),
+					multiline(cfg.Loki.Multiline),
+					lineFilter(q.LineFilter),
+					loki.WithFingerprint(fingerprint),
 				}
-				if log != nil {
-					webServer.BroadcastRemediation(log)
-
-					// Mark error as remediated if action succeeded
-					if log.Status == "success" {
-						storeErr.Remediated = true
-						now := time.Now()
-						storeErr.RemediatedAt = &now
-						dataStore.UpdateError(storeErr)
+				if cfg.Loki.CheckpointFile != "" {
+					// Fanned-out pollers keep a watermark per tenant
+					key := q.Name
+					if len(tenants) > 1 {
+						key = q.Name + "/" + tenant
 					}
+					pollerOpts = append(pollerOpts, loki.WithCheckpoint(checkpointStore(cfg.Loki.CheckpointFile), key))
+				}
+
+				if q.Mode == "tail" {
+					sources = append(sources, loki.NewTailer(lokiClient, q.Query, q.Lookback, errorHandler, pollerOpts...))
+				} else {
+					sources = append(sources, loki.NewPoller(lokiClient, q.Query, q.PollInterval, q.Lookback, errorHandler, pollerOpts...))
 				}
 			}
 		}
 
-		// Broadcast updated stats
-		webServer.BroadcastStats()
+		// Evaluate metric queries against their thresholds
+		for _, q := range cfg.Loki.MetricQuerySources() {
+			threshold := loki.Threshold{Op: q.Threshold.Op, Value: q.Threshold.Value}
+			for _, tenant := range q.ClientTenants() {
+				sources = append(sources, loki.NewMetricPoller(newClient(tenant), q.Query, q.Interval, threshold, errorHandler,
+					loki.WithMetricSource(q.Name),
+					loki.WithMetricLogger(logger),
+					loki.WithMetricMessage(q.Message),
+					loki.WithMetricFingerprint(fingerprint),
+				))
+			}
+		}
 	}
 
-	// Create poller
-	poller := loki.NewPoller(
-		lokiClient,
-		cfg.Loki.Query,
-		cfg.Loki.PollInterval,
-		cfg.Loki.Lookback,
-		errorHandler,
-		loki.WithLogger(logger),
-	)
+	// Accept logs pushed by Promtail/Alloy
+	if push := cfg.Loki.Push; push.Enabled {
+		receiver := loki.NewPushReceiver(errorHandler,
+			[]loki.PollerOption{
+				loki.WithSource(push.Name),
+				loki.WithLogger(logger),
+				loki.WithFieldMapping(fieldMapping(push.LogFields.Inherit(cfg.Loki.LogFields))),
+				multiline(cfg.Loki.Multiline),
+				lineFilter(push.LineFilter),
+				loki.WithFingerprint(fingerprint),
+			},
+			loki.WithMaxBodySize(push.MaxBodySize),
+			loki.WithPushAuth(loki.NewReceiverAuth(push.BearerToken, push.BearerTokenFile)),
+			loki.WithAllowedTenants(push.AllowedTenants...),
+		)
+		if push.BearerToken == "" && push.BearerTokenFile == "" {
+			logger.Warn("loki push receiver accepts unauthenticated requests, set loki.push.bearer_token_file to require a token")
+		}
+		webServer.HandleReceiver("/loki/api/v1/push", receiver)
+		sources = append(sources, receiver)
+	}
+
+	// Accept OTLP/HTTP logs
+	if cfg.OTLP.Enabled {
+		minSeverity, _ := otlp.ParseSeverity(cfg.OTLP.MinSeverity)
+		receiver := otlp.NewReceiver(errorHandler,
+			otlp.WithSource(cfg.OTLP.Name),
+			otlp.WithLogger(logger),
+			otlp.WithMinSeverity(minSeverity),
+			otlp.WithMaxBodySize(cfg.OTLP.MaxBodySize),
+			otlp.WithFieldMapping(fieldMapping(cfg.OTLP.LogFields)),
+			otlp.WithFingerprint(fingerprint),
+			otlp.WithAuth(loki.NewReceiverAuth(cfg.OTLP.BearerToken, cfg.OTLP.BearerTokenFile)),
+		)
+		if cfg.OTLP.BearerToken == "" && cfg.OTLP.BearerTokenFile == "" {
+			logger.Warn("otlp receiver accepts unauthenticated requests, set otlp.bearer_token_file to require a token")
+		}
+		webServer.HandleReceiver("/v1/logs", receiver)
+		sources = append(sources, receiver)
+	}
+
+	// Create the Elasticsearch/OpenSearch poller
+	if es := cfg.Elasticsearch; es.Enabled {
+		esOpts := []elasticsearch.ClientOption{}
+		if es.APIKey != "" {
+			esOpts = append(esOpts, elasticsearch.WithAPIKey(es.APIKey))
+		} else if es.Username != "" && es.Password != "" {
+			esOpts = append(esOpts, elasticsearch.WithBasicAuth(es.Username, es.Password))
+		}
+		esClient := elasticsearch.NewClient(es.URL, esOpts...)
+
+		pollerOpts := []elasticsearch.PollerOption{
+			elasticsearch.WithSource(es.Name),
+			elasticsearch.WithLogger(logger),
+			elasticsearch.WithPageSize(es.PageSize),
+			elasticsearch.WithMaxPages(es.MaxPages),
+			elasticsearch.WithMaxCatchUp(es.MaxCatchUp),
+			elasticsearch.WithFieldMapping(elasticsearch.FieldMapping{
+				Timestamp: es.Fields.Timestamp,
+				Message:   es.Fields.Message,
+				Namespace: es.Fields.Namespace,
+				Pod:       es.Fields.Pod,
+				Container: es.Fields.Container,
+				Labels:    es.Fields.Labels,
+			}),
+			elasticsearch.WithLogFields(fieldMapping(es.LogFields)),
+			elasticsearch.WithFingerprint(fingerprint),
+		}
+		if es.CheckpointFile != "" {
+			pollerOpts = append(pollerOpts, elasticsearch.WithCheckpoint(checkpointStore(es.CheckpointFile), es.Name))
+		}
+
+		sources = append(sources, elasticsearch.NewPoller(esClient, es.Index, es.Query, es.PollInterval, es.Lookback, errorHandler, pollerOpts...))
+	}
+
+	// Watch Kubernetes Warning events
+	if cfg.Kubernetes.WatchEvents && k8sClient != nil {
+		sources = append(sources, kubewatch.NewEventWatcher(k8sClient, errorHandler,
+			kubewatch.WithEventNamespace(cfg.Kubernetes.EventsNamespace),
+			kubewatch.WithEventLookback(cfg.Kubernetes.EventsLookback),
+			kubewatch.WithEventLogger(logger),
+			kubewatch.WithEventFingerprint(fingerprint),
+		))
+	}
+
+	// Watch pod container statuses
+	if cfg.Kubernetes.WatchPods && k8sClient != nil {
+		sources = append(sources, kubewatch.NewPodWatcher(k8sClient, errorHandler,
+			kubewatch.WithPodNamespace(cfg.Kubernetes.PodsNamespace),
+			kubewatch.WithPodLookback(cfg.Kubernetes.PodsLookback),
+			kubewatch.WithPodLogger(logger),
+			kubewatch.WithPodFingerprint(fingerprint),
+		))
+	}
 
 	// Start components
-	errCh := make(chan error, 2)
+	errCh := make(chan error, len(sources)+2)
 
-	// Start poller
+	// Start the pipeline before the sources that feed it. It has its own
+	// context so it can drain what the sources queued after they stopped.
+	pipelineCtx, stopPipeline := context.WithCancel(context.Background())
+	defer stopPipeline()
+	pipelineDone := make(chan struct{})
 	go func() {
-		logger.Info("starting loki poller")
-		if err := poller.Start(ctx); err != nil && err != context.Canceled {
-			errCh <- fmt.Errorf("poller error: %w", err)
+		defer close(pipelineDone)
+		if err := proc.Run(pipelineCtx); err != nil && err != context.Canceled {
+			errCh <- fmt.Errorf("pipeline error: %w", err)
 		}
 	}()
 
+	// Start log sources
+	var sourcesWg sync.WaitGroup
+	for _, src := range sources {
+		sourcesWg.Add(1)
+		go func(src source.LogSource) {
+			defer sourcesWg.Done()
+			logger.Info("starting log source", "source", src.Name())
+			if err := src.Start(ctx); err != nil && err != context.Canceled {
+				errCh <- fmt.Errorf("source %s error: %w", src.Name(), err)
+			}
+		}(src)
+	}
+
 	// Start web server
 	go func() {
 		logger.Info("starting web server", "addr", cfg.Web.Listen)
@@ -275,10 +425,31 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
+	// Stop accepting pushed logs, wait for the sources to stop, which
+	// saves their checkpoints, then let the pipeline process everything
+	// they submitted before the store is closed
 	if err := webServer.Shutdown(shutdownCtx); err != nil {
 		logger.Error("web server shutdown error", "error", err)
 	}
 
+	sourcesDone := make(chan struct{})
+	go func() {
+		sourcesWg.Wait()
+		close(sourcesDone)
+	}()
+	select {
+	case <-sourcesDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("timed out waiting for log sources to stop")
+	}
+
+	stopPipeline()
+	select {
+	case <-pipelineDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("timed out draining the pipeline")
+	}
+
 	if err := dataStore.Close(); err != nil {
 		logger.Error("store close error", "error", err)
 	}
@@ -286,6 +457,115 @@ func main() {
 	logger.Info("shutdown complete")
 }
 
+func pipelineStage(cfg config.PipelineStageConfig) pipeline.StageConfig {
+	return pipeline.StageConfig{
+		QueueSize: cfg.QueueSize,
+		Workers:   cfg.Workers,
+		Overflow:  pipeline.OverflowPolicy(cfg.Overflow),
+	}
+}
+
+// tenantPolicies converts per-tenant remediation settings
+func tenantPolicies(tenants map[string]config.RemediationTenantConfig) map[string]remediation.TenantPolicy {
+	policies := make(map[string]remediation.TenantPolicy, len(tenants))
+	for tenant, t := range tenants {
+		policies[tenant] = remediation.TenantPolicy{
+			Disabled:           t.Enabled != nil && !*t.Enabled,
+			DryRun:             t.DryRun,
+			ExcludedNamespaces: t.ExcludedNamespaces,
+		}
+	}
+	return policies
+}
+
+// lokiClientOptions returns the client options shared by every Loki source
+func lokiClientOptions(cfg config.LokiConfig) ([]loki.ClientOption, error) {
+	opts := []loki.ClientOption{
+		loki.WithTimeout(cfg.Timeout),
+		loki.WithRetry(cfg.Retry.MaxRetries, cfg.Retry.MinBackoff, cfg.Retry.MaxBackoff),
+	}
+
+	if cfg.Username != "" && cfg.Password != "" {
+		opts = append(opts, loki.WithBasicAuth(cfg.Username, cfg.Password))
+	}
+	if cfg.BearerToken != "" {
+		opts = append(opts, loki.WithBearerToken(cfg.BearerToken))
+	}
+	if cfg.BearerTokenFile != "" {
+		opts = append(opts, loki.WithBearerTokenFile(cfg.BearerTokenFile))
+	}
+
+	if t := cfg.TLS; t != (config.TLSConfig{}) {
+		tlsConfig, err := loki.NewTLSConfig(loki.TLSConfig{
+			CAFile:             t.CAFile,
+			CertFile:           t.CertFile,
+			KeyFile:            t.KeyFile,
+			ServerName:         t.ServerName,
+			InsecureSkipVerify: t.InsecureSkipVerify,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, loki.WithTLSConfig(tlsConfig))
+	}
+
+	return opts, nil
+}
+
+func fieldMapping(cfg config.LogFieldsConfig) loki.FieldMapping {
+	return loki.FieldMapping{
+		Level:   cfg.Level,
+		Message: cfg.Message,
+		Error:   cfg.Error,
+		Caller:  cfg.Caller,
+		TraceID: cfg.TraceID,
+		SpanID:  cfg.SpanID,
+	}.WithDefaults()
+}
+
+// lineFilter compiles a validated line_filter; empty processes every line
+func lineFilter(expr string) loki.PollerOption {
+	if expr == "" {
+		return loki.WithLineFilter(nil)
+	}
+	return loki.WithLineFilter(regexp.MustCompile(expr))
+}
+
+func multiline(cfg config.MultilineConfig) loki.PollerOption {
+	if !cfg.Enabled {
+		return loki.WithMultiline(0, 0)
+	}
+	return loki.WithMultiline(cfg.MaxGap, cfg.MaxLines)
+}
+
+func fingerprintConfig(cfg config.FingerprintConfig) loki.FingerprintConfig {
+	fp := loki.FingerprintConfig{
+		StackFrames:    cfg.StackFrames,
+		ExcludeFrames:  cfg.ExcludeFrames,
+		NoDefaultMasks: !cfg.DefaultMasks,
+		KeepPodNames:   !cfg.NormalizePodNames,
+	}
+	for _, m := range cfg.Masks {
+		fp.Masks = append(fp.Masks, loki.Mask{
+			Pattern:     regexp.MustCompile(m.Pattern),
+			Replacement: m.Replacement,
+		})
+	}
+	for _, p := range cfg.PodPatterns {
+		fp.PodPatterns = append(fp.PodPatterns, regexp.MustCompile(p))
+	}
+	if t := cfg.Templates; t.Enabled {
+		fp.Templates = loki.NewTemplateMiner(loki.TemplateMinerConfig{
+			Similarity:   t.Similarity,
+			Depth:        t.Depth,
+			MaxChildren:  t.MaxChildren,
+			MaxTemplates: t.MaxTemplates,
+			ParamSamples: t.ParamSamples,
+		})
+	}
+	return fp
+}
+
 func createK8sClient(cfg config.KubernetesConfig) (kubernetes.Interface, error) {
 	var restConfig *rest.Config
 	var err error
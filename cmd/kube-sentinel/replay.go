@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/config"
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	"github.com/kube-sentinel/kube-sentinel/internal/remediation"
+	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+)
+
+// replayReport summarizes what the rules would have matched and remediated
+type replayReport struct {
+	Entries    int            `json:"entries"`
+	Errors     int            `json:"errors"` // parsed errors, including repeats
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Rules      []*ruleReport  `json:"rules"`
+	Priorities map[string]int `json:"priorities"` // occurrences per priority
+	Actions    []*actionEntry `json:"actions"`
+}
+
+// ruleReport counts the matches of a single rule
+type ruleReport struct {
+	Name         string `json:"name"`
+	Priority     string `json:"priority"`
+	Occurrences  int    `json:"occurrences"`
+	Fingerprints int    `json:"fingerprints"` // distinct errors after grouping
+
+	fingerprints map[string]bool
+}
+
+// actionEntry counts the would-be remediations of a rule against a target
+type actionEntry struct {
+	Rule     string         `json:"rule"`
+	Action   string         `json:"action"`
+	Target   string         `json:"target"`
+	Executed int            `json:"executed"`
+	Skipped  map[string]int `json:"skipped,omitempty"` // by reason
+	Failed   map[string]int `json:"failed,omitempty"`  // by reason
+}
+
+// runReplay implements "kube-sentinel replay": it runs a log export through
+// parsing, fingerprinting, the rule engine and a dry-run remediation engine
+// and prints what would have happened
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kube-sentinel replay [flags] <file>...\n\n"+
+			"Replays a Loki query_range JSON export or a newline-delimited log file\n"+
+			"(\"-\" for stdin) against the rules and reports matches per rule,\n"+
+			"priorities and would-be remediation actions per target.\n\n")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "Path to config file")
+	rulesPath := fs.String("rules", "", "Path to rules file (overrides config)")
+	format := fs.String("format", loki.ExportAuto, "Input format (auto, loki or lines)")
+	labelSet := fs.String("labels", "", `Labels for plain log lines, e.g. {namespace="shop", pod="checkout-7d4f8b9c5d-abc12"}`)
+	sourceName := fs.String("source", "replay", "Source name errors are tagged with")
+	jsonOutput := fs.Bool("json", false, "Print the report as JSON")
+	logLevel := fs.String("log-level", "warn", "Log level (debug, info, warn, error)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		level = slog.LevelWarn
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	cfg, err := config.LoadOrDefault(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	if *rulesPath != "" {
+		cfg.RulesFile = *rulesPath
+	}
+
+	// Unlike the agent, a replay must not silently fall back to the
+	// default rules
+	rulesList := rules.DefaultRules()
+	if cfg.RulesFile != "" {
+		rulesList, err = rules.NewLoader(cfg.RulesFile).Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load rules: %v\n", err)
+			return 1
+		}
+	}
+
+	ruleEngine, err := rules.NewEngine(rulesList, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create rule engine: %v\n", err)
+		return 1
+	}
+
+	var labels map[string]string
+	if *labelSet != "" {
+		labels, err = loki.ParseLabels(*labelSet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -labels: %v\n", err)
+			return 2
+		}
+	}
+
+	var entries []loki.LogEntry
+	for _, path := range fs.Args() {
+		fileEntries, err := readExport(path, *format, labels)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	report := replay(entries, cfg, ruleEngine, *sourceName, logger)
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write report: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	printReport(os.Stdout, report)
+	return 0
+}
+
+func readExport(path, format string, labels map[string]string) ([]loki.LogEntry, error) {
+	if path == "-" {
+		return loki.ReadExport(os.Stdin, format, labels, time.Now())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Plain lines without timestamps are placed at the file's mtime
+	start := time.Now()
+	if info, err := f.Stat(); err == nil {
+		start = info.ModTime()
+	}
+	return loki.ReadExport(f, format, labels, start)
+}
+
+// replay runs entries through the same stages as the agent. Remediation is
+// always a dry run and its cooldowns and hourly limit follow the time of
+// the replayed errors.
+func replay(entries []loki.LogEntry, cfg *config.Config, ruleEngine *rules.Engine, source string, logger *slog.Logger) *replayReport {
+	report := &replayReport{
+		Entries:    len(entries),
+		Priorities: make(map[string]int),
+	}
+
+	var clock time.Time
+	remEngine := remediation.NewEngine(nil, nil, remediation.EngineConfig{
+		Enabled:            true,
+		DryRun:             true,
+		MaxActionsPerHour:  cfg.Remediation.MaxActionsPerHour,
+		ExcludedNamespaces: cfg.Remediation.ExcludedNamespaces,
+		Tenants:            tenantPolicies(cfg.Remediation.Tenants),
+		Now:                func() time.Time { return clock },
+	}, logger)
+
+	// Dry runs validate params but never call the API, so the built-in
+	// actions need no client
+	remEngine.RegisterAction(remediation.NewRestartPodAction(nil))
+	remEngine.RegisterAction(remediation.NewScaleUpAction(nil))
+	remEngine.RegisterAction(remediation.NewScaleDownAction(nil))
+	remEngine.RegisterAction(remediation.NewRollbackAction(nil))
+	remEngine.RegisterAction(remediation.NewDeleteStuckPodsAction(nil))
+
+	ruleReports := make(map[string]*ruleReport)
+	actions := make(map[string]*actionEntry)
+
+	// Stands in for the store behind the count variable of expressions
+	occurrences := make(map[string]int)
+	ruleEngine.SetOccurrenceCounter(func(fingerprint string) int {
+		return occurrences[fingerprint]
+	})
+
+	handler := func(errors []loki.ParsedError) {
+		for _, e := range errors {
+			report.Errors++
+			if report.From.IsZero() || e.Timestamp.Before(report.From) {
+				report.From = e.Timestamp
+			}
+			if e.Timestamp.After(report.To) {
+				report.To = e.Timestamp
+			}
+
+			matched := ruleEngine.Match(e)
+			if matched == nil {
+				continue
+			}
+			occurrences[e.Fingerprint]++
+
+			// Continuing rules are reported along with the rule that
+			// decided the priority
+			names := matched.Rules
+			if len(names) == 0 {
+				names = []string{matched.RuleName}
+			}
+			for _, name := range names {
+				rr, ok := ruleReports[name]
+				if !ok {
+					priority := matched.Priority
+					if rule := ruleEngine.GetRuleByName(name); rule != nil {
+						priority = rule.Priority
+					}
+					rr = &ruleReport{
+						Name:         name,
+						Priority:     string(priority),
+						fingerprints: make(map[string]bool),
+					}
+					ruleReports[name] = rr
+				}
+				rr.Occurrences++
+				rr.fingerprints[matched.Fingerprint] = true
+			}
+			report.Priorities[string(matched.Priority)]++
+
+			// Like the pipeline, repeats within the dedup window are only
+			// counted, not remediated, unless they reached a threshold
+			if e.Repeat && !matched.ThresholdReached {
+				continue
+			}
+
+			clock = e.Timestamp
+			logs, _ := remEngine.ProcessError(context.Background(), matched, ruleEngine)
+			for _, log := range logs {
+				key := log.Rule + "|" + log.Action + "|" + log.Target
+				ae, ok := actions[key]
+				if !ok {
+					ae = &actionEntry{Rule: log.Rule, Action: log.Action, Target: log.Target}
+					actions[key] = ae
+				}
+				switch log.Status {
+				case "success":
+					ae.Executed++
+				case "failed":
+					if ae.Failed == nil {
+						ae.Failed = make(map[string]int)
+					}
+					ae.Failed[log.Message]++
+				default:
+					if ae.Skipped == nil {
+						ae.Skipped = make(map[string]int)
+					}
+					ae.Skipped[skipReason(log.Message)]++
+				}
+			}
+		}
+	}
+
+	replayer := loki.NewReplayer(handler,
+		loki.WithSource(source),
+		loki.WithLogger(logger),
+		loki.WithFieldMapping(fieldMapping(cfg.Loki.LogFields)),
+		multiline(cfg.Loki.Multiline),
+		loki.WithFingerprint(fingerprintConfig(cfg.Fingerprint)),
+	)
+	replayer.Replay(entries)
+
+	// Rules in evaluation order, then the default catch-all
+	for _, rule := range ruleEngine.GetRules() {
+		if rr, ok := ruleReports[rule.Name]; ok {
+			report.Rules = append(report.Rules, rr)
+			delete(ruleReports, rule.Name)
+		}
+	}
+	for _, rr := range ruleReports {
+		report.Rules = append(report.Rules, rr)
+	}
+	for _, rr := range report.Rules {
+		rr.Fingerprints = len(rr.fingerprints)
+	}
+
+	for _, ae := range actions {
+		report.Actions = append(report.Actions, ae)
+	}
+	sort.Slice(report.Actions, func(i, j int) bool {
+		a, b := report.Actions[i], report.Actions[j]
+		if a.Executed != b.Executed {
+			return a.Executed > b.Executed
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Target < b.Target
+	})
+
+	return report
+}
+
+// skipReason drops the variable part of a skip message so skips group
+func skipReason(message string) string {
+	switch {
+	case strings.HasPrefix(message, "cooldown active"):
+		return "cooldown active"
+	case strings.HasPrefix(message, "hourly limit reached"):
+		return "hourly limit reached"
+	case strings.HasPrefix(message, "namespace ") && strings.HasSuffix(message, " is excluded"):
+		return "namespace excluded"
+	}
+	return message
+}
+
+func printReport(w io.Writer, r *replayReport) {
+	fmt.Fprintf(w, "Replayed %d log entries, %d errors", r.Entries, r.Errors)
+	if !r.From.IsZero() {
+		fmt.Fprintf(w, " from %s to %s", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "\nMatches per rule:")
+	fmt.Fprintln(tw, "  RULE\tPRIORITY\tOCCURRENCES\tERRORS")
+	for _, rr := range r.Rules {
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%d\n", rr.Name, rr.Priority, rr.Occurrences, rr.Fingerprints)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nOccurrences per priority:")
+	for _, p := range []rules.Priority{rules.PriorityCritical, rules.PriorityHigh, rules.PriorityMedium, rules.PriorityLow} {
+		fmt.Fprintf(tw, "  %s\t%s\t%d\n", p, p.Label(), r.Priorities[string(p)])
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nWould-be remediations:")
+	if len(r.Actions) == 0 {
+		fmt.Fprintln(w, "  none")
+		return
+	}
+	fmt.Fprintln(tw, "  RULE\tACTION\tTARGET\tEXECUTED\tSKIPPED\tFAILED")
+	for _, ae := range r.Actions {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%d\t%s\t%s\n", ae.Rule, ae.Action, ae.Target, ae.Executed, reasons(ae.Skipped), reasons(ae.Failed))
+	}
+	tw.Flush()
+}
+
+// reasons formats reason counts as "reason: n, ..."
+func reasons(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s: %d", k, counts[k])
+	}
+	return strings.Join(parts, ", ")
+}
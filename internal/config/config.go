@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -10,29 +12,279 @@ import (
 
 // Config represents the main application configuration
 type Config struct {
-	Loki        LokiConfig        `yaml:"loki"`
-	Kubernetes  KubernetesConfig  `yaml:"kubernetes"`
-	Web         WebConfig         `yaml:"web"`
-	Remediation RemediationConfig `yaml:"remediation"`
-	RulesFile   string            `yaml:"rules_file"`
-	Store       StoreConfig       `yaml:"store"`
+	Loki          LokiConfig          `yaml:"loki"`
+	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch"`
+	OTLP          OTLPConfig          `yaml:"otlp"`
+	Kubernetes    KubernetesConfig    `yaml:"kubernetes"`
+	Web           WebConfig           `yaml:"web"`
+	Remediation   RemediationConfig   `yaml:"remediation"`
+	Pipeline      PipelineConfig      `yaml:"pipeline"`
+	Fingerprint   FingerprintConfig   `yaml:"fingerprint"`
+	RulesFile     string              `yaml:"rules_file"`
+	Store         StoreConfig         `yaml:"store"`
 }
 
 // LokiConfig holds Loki connection settings
 type LokiConfig struct {
-	URL          string        `yaml:"url"`
+	Enabled        bool          `yaml:"enabled"`
+	URL            string        `yaml:"url"`
+	Mode           string        `yaml:"mode"` // poll or tail
+	Query          string        `yaml:"query"`
+	PollInterval   time.Duration `yaml:"poll_interval"`
+	Lookback       time.Duration `yaml:"lookback"`
+	PageSize       int           `yaml:"page_size"`
+	MaxPages       int           `yaml:"max_pages"`
+	CheckpointFile string        `yaml:"checkpoint_file,omitempty"`
+	MaxCatchUp     time.Duration `yaml:"max_catch_up"`
+	TenantID       string        `yaml:"tenant_id,omitempty"`
+	Username       string        `yaml:"username,omitempty"`
+	Password       string        `yaml:"password,omitempty"`
+
+	// TenantIDs queries several tenants instead of TenantID: one poller
+	// per tenant, or a single federated query when Federate is set
+	TenantIDs []string `yaml:"tenant_ids,omitempty"`
+	Federate  bool     `yaml:"federate,omitempty"`
+
+	// BearerToken or the token in BearerTokenFile is sent instead of basic
+	// auth. The file is re-read when it changes.
+	BearerToken     string `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string `yaml:"bearer_token_file,omitempty"`
+
+	// Timeout bounds each request attempt
+	Timeout        time.Duration        `yaml:"timeout"`
+	TLS            TLSConfig            `yaml:"tls"`
+	Retry          RetryConfig          `yaml:"retry"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	// Queries defines multiple named query sources. When empty, the
+	// top-level query settings form a single source named "default".
+	Queries []LokiQueryConfig `yaml:"queries,omitempty"`
+
+	// MetricQueries evaluate LogQL metric queries such as rate() or
+	// count_over_time() and raise an error per series over a threshold
+	MetricQueries []LokiMetricQueryConfig `yaml:"metric_queries,omitempty"`
+
+	// LogFields maps JSON/logfmt keys onto structured fields for every
+	// query and the push receiver; they can override individual fields
+	LogFields LogFieldsConfig `yaml:"log_fields,omitempty"`
+
+	// Multiline joins stack trace lines into a single error for every
+	// query and the push receiver
+	Multiline MultilineConfig `yaml:"multiline"`
+
+	// Push accepts logs sent to /loki/api/v1/push by Promtail or Alloy
+	Push LokiPushConfig `yaml:"push"`
+}
+
+// TLSConfig holds certificates for HTTPS connections. Files are PEM encoded.
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// RetryConfig controls retries of requests failing with 429, 5xx or a
+// network error. The wait doubles from MinBackoff up to MaxBackoff, or
+// follows Retry-After when the server sends it.
+type RetryConfig struct {
+	MaxRetries int           `yaml:"max_retries"`
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// CircuitBreakerConfig controls when requests stop being sent to a
+// failing backend. The circuit opens after FailureThreshold consecutive
+// failed requests and lets a probe through after OpenTimeout.
+type CircuitBreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+}
+
+// MultilineConfig controls stack trace assembly. Lines continue an entry
+// from the same stream when they arrive within MaxGap of the previous line.
+type MultilineConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	MaxGap   time.Duration `yaml:"max_gap"`
+	MaxLines int           `yaml:"max_lines"`
+}
+
+// FingerprintConfig controls how errors are grouped for deduplication
+type FingerprintConfig struct {
+	// StackFrames is the number of in-app frames that, together with the
+	// exception type, identify an error with a stack trace. 0 groups
+	// stack traces by message instead.
+	StackFrames int `yaml:"stack_frames"`
+
+	// ExcludeFrames lists extra function or file prefixes of library
+	// frames that are not considered in-app
+	ExcludeFrames []string `yaml:"exclude_frames,omitempty"`
+
+	// Masks replace variable parts of messages such as order IDs before
+	// the built-in masks (timestamps, UUIDs, hex IDs, IPs, long numbers)
+	Masks        []MaskConfig `yaml:"masks,omitempty"`
+	DefaultMasks bool         `yaml:"default_masks"`
+
+	// PodPatterns extract the workload name from pod names as their first
+	// capture group, before the built-in deployment, statefulset and job
+	// patterns. NormalizePodNames false groups every pod separately.
+	PodPatterns       []string `yaml:"pod_patterns,omitempty"`
+	NormalizePodNames bool     `yaml:"normalize_pod_names"`
+
+	// Templates learns message templates from log lines and groups errors
+	// by template, so messages differing only in IDs, names or counts
+	// become a single error
+	Templates TemplatesConfig `yaml:"templates"`
+}
+
+// TemplatesConfig controls Drain-style log template mining
+type TemplatesConfig struct {
+	Enabled      bool    `yaml:"enabled"`
+	Similarity   float64 `yaml:"similarity"`    // fraction of tokens shared with a template, 0-1
+	Depth        int     `yaml:"depth"`         // routing tree depth, >= 3; depth-3 leading tokens must match
+	MaxChildren  int     `yaml:"max_children"`  // per routing node
+	MaxTemplates int     `yaml:"max_templates"` // least recently seen are forgotten
+	ParamSamples int     `yaml:"param_samples"` // distinct values kept per wildcard
+}
+
+// MaskConfig replaces matches of Pattern with Replacement, which may refer
+// to capture groups as $1
+type MaskConfig struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
+
+// LogFieldsConfig lists the keys each structured field is read from, in
+// order of preference. Empty lists use the built-in defaults.
+type LogFieldsConfig struct {
+	Level   []string `yaml:"level,omitempty"`
+	Message []string `yaml:"message,omitempty"`
+	Error   []string `yaml:"error,omitempty"`
+	Caller  []string `yaml:"caller,omitempty"`
+	TraceID []string `yaml:"trace_id,omitempty"`
+	SpanID  []string `yaml:"span_id,omitempty"`
+}
+
+// LokiPushConfig holds settings for the Loki push API receiver
+type LokiPushConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Name        string `yaml:"name"`
+	LineFilter  string `yaml:"line_filter"` // regex; only matching lines are processed
+	MaxBodySize int64  `yaml:"max_body_size"`
+
+	// BearerToken or the token in BearerTokenFile must be sent by clients.
+	// The file is re-read when it changes.
+	BearerToken     string `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string `yaml:"bearer_token_file,omitempty"`
+
+	// AllowedTenants restricts the X-Scope-OrgID header clients push with;
+	// empty accepts any tenant
+	AllowedTenants []string `yaml:"allowed_tenants,omitempty"`
+
+	LogFields LogFieldsConfig `yaml:"log_fields,omitempty"`
+}
+
+// LokiQueryConfig holds settings for one named Loki query source.
+// Unset fields inherit the top-level LokiConfig values.
+type LokiQueryConfig struct {
+	Name         string        `yaml:"name"`
 	Query        string        `yaml:"query"`
-	PollInterval time.Duration `yaml:"poll_interval"`
-	Lookback     time.Duration `yaml:"lookback"`
+	Mode         string        `yaml:"mode,omitempty"`
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+	Lookback     time.Duration `yaml:"lookback,omitempty"`
 	TenantID     string        `yaml:"tenant_id,omitempty"`
-	Username     string        `yaml:"username,omitempty"`
-	Password     string        `yaml:"password,omitempty"`
+	TenantIDs    []string      `yaml:"tenant_ids,omitempty"`
+	Federate     bool          `yaml:"federate,omitempty"`
+
+	// LineFilter only processes lines matching the regex, applied after
+	// multiline assembly; empty processes every line
+	LineFilter string `yaml:"line_filter,omitempty"`
+
+	LogFields LogFieldsConfig `yaml:"log_fields,omitempty"`
+}
+
+// LokiMetricQueryConfig holds settings for one LogQL metric query source.
+// Unset fields inherit the top-level LokiConfig values.
+type LokiMetricQueryConfig struct {
+	Name      string          `yaml:"name"`
+	Query     string          `yaml:"query"`
+	Interval  time.Duration   `yaml:"interval,omitempty"`
+	Threshold ThresholdConfig `yaml:"threshold"`
+	Message   string          `yaml:"message,omitempty"`
+	TenantID  string          `yaml:"tenant_id,omitempty"`
+	TenantIDs []string        `yaml:"tenant_ids,omitempty"`
+	Federate  bool            `yaml:"federate,omitempty"`
+}
+
+// ThresholdConfig compares each series value against Value with Op
+type ThresholdConfig struct {
+	Op    string  `yaml:"op"` // >, >=, <, <=, == or !=
+	Value float64 `yaml:"value"`
+}
+
+// ElasticsearchConfig holds Elasticsearch/OpenSearch source settings
+type ElasticsearchConfig struct {
+	Enabled        bool                      `yaml:"enabled"`
+	Name           string                    `yaml:"name"`
+	URL            string                    `yaml:"url"`
+	Index          string                    `yaml:"index"`
+	Query          string                    `yaml:"query"` // Lucene query_string syntax
+	PollInterval   time.Duration             `yaml:"poll_interval"`
+	Lookback       time.Duration             `yaml:"lookback"`
+	PageSize       int                       `yaml:"page_size"`
+	MaxPages       int                       `yaml:"max_pages"`
+	CheckpointFile string                    `yaml:"checkpoint_file,omitempty"`
+	MaxCatchUp     time.Duration             `yaml:"max_catch_up"`
+	Username       string                    `yaml:"username,omitempty"`
+	Password       string                    `yaml:"password,omitempty"`
+	APIKey         string                    `yaml:"api_key,omitempty"`
+	Fields         ElasticsearchFieldsConfig `yaml:"fields"`
+	LogFields      LogFieldsConfig           `yaml:"log_fields,omitempty"`
+}
+
+// ElasticsearchFieldsConfig maps document fields onto error fields.
+// Dotted names resolve through nested objects.
+type ElasticsearchFieldsConfig struct {
+	Timestamp string `yaml:"timestamp"`
+	Message   string `yaml:"message"`
+	Namespace string `yaml:"namespace"`
+	Pod       string `yaml:"pod"`
+	Container string `yaml:"container"`
+	Labels    string `yaml:"labels"`
+}
+
+// OTLPConfig holds settings for the OTLP/HTTP logs receiver
+type OTLPConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Name        string `yaml:"name"`
+	MinSeverity string `yaml:"min_severity"` // trace, debug, info, warn, error or fatal
+	MaxBodySize int64  `yaml:"max_body_size"`
+
+	// BearerToken or the token in BearerTokenFile must be sent by clients.
+	// The file is re-read when it changes.
+	BearerToken     string `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string `yaml:"bearer_token_file,omitempty"`
+
+	LogFields LogFieldsConfig `yaml:"log_fields,omitempty"`
 }
 
 // KubernetesConfig holds Kubernetes connection settings
 type KubernetesConfig struct {
 	InCluster  bool   `yaml:"in_cluster"`
 	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+
+	// WatchEvents turns Warning events into errors via an informer
+	WatchEvents     bool          `yaml:"watch_events"`
+	EventsNamespace string        `yaml:"events_namespace,omitempty"` // empty watches all namespaces
+	EventsLookback  time.Duration `yaml:"events_lookback"`
+
+	// WatchPods reports failing container states (CrashLoopBackOff,
+	// OOMKilled, restarts) from pod status via an informer
+	WatchPods     bool          `yaml:"watch_pods"`
+	PodsNamespace string        `yaml:"pods_namespace,omitempty"` // empty watches all namespaces
+	PodsLookback  time.Duration `yaml:"pods_lookback"`
 }
 
 // WebConfig holds web server settings
@@ -47,6 +299,33 @@ type RemediationConfig struct {
 	DryRun            bool     `yaml:"dry_run"`
 	MaxActionsPerHour int      `yaml:"max_actions_per_hour"`
 	ExcludedNamespaces []string `yaml:"excluded_namespaces"`
+
+	// Tenants narrows remediation for errors from individual Loki tenants
+	Tenants map[string]RemediationTenantConfig `yaml:"tenants,omitempty"`
+}
+
+// RemediationTenantConfig restricts remediation for one tenant. Enabled
+// false skips every action and DryRun only logs them; neither can turn on
+// what is disabled globally.
+type RemediationTenantConfig struct {
+	Enabled            *bool    `yaml:"enabled,omitempty"`
+	DryRun             bool     `yaml:"dry_run"`
+	ExcludedNamespaces []string `yaml:"excluded_namespaces,omitempty"`
+}
+
+// PipelineConfig sizes the queues and worker pools between ingestion,
+// matching, remediation and dashboard updates
+type PipelineConfig struct {
+	Match     PipelineStageConfig `yaml:"match"`
+	Remediate PipelineStageConfig `yaml:"remediate"`
+	Notify    PipelineStageConfig `yaml:"notify"` // always a single worker
+}
+
+// PipelineStageConfig holds settings for one pipeline stage
+type PipelineStageConfig struct {
+	QueueSize int    `yaml:"queue_size"`
+	Workers   int    `yaml:"workers,omitempty"`
+	Overflow  string `yaml:"overflow"` // block, drop-newest or drop-oldest
 }
 
 // StoreConfig holds data store settings
@@ -59,13 +338,64 @@ type StoreConfig struct {
 func DefaultConfig() *Config {
 	return &Config{
 		Loki: LokiConfig{
+			Enabled:      true,
 			URL:          "http://loki.monitoring:3100",
+			Mode:         "poll",
 			Query:        `{namespace=~".+"} |~ "(?i)(error|fatal|panic|exception|fail)"`,
 			PollInterval: 30 * time.Second,
 			Lookback:     5 * time.Minute,
+			PageSize:     1000,
+			MaxPages:     50,
+			MaxCatchUp:   time.Hour,
+			Timeout:      30 * time.Second,
+			Retry: RetryConfig{
+				MaxRetries: 3,
+				MinBackoff: 500 * time.Millisecond,
+				MaxBackoff: 10 * time.Second,
+			},
+			CircuitBreaker: CircuitBreakerConfig{
+				Enabled:          true,
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+			},
+			Multiline: MultilineConfig{
+				Enabled:  false,
+				MaxGap:   time.Second,
+				MaxLines: 500,
+			},
+			Push: LokiPushConfig{
+				Name:        "push",
+				LineFilter:  `(?i)(error|fatal|panic|exception|fail)`,
+				MaxBodySize: 10 << 20,
+			},
+		},
+		Elasticsearch: ElasticsearchConfig{
+			Name:         "elasticsearch",
+			Index:        "logs-*",
+			Query:        `level:(error OR fatal OR panic) OR message:(error OR exception OR panic OR fatal)`,
+			PollInterval: 30 * time.Second,
+			Lookback:     5 * time.Minute,
+			PageSize:     500,
+			MaxPages:     50,
+			MaxCatchUp:   time.Hour,
+			Fields: ElasticsearchFieldsConfig{
+				Timestamp: "@timestamp",
+				Message:   "message",
+				Namespace: "kubernetes.namespace_name",
+				Pod:       "kubernetes.pod_name",
+				Container: "kubernetes.container_name",
+				Labels:    "kubernetes.labels",
+			},
+		},
+		OTLP: OTLPConfig{
+			Name:        "otlp",
+			MinSeverity: "error",
+			MaxBodySize: 10 << 20,
 		},
 		Kubernetes: KubernetesConfig{
-			InCluster: true,
+			InCluster:      true,
+			EventsLookback: 5 * time.Minute,
+			PodsLookback:   15 * time.Minute,
 		},
 		Web: WebConfig{
 			Listen: ":8080",
@@ -79,6 +409,34 @@ func DefaultConfig() *Config {
 				"monitoring",
 			},
 		},
+		Pipeline: PipelineConfig{
+			Match: PipelineStageConfig{
+				QueueSize: 10000,
+				Workers:   4,
+				Overflow:  "block",
+			},
+			Remediate: PipelineStageConfig{
+				QueueSize: 1000,
+				Workers:   2,
+				Overflow:  "drop-newest",
+			},
+			Notify: PipelineStageConfig{
+				QueueSize: 1000,
+				Overflow:  "drop-oldest",
+			},
+		},
+		Fingerprint: FingerprintConfig{
+			StackFrames:       3,
+			DefaultMasks:      true,
+			NormalizePodNames: true,
+			Templates: TemplatesConfig{
+				Similarity:   0.4,
+				Depth:        4,
+				MaxChildren:  100,
+				MaxTemplates: 5000,
+				ParamSamples: 10,
+			},
+		},
 		RulesFile: "/etc/kube-sentinel/rules.yaml",
 		Store: StoreConfig{
 			Type: "memory",
@@ -119,22 +477,202 @@ func LoadOrDefault(path string) (*Config, error) {
 	return Load(path)
 }
 
+// QuerySources returns the named query sources with defaults applied
+func (c LokiConfig) QuerySources() []LokiQueryConfig {
+	if len(c.Queries) == 0 {
+		return []LokiQueryConfig{{
+			Name:         "default",
+			Query:        c.Query,
+			Mode:         c.Mode,
+			PollInterval: c.PollInterval,
+			Lookback:     c.Lookback,
+			TenantID:     c.TenantID,
+			TenantIDs:    c.TenantIDs,
+			Federate:     c.Federate,
+			LogFields:    c.LogFields,
+		}}
+	}
+
+	sources := make([]LokiQueryConfig, len(c.Queries))
+	for i, q := range c.Queries {
+		if q.Mode == "" {
+			q.Mode = c.Mode
+		}
+		if q.PollInterval == 0 {
+			q.PollInterval = c.PollInterval
+		}
+		if q.Lookback == 0 {
+			q.Lookback = c.Lookback
+		}
+		if q.TenantID == "" && len(q.TenantIDs) == 0 {
+			q.TenantID = c.TenantID
+			q.TenantIDs = c.TenantIDs
+			q.Federate = c.Federate
+		}
+		q.LogFields = q.LogFields.Inherit(c.LogFields)
+		sources[i] = q
+	}
+	return sources
+}
+
+// MetricQuerySources returns the metric query sources with defaults applied
+func (c LokiConfig) MetricQuerySources() []LokiMetricQueryConfig {
+	sources := make([]LokiMetricQueryConfig, len(c.MetricQueries))
+	for i, q := range c.MetricQueries {
+		if q.Interval == 0 {
+			q.Interval = c.PollInterval
+		}
+		if q.TenantID == "" && len(q.TenantIDs) == 0 {
+			q.TenantID = c.TenantID
+			q.TenantIDs = c.TenantIDs
+			q.Federate = c.Federate
+		}
+		sources[i] = q
+	}
+	return sources
+}
+
+// ClientTenants returns the X-Scope-OrgID of each client the source
+// queries with
+func (q LokiQueryConfig) ClientTenants() []string {
+	return clientTenants(q.TenantID, q.TenantIDs, q.Federate)
+}
+
+// ClientTenants returns the X-Scope-OrgID of each client the source
+// queries with
+func (q LokiMetricQueryConfig) ClientTenants() []string {
+	return clientTenants(q.TenantID, q.TenantIDs, q.Federate)
+}
+
+// clientTenants fans out to one client per tenant, or joins the tenants
+// into a single federated query
+func clientTenants(tenantID string, tenantIDs []string, federate bool) []string {
+	switch {
+	case len(tenantIDs) == 0:
+		return []string{tenantID}
+	case federate:
+		return []string{strings.Join(tenantIDs, "|")}
+	default:
+		return tenantIDs
+	}
+}
+
+// validateTenants checks the tenant settings of a source
+func validateTenants(prefix, tenantID string, tenantIDs []string, federate bool) error {
+	if tenantID != "" && len(tenantIDs) > 0 {
+		return fmt.Errorf("%s: tenant_id and tenant_ids are mutually exclusive", prefix)
+	}
+	if federate && len(tenantIDs) == 0 {
+		return fmt.Errorf("%s.federate requires tenant_ids", prefix)
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range tenantIDs {
+		if id == "" || strings.Contains(id, "|") {
+			return fmt.Errorf("%s.tenant_ids: invalid tenant %q", prefix, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%s.tenant_ids: duplicate tenant %q", prefix, id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// Inherit returns c with empty key lists taken from parent
+func (c LogFieldsConfig) Inherit(parent LogFieldsConfig) LogFieldsConfig {
+	if len(c.Level) == 0 {
+		c.Level = parent.Level
+	}
+	if len(c.Message) == 0 {
+		c.Message = parent.Message
+	}
+	if len(c.Error) == 0 {
+		c.Error = parent.Error
+	}
+	if len(c.Caller) == 0 {
+		c.Caller = parent.Caller
+	}
+	if len(c.TraceID) == 0 {
+		c.TraceID = parent.TraceID
+	}
+	if len(c.SpanID) == 0 {
+		c.SpanID = parent.SpanID
+	}
+	return c
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.Loki.URL == "" {
-		return fmt.Errorf("loki.url is required")
+	if !c.Loki.Enabled && !c.Loki.Push.Enabled && !c.Elasticsearch.Enabled && !c.OTLP.Enabled &&
+		!c.Kubernetes.WatchEvents && !c.Kubernetes.WatchPods {
+		return fmt.Errorf("at least one source (loki, loki.push, elasticsearch, otlp, kubernetes.watch_events or kubernetes.watch_pods) must be enabled")
 	}
 
-	if c.Loki.Query == "" {
-		return fmt.Errorf("loki.query is required")
+	if c.Loki.Enabled {
+		if err := c.Loki.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Elasticsearch.Enabled {
+		if err := c.Elasticsearch.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Loki.Push.Enabled {
+		if err := c.Loki.Push.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Loki.Enabled || c.Loki.Push.Enabled {
+		if err := c.Loki.Multiline.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.OTLP.Enabled {
+		if err := c.OTLP.validate(); err != nil {
+			return err
+		}
 	}
 
-	if c.Loki.PollInterval < time.Second {
-		return fmt.Errorf("loki.poll_interval must be at least 1s")
+	// Source names tag errors and key checkpoints, so they must be unique
+	names := make(map[string]bool)
+	if c.Loki.Enabled {
+		for _, q := range c.Loki.QuerySources() {
+			names[q.Name] = true
+		}
+		for _, q := range c.Loki.MetricQuerySources() {
+			if names[q.Name] {
+				return fmt.Errorf("loki.metric_queries: name %q is already used by another source", q.Name)
+			}
+			names[q.Name] = true
+		}
+	}
+	if c.Loki.Push.Enabled {
+		if names[c.Loki.Push.Name] {
+			return fmt.Errorf("loki.push.name %q is already used by a loki query", c.Loki.Push.Name)
+		}
+		names[c.Loki.Push.Name] = true
+	}
+	if c.Elasticsearch.Enabled {
+		if names[c.Elasticsearch.Name] {
+			return fmt.Errorf("elasticsearch.name %q is already used by another source", c.Elasticsearch.Name)
+		}
+		names[c.Elasticsearch.Name] = true
+	}
+	if c.OTLP.Enabled && names[c.OTLP.Name] {
+		return fmt.Errorf("otlp.name %q is already used by another source", c.OTLP.Name)
 	}
 
-	if c.Loki.Lookback < c.Loki.PollInterval {
-		return fmt.Errorf("loki.lookback must be >= poll_interval")
+	if c.Kubernetes.EventsLookback < 0 {
+		return fmt.Errorf("kubernetes.events_lookback must be >= 0")
+	}
+	if c.Kubernetes.PodsLookback < 0 {
+		return fmt.Errorf("kubernetes.pods_lookback must be >= 0")
 	}
 
 	if c.Web.Listen == "" {
@@ -145,9 +683,341 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("remediation.max_actions_per_hour must be >= 0")
 	}
 
+	if err := c.Pipeline.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Fingerprint.validate(); err != nil {
+		return err
+	}
+
 	if c.Store.Type != "memory" && c.Store.Type != "sqlite" {
 		return fmt.Errorf("store.type must be 'memory' or 'sqlite'")
 	}
 
 	return nil
 }
+
+func (c LokiConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("loki.url is required")
+	}
+
+	if len(c.Queries) == 0 && c.Query == "" {
+		return fmt.Errorf("loki.query is required")
+	}
+
+	if err := validateTenants("loki", c.TenantID, c.TenantIDs, c.Federate); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, q := range c.QuerySources() {
+		if q.Name == "" {
+			return fmt.Errorf("loki.queries: name is required")
+		}
+		if names[q.Name] {
+			return fmt.Errorf("loki.queries: duplicate name %q", q.Name)
+		}
+		names[q.Name] = true
+
+		prefix := "loki"
+		if len(c.Queries) > 0 {
+			prefix = fmt.Sprintf("loki.queries[%s]", q.Name)
+		}
+
+		if q.Query == "" {
+			return fmt.Errorf("%s.query is required", prefix)
+		}
+
+		if q.Mode != "poll" && q.Mode != "tail" {
+			return fmt.Errorf("%s.mode must be 'poll' or 'tail'", prefix)
+		}
+
+		if q.PollInterval < time.Second {
+			return fmt.Errorf("%s.poll_interval must be at least 1s", prefix)
+		}
+
+		if q.Lookback < q.PollInterval {
+			return fmt.Errorf("%s.lookback must be >= poll_interval", prefix)
+		}
+
+		if _, err := regexp.Compile(q.LineFilter); err != nil {
+			return fmt.Errorf("%s.line_filter: %w", prefix, err)
+		}
+
+		if err := validateTenants(prefix, q.TenantID, q.TenantIDs, q.Federate); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range c.MetricQuerySources() {
+		if q.Name == "" {
+			return fmt.Errorf("loki.metric_queries: name is required")
+		}
+
+		prefix := fmt.Sprintf("loki.metric_queries[%s]", q.Name)
+
+		if q.Query == "" {
+			return fmt.Errorf("%s.query is required", prefix)
+		}
+
+		if q.Interval < time.Second {
+			return fmt.Errorf("%s.interval must be at least 1s", prefix)
+		}
+
+		switch q.Threshold.Op {
+		case ">", ">=", "<", "<=", "==", "!=":
+		default:
+			return fmt.Errorf("%s.threshold.op must be one of >, >=, <, <=, == or !=", prefix)
+		}
+
+		if err := validateTenants(prefix, q.TenantID, q.TenantIDs, q.Federate); err != nil {
+			return err
+		}
+	}
+
+	if c.PageSize < 1 {
+		return fmt.Errorf("loki.page_size must be >= 1")
+	}
+
+	if c.MaxPages < 1 {
+		return fmt.Errorf("loki.max_pages must be >= 1")
+	}
+
+	if c.MaxCatchUp < 0 {
+		return fmt.Errorf("loki.max_catch_up must be >= 0")
+	}
+
+	if c.BearerToken != "" && c.BearerTokenFile != "" {
+		return fmt.Errorf("loki.bearer_token and loki.bearer_token_file are mutually exclusive")
+	}
+
+	if (c.BearerToken != "" || c.BearerTokenFile != "") && c.Username != "" {
+		return fmt.Errorf("loki: use either basic auth or a bearer token, not both")
+	}
+
+	if c.Timeout < time.Second {
+		return fmt.Errorf("loki.timeout must be at least 1s")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("loki.tls.cert_file and loki.tls.key_file must be set together")
+	}
+
+	if c.Retry.MaxRetries < 0 {
+		return fmt.Errorf("loki.retry.max_retries must be >= 0")
+	}
+
+	if c.Retry.MaxRetries > 0 {
+		if c.Retry.MinBackoff <= 0 {
+			return fmt.Errorf("loki.retry.min_backoff must be > 0")
+		}
+		if c.Retry.MaxBackoff < c.Retry.MinBackoff {
+			return fmt.Errorf("loki.retry.max_backoff must be >= min_backoff")
+		}
+	}
+
+	if c.CircuitBreaker.Enabled {
+		if c.CircuitBreaker.FailureThreshold < 1 {
+			return fmt.Errorf("loki.circuit_breaker.failure_threshold must be >= 1")
+		}
+		if c.CircuitBreaker.OpenTimeout <= 0 {
+			return fmt.Errorf("loki.circuit_breaker.open_timeout must be > 0")
+		}
+	}
+
+	return nil
+}
+
+func (c FingerprintConfig) validate() error {
+	if c.StackFrames < 0 {
+		return fmt.Errorf("fingerprint.stack_frames must be >= 0")
+	}
+
+	for i, m := range c.Masks {
+		if m.Pattern == "" {
+			return fmt.Errorf("fingerprint.masks[%d].pattern is required", i)
+		}
+		if _, err := regexp.Compile(m.Pattern); err != nil {
+			return fmt.Errorf("fingerprint.masks[%d].pattern: %w", i, err)
+		}
+	}
+
+	for i, p := range c.PodPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("fingerprint.pod_patterns[%d]: %w", i, err)
+		}
+		if re.NumSubexp() < 1 {
+			return fmt.Errorf("fingerprint.pod_patterns[%d]: a capture group for the workload name is required", i)
+		}
+	}
+
+	return c.Templates.validate()
+}
+
+func (c TemplatesConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Similarity <= 0 || c.Similarity > 1 {
+		return fmt.Errorf("fingerprint.templates.similarity must be > 0 and <= 1")
+	}
+
+	if c.Depth < 3 {
+		return fmt.Errorf("fingerprint.templates.depth must be >= 3")
+	}
+
+	if c.MaxChildren < 1 {
+		return fmt.Errorf("fingerprint.templates.max_children must be >= 1")
+	}
+
+	if c.MaxTemplates < 1 {
+		return fmt.Errorf("fingerprint.templates.max_templates must be >= 1")
+	}
+
+	if c.ParamSamples < 0 {
+		return fmt.Errorf("fingerprint.templates.param_samples must be >= 0")
+	}
+
+	return nil
+}
+
+func (c MultilineConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.MaxGap <= 0 {
+		return fmt.Errorf("loki.multiline.max_gap must be > 0")
+	}
+
+	if c.MaxLines < 2 {
+		return fmt.Errorf("loki.multiline.max_lines must be >= 2")
+	}
+
+	return nil
+}
+
+func (c ElasticsearchConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("elasticsearch.name is required")
+	}
+
+	if c.URL == "" {
+		return fmt.Errorf("elasticsearch.url is required")
+	}
+
+	if c.Index == "" {
+		return fmt.Errorf("elasticsearch.index is required")
+	}
+
+	if c.Query == "" {
+		return fmt.Errorf("elasticsearch.query is required")
+	}
+
+	if c.PollInterval < time.Second {
+		return fmt.Errorf("elasticsearch.poll_interval must be at least 1s")
+	}
+
+	if c.Lookback < c.PollInterval {
+		return fmt.Errorf("elasticsearch.lookback must be >= poll_interval")
+	}
+
+	if c.PageSize < 1 {
+		return fmt.Errorf("elasticsearch.page_size must be >= 1")
+	}
+
+	if c.MaxPages < 1 {
+		return fmt.Errorf("elasticsearch.max_pages must be >= 1")
+	}
+
+	if c.MaxCatchUp < 0 {
+		return fmt.Errorf("elasticsearch.max_catch_up must be >= 0")
+	}
+
+	if c.Fields.Timestamp == "" {
+		return fmt.Errorf("elasticsearch.fields.timestamp is required")
+	}
+
+	return nil
+}
+
+func (c LokiPushConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("loki.push.name is required")
+	}
+
+	if _, err := regexp.Compile(c.LineFilter); err != nil {
+		return fmt.Errorf("loki.push.line_filter: %w", err)
+	}
+
+	if c.MaxBodySize < 1 {
+		return fmt.Errorf("loki.push.max_body_size must be >= 1")
+	}
+
+	if c.BearerToken != "" && c.BearerTokenFile != "" {
+		return fmt.Errorf("loki.push.bearer_token and loki.push.bearer_token_file are mutually exclusive")
+	}
+
+	for _, tenant := range c.AllowedTenants {
+		if tenant == "" {
+			return fmt.Errorf("loki.push.allowed_tenants must not contain empty tenants")
+		}
+	}
+
+	return nil
+}
+
+func (c OTLPConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("otlp.name is required")
+	}
+
+	switch strings.ToLower(c.MinSeverity) {
+	case "trace", "debug", "info", "warn", "warning", "error", "fatal":
+	default:
+		return fmt.Errorf("otlp.min_severity must be one of trace, debug, info, warn, error or fatal")
+	}
+
+	if c.MaxBodySize < 1 {
+		return fmt.Errorf("otlp.max_body_size must be >= 1")
+	}
+
+	if c.BearerToken != "" && c.BearerTokenFile != "" {
+		return fmt.Errorf("otlp.bearer_token and otlp.bearer_token_file are mutually exclusive")
+	}
+
+	return nil
+}
+
+func (c PipelineConfig) validate() error {
+	stages := []struct {
+		name string
+		cfg  PipelineStageConfig
+	}{
+		{"match", c.Match},
+		{"remediate", c.Remediate},
+		{"notify", c.Notify},
+	}
+
+	for _, st := range stages {
+		if st.cfg.QueueSize < 1 {
+			return fmt.Errorf("pipeline.%s.queue_size must be >= 1", st.name)
+		}
+
+		if st.name != "notify" && st.cfg.Workers < 1 {
+			return fmt.Errorf("pipeline.%s.workers must be >= 1", st.name)
+		}
+
+		switch st.cfg.Overflow {
+		case "block", "drop-newest", "drop-oldest":
+		default:
+			return fmt.Errorf("pipeline.%s.overflow must be 'block', 'drop-newest' or 'drop-oldest'", st.name)
+		}
+	}
+
+	return nil
+}
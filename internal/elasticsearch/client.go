@@ -0,0 +1,161 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client handles communication with the Elasticsearch/OpenSearch search API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	username   string
+	password   string
+	apiKey     string
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithBasicAuth sets basic authentication credentials
+func WithBasicAuth(username, password string) ClientOption {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithAPIKey sets an Elasticsearch API key (base64 encoded id:key)
+func WithAPIKey(apiKey string) ClientOption {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// WithHTTPClient sets a custom HTTP client
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient creates a new Elasticsearch/OpenSearch client
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// SearchRequest is the subset of the _search request body used by the poller
+type SearchRequest struct {
+	Size        int                      `json:"size"`
+	Query       map[string]interface{}   `json:"query"`
+	Sort        []map[string]interface{} `json:"sort"`
+	SearchAfter []interface{}            `json:"search_after,omitempty"`
+}
+
+// SearchResponse represents the response from the _search API
+type SearchResponse struct {
+	TimedOut bool `json:"timed_out"`
+	Hits     struct {
+		Hits []Hit `json:"hits"`
+	} `json:"hits"`
+}
+
+// Hit is a single document returned by a search
+type Hit struct {
+	Index  string                 `json:"_index"`
+	ID     string                 `json:"_id"`
+	Source map[string]interface{} `json:"_source"`
+	Sort   []interface{}          `json:"sort"`
+}
+
+// Search executes a search against the given index pattern
+func (c *Client) Search(ctx context.Context, index string, search SearchRequest) (*SearchResponse, error) {
+	body, err := json.Marshal(search)
+	if err != nil {
+		return nil, fmt.Errorf("encoding search request: %w", err)
+	}
+
+	reqURL := fmt.Sprintf("%s/%s/_search?ignore_unavailable=true", c.baseURL, url.PathEscape(index))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("elasticsearch returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var searchResp SearchResponse
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&searchResp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	if searchResp.TimedOut {
+		return nil, fmt.Errorf("search timed out")
+	}
+
+	return &searchResp, nil
+}
+
+// Ready checks if the cluster is reachable
+func (c *Client) Ready(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/", nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("elasticsearch not ready, status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (c *Client) setHeaders(req *http.Request) {
+	req.Header.Set("Accept", "application/json")
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.apiKey)
+	} else if c.username != "" && c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
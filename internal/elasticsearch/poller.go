@@ -0,0 +1,513 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+// FieldMapping maps document fields onto ParsedError fields.
+// Dotted names are resolved through nested objects as well as flattened keys.
+type FieldMapping struct {
+	Timestamp string
+	Message   string
+	Namespace string
+	Pod       string
+	Container string
+	Labels    string // object whose keys are copied into labels
+}
+
+// DefaultFieldMapping matches the layout written by Fluent Bit's kubernetes filter
+func DefaultFieldMapping() FieldMapping {
+	return FieldMapping{
+		Timestamp: "@timestamp",
+		Message:   "message",
+		Namespace: "kubernetes.namespace_name",
+		Pod:       "kubernetes.pod_name",
+		Container: "kubernetes.container_name",
+		Labels:    "kubernetes.labels",
+	}
+}
+
+// Poller continuously searches Elasticsearch/OpenSearch for errors
+type Poller struct {
+	source       string
+	client       *Client
+	index        string
+	query        string
+	pollInterval time.Duration
+	lookback     time.Duration
+	fields       FieldMapping
+	logFields    loki.FieldMapping
+	fingerprint  loki.FingerprintConfig
+	handler      loki.ErrorHandler
+	logger       *slog.Logger
+
+	// Pagination
+	pageSize int
+	maxPages int
+
+	// Deduplication
+	seen        loki.Dedup
+	mu          sync.RWMutex
+	seenDocs    map[string]time.Time // index/_id -> document timestamp
+	windowSize  time.Duration
+	lastPollEnd time.Time
+
+	// Persistence across restarts
+	checkpoints    loki.CheckpointStore
+	checkpointName string
+	maxCatchUp     time.Duration
+}
+
+// PollerOption configures a Poller
+type PollerOption func(*Poller)
+
+// WithSource sets the source name used to tag errors and checkpoints
+func WithSource(name string) PollerOption {
+	return func(p *Poller) {
+		p.source = name
+	}
+}
+
+// WithLogger sets the logger for the poller
+func WithLogger(logger *slog.Logger) PollerOption {
+	return func(p *Poller) {
+		p.logger = logger
+	}
+}
+
+// WithFieldMapping sets how document fields map onto errors
+func WithFieldMapping(fields FieldMapping) PollerOption {
+	return func(p *Poller) {
+		p.fields = fields
+	}
+}
+
+// WithLogFields sets the document or message keys structured fields such
+// as level and trace_id are read from
+func WithLogFields(m loki.FieldMapping) PollerOption {
+	return func(p *Poller) {
+		p.logFields = m
+	}
+}
+
+// WithFingerprint sets how errors are grouped into fingerprints
+func WithFingerprint(cfg loki.FingerprintConfig) PollerOption {
+	return func(p *Poller) {
+		p.fingerprint = cfg
+	}
+}
+
+// WithPageSize sets the number of hits requested per search page
+func WithPageSize(n int) PollerOption {
+	return func(p *Poller) {
+		p.pageSize = n
+	}
+}
+
+// WithMaxPages caps the number of pages fetched in a single poll
+func WithMaxPages(n int) PollerOption {
+	return func(p *Poller) {
+		p.maxPages = n
+	}
+}
+
+// WithWindowSize sets the deduplication window size
+func WithWindowSize(d time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.windowSize = d
+	}
+}
+
+// WithCheckpoint persists the poll watermark and dedup state under name
+func WithCheckpoint(store loki.CheckpointStore, name string) PollerOption {
+	return func(p *Poller) {
+		p.checkpoints = store
+		p.checkpointName = name
+	}
+}
+
+// WithMaxCatchUp limits how far back a restored watermark is backfilled
+func WithMaxCatchUp(d time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.maxCatchUp = d
+	}
+}
+
+// NewPoller creates a new Elasticsearch/OpenSearch poller. The query is a
+// Lucene query_string expression evaluated against the index pattern.
+func NewPoller(client *Client, index, query string, pollInterval, lookback time.Duration, handler loki.ErrorHandler, opts ...PollerOption) *Poller {
+	p := &Poller{
+		source:       "elasticsearch",
+		client:       client,
+		index:        index,
+		query:        query,
+		pollInterval: pollInterval,
+		lookback:     lookback,
+		fields:       DefaultFieldMapping(),
+		logFields:    loki.DefaultFieldMapping(),
+		fingerprint:  loki.DefaultFingerprintConfig(),
+		handler:      handler,
+		logger:       slog.Default(),
+		pageSize:     500,
+		maxPages:     50,
+		seenDocs:     make(map[string]time.Time),
+		windowSize:   30 * time.Minute,
+		maxCatchUp:   time.Hour,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Name returns the source name the poller tags errors with
+func (p *Poller) Name() string {
+	return p.source
+}
+
+// Start begins the polling loop
+func (p *Poller) Start(ctx context.Context) error {
+	p.logger.Info("starting elasticsearch poller",
+		"source", p.source,
+		"index", p.index,
+		"query", p.query,
+		"poll_interval", p.pollInterval,
+		"lookback", p.lookback,
+	)
+
+	p.restoreCheckpoint()
+	defer p.saveCheckpoint()
+
+	if err := p.poll(ctx); err != nil {
+		p.logger.Error("initial poll failed", "source", p.source, "error", err)
+	}
+	p.saveCheckpoint()
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	cleanupTicker := time.NewTicker(5 * time.Minute)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("stopping elasticsearch poller", "source", p.source)
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := p.poll(ctx); err != nil {
+				p.logger.Error("poll failed", "source", p.source, "error", err)
+			}
+			p.saveCheckpoint()
+
+		case <-cleanupTicker.C:
+			p.cleanupSeen()
+		}
+	}
+}
+
+func (p *Poller) poll(ctx context.Context) error {
+	end := time.Now()
+	start := end.Add(-p.lookback)
+
+	if !p.lastPollEnd.IsZero() {
+		start = p.lastPollEnd
+
+		maxCatchUp := p.maxCatchUp
+		if maxCatchUp < p.lookback {
+			maxCatchUp = p.lookback
+		}
+		if earliest := end.Add(-maxCatchUp); start.Before(earliest) {
+			p.logger.Warn("watermark older than max catch-up, skipping logs",
+				"source", p.source,
+				"watermark", start,
+				"resume_from", earliest,
+			)
+			start = earliest
+		}
+	}
+
+	p.logger.Debug("polling elasticsearch", "source", p.source, "start", start, "end", end)
+
+	watermark, err := p.pollRange(ctx, start, end)
+	if watermark.After(p.lastPollEnd) {
+		p.lastPollEnd = watermark
+	}
+	if err != nil {
+		return fmt.Errorf("searching elasticsearch: %w", err)
+	}
+
+	return nil
+}
+
+// pollRange pages through [start, end) using search_after and returns the
+// point up to which the window has been fully ingested
+func (p *Poller) pollRange(ctx context.Context, start, end time.Time) (time.Time, error) {
+	search := SearchRequest{
+		Size: p.pageSize,
+		Query: map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{
+						"range": map[string]interface{}{
+							p.fields.Timestamp: map[string]interface{}{
+								"gte":    start.UTC().Format(time.RFC3339Nano),
+								"lt":     end.UTC().Format(time.RFC3339Nano),
+								"format": "strict_date_optional_time_nanos",
+							},
+						},
+					},
+					map[string]interface{}{
+						"query_string": map[string]interface{}{
+							"query": p.query,
+						},
+					},
+				},
+			},
+		},
+		// _doc breaks ties between documents sharing a timestamp
+		Sort: []map[string]interface{}{
+			{p.fields.Timestamp: map[string]interface{}{"order": "asc"}},
+			{"_doc": map[string]interface{}{"order": "asc"}},
+		},
+	}
+
+	watermark := start
+	for page := 1; ; page++ {
+		resp, err := p.client.Search(ctx, p.index, search)
+		if err != nil {
+			return watermark, err
+		}
+
+		hits := resp.Hits.Hits
+		if len(hits) > 0 {
+			p.logger.Debug("received hits", "source", p.source, "count", len(hits), "page", page)
+
+			entries := make([]loki.LogEntry, 0, len(hits))
+			for _, hit := range hits {
+				entry, ok := p.toEntry(hit)
+				if !ok {
+					continue
+				}
+				if entry.Timestamp.After(watermark) {
+					watermark = entry.Timestamp
+				}
+				if p.markDocSeen(hit, entry.Timestamp) {
+					entries = append(entries, entry)
+				}
+			}
+			p.process(entries)
+		}
+
+		if len(hits) < p.pageSize {
+			return end, nil
+		}
+
+		search.SearchAfter = hits[len(hits)-1].Sort
+
+		if page >= p.maxPages {
+			p.logger.Warn("elasticsearch poll stopped at max pages, resuming on next poll",
+				"source", p.source,
+				"max_pages", p.maxPages,
+				"resume_from", watermark,
+			)
+			return watermark, nil
+		}
+	}
+}
+
+// process parses entries, marks fingerprints seen within the dedup window
+// as repeats and hands every occurrence to the handler
+func (p *Poller) process(entries []loki.LogEntry) {
+	var parsedErrors []loki.ParsedError
+	for _, entry := range entries {
+		parsedErrors = append(parsedErrors, *loki.ParseEntry(p.source, entry, p.logFields, p.fingerprint))
+	}
+
+	if len(parsedErrors) > 0 {
+		newCount := p.seen.Mark(parsedErrors, time.Now())
+		if newCount > 0 {
+			p.logger.Info("found new errors", "source", p.source, "count", newCount, "repeats", len(parsedErrors)-newCount)
+		}
+		p.handler(parsedErrors)
+	}
+}
+
+// toEntry converts a search hit into a log entry using the field mapping
+func (p *Poller) toEntry(hit Hit) (loki.LogEntry, bool) {
+	ts, ok := parseTimestamp(lookupField(hit.Source, p.fields.Timestamp))
+	if !ok {
+		p.logger.Debug("skipping hit without timestamp", "source", p.source, "id", hit.ID)
+		return loki.LogEntry{}, false
+	}
+
+	labels := map[string]string{"index": hit.Index}
+	if obj, ok := lookupField(hit.Source, p.fields.Labels).(map[string]interface{}); ok {
+		for k, v := range obj {
+			labels[k] = fmt.Sprint(v)
+		}
+	}
+	if v := stringField(hit.Source, p.fields.Namespace); v != "" {
+		labels["namespace"] = v
+	}
+	if v := stringField(hit.Source, p.fields.Pod); v != "" {
+		labels["pod"] = v
+	}
+	if v := stringField(hit.Source, p.fields.Container); v != "" {
+		labels["container"] = v
+	}
+
+	return loki.LogEntry{
+		Timestamp:  ts,
+		Labels:     labels,
+		Line:       stringField(hit.Source, p.fields.Message),
+		Attributes: loki.FlattenJSON(hit.Source),
+	}, true
+}
+
+// markDocSeen records a document and reports whether it was new
+func (p *Poller) markDocSeen(hit Hit, ts time.Time) bool {
+	key := hit.Index + "/" + hit.ID
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, seen := p.seenDocs[key]; seen {
+		return false
+	}
+	p.seenDocs[key] = ts
+	return true
+}
+
+func (p *Poller) cleanupSeen() {
+	cutoff := time.Now().Add(-p.windowSize)
+	remaining := p.seen.Cleanup(cutoff)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	docCutoff := cutoff
+	if lookbackCutoff := time.Now().Add(-p.lookback); lookbackCutoff.Before(docCutoff) {
+		docCutoff = lookbackCutoff
+	}
+	for key, ts := range p.seenDocs {
+		if ts.Before(docCutoff) {
+			delete(p.seenDocs, key)
+		}
+	}
+
+	p.logger.Debug("cleaned up seen errors", "source", p.source, "remaining", remaining, "docs", len(p.seenDocs))
+}
+
+func (p *Poller) restoreCheckpoint() {
+	if p.checkpoints == nil {
+		return
+	}
+
+	cp, err := p.checkpoints.Load(p.checkpointName)
+	if err != nil {
+		p.logger.Error("failed to load checkpoint, starting fresh", "source", p.source, "error", err)
+		return
+	}
+	if cp == nil {
+		return
+	}
+
+	p.seen.Restore(cp.SeenErrors)
+
+	p.mu.Lock()
+	for key, ts := range cp.SeenEntries {
+		p.seenDocs[key] = ts
+	}
+	p.mu.Unlock()
+
+	p.lastPollEnd = cp.LastPollEnd
+	p.logger.Info("restored checkpoint", "source", p.source, "last_poll_end", cp.LastPollEnd)
+}
+
+func (p *Poller) saveCheckpoint() {
+	if p.checkpoints == nil || p.lastPollEnd.IsZero() {
+		return
+	}
+
+	p.mu.RLock()
+	cp := &loki.Checkpoint{
+		LastPollEnd: p.lastPollEnd,
+		SeenErrors:  p.seen.Snapshot(),
+		SeenEntries: loki.RecentEntries(p.seenDocs, p.lastPollEnd),
+		SavedAt:     time.Now(),
+	}
+	p.mu.RUnlock()
+
+	if err := p.checkpoints.Save(p.checkpointName, cp); err != nil {
+		p.logger.Error("failed to save checkpoint", "source", p.source, "error", err)
+	}
+}
+
+// lookupField resolves a dotted field name against a document, trying the
+// flattened key first and then walking nested objects
+func lookupField(doc map[string]interface{}, name string) interface{} {
+	if name == "" {
+		return nil
+	}
+	if v, ok := doc[name]; ok {
+		return v
+	}
+
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) < 2 {
+		return nil
+	}
+	nested, ok := doc[parts[0]].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return lookupField(nested, parts[1])
+}
+
+func stringField(doc map[string]interface{}, name string) string {
+	switch v := lookupField(doc, name).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseTimestamp accepts RFC 3339 strings and epoch milliseconds
+func parseTimestamp(v interface{}) (time.Time, bool) {
+	switch ts := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			ms, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return time.UnixMilli(ms), true
+		}
+		return t, true
+	case json.Number:
+		ms, err := ts.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.UnixMilli(ms), true
+	default:
+		return time.Time{}, false
+	}
+}
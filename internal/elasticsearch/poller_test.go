@@ -0,0 +1,366 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+// esStub serves _search requests from a fixed set of documents, applying
+// the timestamp range and search_after the way Elasticsearch does. The
+// query_string is ignored.
+type esStub struct {
+	mu       sync.Mutex
+	docs     []Hit
+	requests int
+}
+
+func (s *esStub) add(docs ...Hit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs = append(s.docs, docs...)
+}
+
+func (s *esStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/_search") {
+		http.NotFound(w, req)
+		return
+	}
+
+	var search struct {
+		Size  int `json:"size"`
+		Query struct {
+			Bool struct {
+				Filter []struct {
+					Range map[string]struct {
+						Gte string `json:"gte"`
+						Lt  string `json:"lt"`
+					} `json:"range"`
+				} `json:"filter"`
+			} `json:"bool"`
+		} `json:"query"`
+		SearchAfter []int64 `json:"search_after"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&search); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r := search.Query.Bool.Filter[0].Range["@timestamp"]
+	gte, _ := time.Parse(time.RFC3339Nano, r.Gte)
+	lt, _ := time.Parse(time.RFC3339Nano, r.Lt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	// Documents are kept in timestamp order, so the position breaks ties
+	// like _doc
+	hits := []Hit{}
+	for i, doc := range s.docs {
+		ts, ok := parseTimestamp(doc.Source["@timestamp"])
+		if ok && (ts.Before(gte) || !ts.Before(lt)) {
+			continue
+		}
+		sort := []int64{ts.UnixMilli(), int64(i)}
+		if len(search.SearchAfter) == 2 && (sort[0] < search.SearchAfter[0] ||
+			sort[0] == search.SearchAfter[0] && sort[1] <= search.SearchAfter[1]) {
+			continue
+		}
+		if len(hits) == search.Size {
+			break
+		}
+		hit := doc
+		hit.Sort = []interface{}{sort[0], sort[1]}
+		hits = append(hits, hit)
+	}
+
+	var resp SearchResponse
+	resp.Hits.Hits = hits
+	json.NewEncoder(w).Encode(resp)
+}
+
+// doc builds a document in the Fluent Bit kubernetes layout
+func doc(id string, ts time.Time, message string) Hit {
+	return Hit{
+		Index: "logs-2024.01.01",
+		ID:    id,
+		Source: map[string]interface{}{
+			"@timestamp": ts.UTC().Format(time.RFC3339Nano),
+			"message":    message,
+			"kubernetes": map[string]interface{}{
+				"namespace_name": "shop",
+				"pod_name":       "checkout-7d9f8b6c5d-abcde",
+				"container_name": "app",
+				"labels":         map[string]interface{}{"app": "checkout"},
+			},
+		},
+	}
+}
+
+// collector records every error handed to it
+type collector struct {
+	mu     sync.Mutex
+	errors []loki.ParsedError
+}
+
+func (c *collector) handle(errors []loki.ParsedError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors = append(c.errors, errors...)
+}
+
+func (c *collector) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var messages []string
+	for _, e := range c.errors {
+		messages = append(messages, e.Message)
+	}
+	return messages
+}
+
+func newTestPoller(url string, handler loki.ErrorHandler, opts ...PollerOption) *Poller {
+	opts = append([]PollerOption{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)
+	return NewPoller(NewClient(url), "logs-*", "level:error", time.Minute, 5*time.Minute, handler, opts...)
+}
+
+func TestPollerPagination(t *testing.T) {
+	base := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	docs := func(timestamps ...int) []Hit {
+		var hits []Hit
+		for i, s := range timestamps {
+			hits = append(hits, doc(strconv.Itoa(i), base.Add(time.Duration(s)*time.Second), "error "+strconv.Itoa(i)))
+		}
+		return hits
+	}
+
+	tests := []struct {
+		name         string
+		docs         []Hit
+		pageSize     int
+		maxPages     int
+		polls        int
+		wantRequests int
+	}{
+		{
+			name:         "single page",
+			docs:         docs(0, 1, 2),
+			pageSize:     5,
+			maxPages:     10,
+			polls:        1,
+			wantRequests: 1,
+		},
+		{
+			name:         "pages across timestamps",
+			docs:         docs(0, 1, 2, 3, 4),
+			pageSize:     2,
+			maxPages:     10,
+			polls:        1,
+			wantRequests: 3,
+		},
+		{
+			name:         "shared timestamps are paged by _doc",
+			docs:         docs(0, 0, 0, 0, 0, 1),
+			pageSize:     2,
+			maxPages:     10,
+			polls:        1,
+			wantRequests: 4,
+		},
+		{
+			name:         "max pages resumes on the next poll",
+			docs:         docs(0, 1, 2, 3, 4),
+			pageSize:     2,
+			maxPages:     1,
+			polls:        4,
+			wantRequests: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &esStub{}
+			stub.add(tt.docs...)
+			srv := httptest.NewServer(stub)
+			defer srv.Close()
+
+			c := &collector{}
+			p := newTestPoller(srv.URL, c.handle, WithPageSize(tt.pageSize), WithMaxPages(tt.maxPages))
+			for i := 0; i < tt.polls; i++ {
+				if err := p.poll(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var want []string
+			for _, d := range tt.docs {
+				want = append(want, d.Source["message"].(string))
+			}
+			if got := c.messages(); !reflect.DeepEqual(got, want) {
+				t.Errorf("handled %q, want each document once: %q", got, want)
+			}
+			if stub.requests != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", stub.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestPollerDedup(t *testing.T) {
+	base := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	stub := &esStub{}
+	stub.add(
+		doc("a", base, "error: connection refused"),
+		doc("b", base.Add(time.Second), "error: connection refused"),
+		doc("c", base.Add(2*time.Second), "error: disk full"),
+	)
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	c := &collector{}
+	p := newTestPoller(srv.URL, c.handle)
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// An overlapping window returns the same documents again
+	p.lastPollEnd = base
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.errors) != 3 {
+		t.Fatalf("handled %d errors, want 3: documents must not be handled twice", len(c.errors))
+	}
+	wantRepeat := []bool{false, true, false}
+	for i, e := range c.errors {
+		if e.Repeat != wantRepeat[i] {
+			t.Errorf("%s Repeat = %v, want %v", e.Message, e.Repeat, wantRepeat[i])
+		}
+	}
+	if c.errors[0].Fingerprint != c.errors[1].Fingerprint {
+		t.Error("the same message from one workload got different fingerprints")
+	}
+
+	first := c.errors[0]
+	if first.Namespace != "shop" || first.Pod != "checkout-7d9f8b6c5d-abcde" || first.Container != "app" || first.Workload != "checkout" {
+		t.Errorf("got %s/%s/%s workload %s, want the kubernetes fields mapped", first.Namespace, first.Pod, first.Container, first.Workload)
+	}
+	if first.Labels["app"] != "checkout" || first.Labels["index"] != "logs-2024.01.01" {
+		t.Errorf("Labels = %v, want the kubernetes labels and index", first.Labels)
+	}
+}
+
+func TestPollerCheckpoint(t *testing.T) {
+	base := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	stub := &esStub{}
+	stub.add(
+		doc("a", base, "error: connection refused"),
+		doc("b", base.Add(time.Second), "error: disk full"),
+	)
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	store := loki.NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+
+	first := &collector{}
+	p := newTestPoller(srv.URL, first.handle, WithCheckpoint(store, "es"))
+	p.restoreCheckpoint()
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// A poll cut off by max pages resumes from the last timestamp it
+	// fetched, so only the document IDs from there on are saved
+	p.lastPollEnd = base.Add(time.Second)
+	p.saveCheckpoint()
+
+	stub.add(
+		doc("c", base.Add(2*time.Second), "error: connection refused"),
+		doc("d", base.Add(3*time.Second), "error: timeout"),
+	)
+
+	second := &collector{}
+	p = newTestPoller(srv.URL, second.handle, WithCheckpoint(store, "es"))
+	p.restoreCheckpoint()
+	if !p.lastPollEnd.Equal(base.Add(time.Second)) {
+		t.Fatalf("restored watermark %v, want %v", p.lastPollEnd, base.Add(time.Second))
+	}
+
+	// The hit at the watermark is fetched again; its restored ID drops it
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := second.messages(), []string{"error: connection refused", "error: timeout"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("handled %q after restore, want %q", got, want)
+	}
+	if !second.errors[0].Repeat || second.errors[1].Repeat {
+		t.Errorf("Repeat = %v, %v; want the restored fingerprint to mark a repeat", second.errors[0].Repeat, second.errors[1].Repeat)
+	}
+}
+
+func TestLookupField(t *testing.T) {
+	doc := map[string]interface{}{
+		"kubernetes.pod_name": "flat",
+		"kubernetes": map[string]interface{}{
+			"namespace_name": "nested",
+			"labels":         map[string]interface{}{"app": "web"},
+		},
+		"status": json.Number("500"),
+	}
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"kubernetes.pod_name", "flat"},
+		{"kubernetes.namespace_name", "nested"},
+		{"kubernetes.labels.app", "web"},
+		{"status", "500"},
+		{"kubernetes.missing", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := stringField(doc, tt.field); got != tt.want {
+				t.Errorf("stringField(%q) = %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		want   time.Time
+		wantOK bool
+	}{
+		{"rfc3339", "2024-01-02T03:04:05.123456789Z", time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC), true},
+		{"epoch millis string", "1704164645123", time.UnixMilli(1704164645123), true},
+		{"epoch millis number", json.Number("1704164645123"), time.UnixMilli(1704164645123), true},
+		{"invalid", "yesterday", time.Time{}, false},
+		{"missing", nil, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseTimestamp(tt.value)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("parseTimestamp(%v) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
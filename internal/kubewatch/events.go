@@ -0,0 +1,305 @@
+package kubewatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EventWatcher turns Kubernetes Warning events into parsed errors
+type EventWatcher struct {
+	source    string
+	client    kubernetes.Interface
+	namespace string
+	lookback  time.Duration
+	resync    time.Duration
+	handler   loki.ErrorHandler
+	logger    *slog.Logger
+
+	fingerprint loki.FingerprintConfig
+
+	// Deduplication
+	seen       loki.Dedup
+	windowSize time.Duration
+
+	// Last reported count per event, so updates only emit new occurrences
+	mu     sync.Mutex
+	counts map[types.UID]int32
+}
+
+// EventWatcherOption configures an EventWatcher
+type EventWatcherOption func(*EventWatcher)
+
+// WithEventSource sets the source name used to tag errors
+func WithEventSource(name string) EventWatcherOption {
+	return func(w *EventWatcher) {
+		w.source = name
+	}
+}
+
+// WithEventNamespace restricts the watch to a single namespace
+func WithEventNamespace(namespace string) EventWatcherOption {
+	return func(w *EventWatcher) {
+		w.namespace = namespace
+	}
+}
+
+// WithEventLookback sets how old an event may be when first seen on startup
+func WithEventLookback(d time.Duration) EventWatcherOption {
+	return func(w *EventWatcher) {
+		w.lookback = d
+	}
+}
+
+// WithEventLogger sets the logger for the watcher
+func WithEventLogger(logger *slog.Logger) EventWatcherOption {
+	return func(w *EventWatcher) {
+		w.logger = logger
+	}
+}
+
+// WithEventFingerprint sets how errors are grouped into fingerprints
+func WithEventFingerprint(cfg loki.FingerprintConfig) EventWatcherOption {
+	return func(w *EventWatcher) {
+		w.fingerprint = cfg
+	}
+}
+
+// WithEventWindowSize sets the deduplication window size
+func WithEventWindowSize(d time.Duration) EventWatcherOption {
+	return func(w *EventWatcher) {
+		w.windowSize = d
+	}
+}
+
+// NewEventWatcher creates a new Warning event watcher
+func NewEventWatcher(client kubernetes.Interface, handler loki.ErrorHandler, opts ...EventWatcherOption) *EventWatcher {
+	w := &EventWatcher{
+		source:     "kubernetes-events",
+		client:     client,
+		lookback:   5 * time.Minute,
+		resync:     10 * time.Minute,
+		windowSize: 30 * time.Minute,
+		handler:    handler,
+		logger:     slog.Default(),
+		counts:     make(map[types.UID]int32),
+
+		fingerprint: loki.DefaultFingerprintConfig(),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Name returns the source name the watcher tags errors with
+func (w *EventWatcher) Name() string {
+	return w.source
+}
+
+// Start runs the informer until ctx is cancelled
+func (w *EventWatcher) Start(ctx context.Context) error {
+	w.logger.Info("starting kubernetes event watcher",
+		"source", w.source,
+		"namespace", w.namespace,
+		"lookback", w.lookback,
+	)
+
+	factory := informers.NewSharedInformerFactoryWithOptions(w.client, w.resync,
+		informers.WithNamespace(w.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = "type=" + corev1.EventTypeWarning
+		}),
+	)
+
+	informer := factory.Core().V1().Events().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if event, ok := obj.(*corev1.Event); ok {
+				w.handleEvent(event)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if event, ok := obj.(*corev1.Event); ok {
+				w.handleEvent(event)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if event, ok := obj.(*corev1.Event); ok {
+				w.mu.Lock()
+				delete(w.counts, event.UID)
+				w.mu.Unlock()
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("registering event handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return ctx.Err()
+	}
+	w.logger.Info("kubernetes event watcher synced", "source", w.source)
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			factory.Shutdown()
+			w.logger.Info("stopping kubernetes event watcher", "source", w.source)
+			return ctx.Err()
+		case <-ticker.C:
+			remaining := w.seen.Cleanup(time.Now().Add(-w.windowSize))
+			w.logger.Debug("cleaned up seen errors", "source", w.source, "remaining", remaining)
+		}
+	}
+}
+
+// handleEvent emits an error for new occurrences of a Warning event,
+// standing for as many occurrences as its count increased by. Occurrences
+// of a fingerprint already reported within the dedup window are marked as
+// repeats.
+func (w *EventWatcher) handleEvent(event *corev1.Event) {
+	if event.Type != corev1.EventTypeWarning {
+		return
+	}
+
+	count := eventCount(event)
+
+	w.mu.Lock()
+	last, seen := w.counts[event.UID]
+	w.counts[event.UID] = count
+	w.mu.Unlock()
+
+	if seen && count <= last {
+		return
+	}
+
+	// Skip history replayed by the initial list
+	ts := eventTime(event)
+	if !seen && time.Since(ts) > w.lookback {
+		return
+	}
+
+	parsed := w.parseEvent(event, ts, count)
+	parsed.Occurrences = int(count)
+	if seen {
+		parsed.Occurrences = int(count - last)
+	}
+
+	errors := []loki.ParsedError{*parsed}
+	w.seen.Mark(errors, time.Now())
+	w.handler(errors)
+}
+
+func (w *EventWatcher) parseEvent(event *corev1.Event, ts time.Time, count int32) *loki.ParsedError {
+	obj := event.InvolvedObject
+
+	namespace := obj.Namespace
+	if namespace == "" {
+		namespace = event.Namespace
+	}
+
+	labels := map[string]string{
+		"namespace": namespace,
+		"kind":      obj.Kind,
+		"name":      obj.Name,
+		"reason":    event.Reason,
+	}
+	if obj.Kind == "Pod" {
+		labels["pod"] = obj.Name
+		if container := containerFromFieldPath(obj.FieldPath); container != "" {
+			labels["container"] = container
+		}
+	}
+
+	parsed := loki.NewParsedError(w.source, loki.LogEntry{
+		Timestamp: ts,
+		Labels:    labels,
+		Line:      event.Message,
+	})
+
+	// Event messages are already human readable, so keep them verbatim
+	// rather than letting log line extraction trim them
+	parsed.Message = event.Message
+	parsed.Workload = w.fingerprint.Workload(labels["pod"])
+	parsed.Fingerprint = w.fingerprint.Fingerprint(namespace, labels["pod"], labels["container"],
+		fmt.Sprintf("%s %s %s", obj.Kind, event.Reason, event.Message))
+	parsed.Raw = fmt.Sprintf("%s %s %s/%s: %s", event.Type, event.Reason, obj.Kind, obj.Name, event.Message)
+	parsed.Fields = map[string]string{
+		"kind":      obj.Kind,
+		"name":      obj.Name,
+		"namespace": namespace,
+		"reason":    event.Reason,
+		"count":     strconv.Itoa(int(count)),
+	}
+	if event.Source.Component != "" {
+		parsed.Fields["component"] = event.Source.Component
+	} else if event.ReportingController != "" {
+		parsed.Fields["component"] = event.ReportingController
+	}
+	if event.Source.Host != "" {
+		parsed.Fields["host"] = event.Source.Host
+	}
+	if obj.FieldPath != "" {
+		parsed.Fields["field_path"] = obj.FieldPath
+	}
+
+	return parsed
+}
+
+// eventCount returns how many times the event has occurred
+func eventCount(event *corev1.Event) int32 {
+	if event.Series != nil && event.Series.Count > 0 {
+		return event.Series.Count
+	}
+	if event.Count > 0 {
+		return event.Count
+	}
+	return 1
+}
+
+// eventTime returns when the event was last observed
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// containerFromFieldPath extracts the container name from paths like
+// spec.containers{app}
+func containerFromFieldPath(fieldPath string) string {
+	start := strings.Index(fieldPath, "{")
+	end := strings.LastIndex(fieldPath, "}")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return fieldPath[start+1 : end]
+}
@@ -0,0 +1,237 @@
+package kubewatch
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// collector records every error handed to it
+type collector struct {
+	errors []loki.ParsedError
+}
+
+func (c *collector) handle(errors []loki.ParsedError) {
+	c.errors = append(c.errors, errors...)
+}
+
+func (c *collector) repeats() []bool {
+	var repeats []bool
+	for _, e := range c.errors {
+		repeats = append(repeats, e.Repeat)
+	}
+	return repeats
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func warningEvent(uid, pod string, count int32) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid), Namespace: "shop"},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: "shop",
+			Name:      pod,
+			FieldPath: "spec.containers{app}",
+		},
+		Type:          corev1.EventTypeWarning,
+		Reason:        "BackOff",
+		Message:       "Back-off restarting failed container",
+		Count:         count,
+		LastTimestamp: metav1.Now(),
+	}
+}
+
+func TestEventWatcherRepeats(t *testing.T) {
+	tests := []struct {
+		name            string
+		events          []*corev1.Event
+		want            []bool
+		wantOccurrences []int
+	}{
+		{
+			name:            "count increases",
+			events:          []*corev1.Event{warningEvent("u1", "web-1", 1), warningEvent("u1", "web-1", 2), warningEvent("u1", "web-1", 3)},
+			want:            []bool{false, true, true},
+			wantOccurrences: []int{1, 1, 1},
+		},
+		{
+			name:            "count jumps",
+			events:          []*corev1.Event{warningEvent("u1", "web-1", 2), warningEvent("u1", "web-1", 7)},
+			want:            []bool{false, true},
+			wantOccurrences: []int{2, 5},
+		},
+		{
+			name:            "unchanged count is skipped",
+			events:          []*corev1.Event{warningEvent("u1", "web-1", 1), warningEvent("u1", "web-1", 1)},
+			want:            []bool{false},
+			wantOccurrences: []int{1},
+		},
+		{
+			name:            "same failure in a new event",
+			events:          []*corev1.Event{warningEvent("u1", "web-1", 1), warningEvent("u2", "web-1", 1)},
+			want:            []bool{false, true},
+			wantOccurrences: []int{1, 1},
+		},
+		{
+			name:            "different pods",
+			events:          []*corev1.Event{warningEvent("u1", "web-1", 1), warningEvent("u2", "api-1", 1)},
+			want:            []bool{false, false},
+			wantOccurrences: []int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &collector{}
+			w := NewEventWatcher(nil, c.handle, WithEventLogger(discardLogger()))
+			for _, event := range tt.events {
+				w.handleEvent(event)
+			}
+
+			if got := c.repeats(); !slices.Equal(got, tt.want) {
+				t.Errorf("repeats = %v, want %v", got, tt.want)
+			}
+			var occurrences []int
+			for _, e := range c.errors {
+				occurrences = append(occurrences, e.Occurrences)
+			}
+			if !slices.Equal(occurrences, tt.wantOccurrences) {
+				t.Errorf("occurrences = %v, want %v", occurrences, tt.wantOccurrences)
+			}
+		})
+	}
+}
+
+func crashingPod(restarts int32, waiting string) *corev1.Pod {
+	status := corev1.ContainerStatus{
+		Name:         "app",
+		RestartCount: restarts,
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				Reason:     "Error",
+				ExitCode:   1,
+				FinishedAt: metav1.NewTime(time.Now().Add(-time.Hour)),
+			},
+		},
+	}
+	if waiting != "" {
+		status.State.Waiting = &corev1.ContainerStateWaiting{Reason: waiting}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{status}},
+	}
+}
+
+func TestPodWatcherRepeats(t *testing.T) {
+	tests := []struct {
+		name string
+		pods []*corev1.Pod
+		want []bool
+	}{
+		{
+			name: "repeated restarts",
+			pods: []*corev1.Pod{crashingPod(1, ""), crashingPod(2, ""), crashingPod(3, "")},
+			want: []bool{false, true},
+		},
+		{
+			name: "crash loop after restart",
+			pods: []*corev1.Pod{crashingPod(1, ""), crashingPod(2, "CrashLoopBackOff"), crashingPod(2, ""), crashingPod(3, "CrashLoopBackOff")},
+			want: []bool{false, false, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &collector{}
+			w := NewPodWatcher(nil, c.handle, WithPodLogger(discardLogger()))
+			var previous *corev1.Pod
+			for _, pod := range tt.pods {
+				w.handlePod(previous, pod)
+				previous = pod
+			}
+
+			if got := c.repeats(); !slices.Equal(got, tt.want) {
+				t.Errorf("repeats = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodWatcherTerminations(t *testing.T) {
+	// terminatedPod restarted after a termination that finished ago
+	terminatedPod := func(restarts int32, reason string, exitCode int32, ago time.Duration) *corev1.Pod {
+		pod := crashingPod(restarts, "")
+		last := pod.Status.ContainerStatuses[0].LastTerminationState.Terminated
+		last.Reason, last.ExitCode, last.FinishedAt = reason, exitCode, metav1.NewTime(time.Now().Add(-ago))
+		return pod
+	}
+
+	tests := []struct {
+		name     string
+		lookback time.Duration
+		pods     []*corev1.Pod
+		want     []string // reasons
+	}{
+		{
+			name: "restart after an error",
+			pods: []*corev1.Pod{terminatedPod(1, "Error", 1, time.Hour), terminatedPod(2, "Error", 1, time.Minute)},
+			want: []string{"Error"},
+		},
+		{
+			name: "restart after completing",
+			pods: []*corev1.Pod{terminatedPod(1, "Completed", 0, time.Hour), terminatedPod(2, "Completed", 0, time.Minute)},
+			want: nil,
+		},
+		{
+			name: "restart after exit code 0",
+			pods: []*corev1.Pod{terminatedPod(1, "Completed", 0, time.Hour), terminatedPod(2, "", 0, time.Minute)},
+			want: nil,
+		},
+		{
+			name: "termination within the default lookback on startup",
+			pods: []*corev1.Pod{terminatedPod(1, "OOMKilled", 137, 10*time.Minute)},
+			want: []string{"OOMKilled"},
+		},
+		{
+			name:     "termination before the lookback on startup",
+			lookback: 5 * time.Minute,
+			pods:     []*corev1.Pod{terminatedPod(1, "OOMKilled", 137, 10*time.Minute)},
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &collector{}
+			opts := []PodWatcherOption{WithPodLogger(discardLogger())}
+			if tt.lookback > 0 {
+				opts = append(opts, WithPodLookback(tt.lookback))
+			}
+			w := NewPodWatcher(nil, c.handle, opts...)
+			var previous *corev1.Pod
+			for _, pod := range tt.pods {
+				w.handlePod(previous, pod)
+				previous = pod
+			}
+
+			var reasons []string
+			for _, e := range c.errors {
+				reasons = append(reasons, e.Fields["reason"])
+			}
+			if !slices.Equal(reasons, tt.want) {
+				t.Errorf("reported %v, want %v", reasons, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package kubewatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// waitingReasons are container waiting states that indicate a failure
+var waitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+// PodWatcher turns failing container states into parsed errors
+type PodWatcher struct {
+	source    string
+	client    kubernetes.Interface
+	namespace string
+	lookback  time.Duration
+	resync    time.Duration
+	handler   loki.ErrorHandler
+	logger    *slog.Logger
+
+	fingerprint loki.FingerprintConfig
+
+	// Deduplication
+	seen       loki.Dedup
+	windowSize time.Duration
+}
+
+// PodWatcherOption configures a PodWatcher
+type PodWatcherOption func(*PodWatcher)
+
+// WithPodSource sets the source name used to tag errors
+func WithPodSource(name string) PodWatcherOption {
+	return func(w *PodWatcher) {
+		w.source = name
+	}
+}
+
+// WithPodNamespace restricts the watch to a single namespace
+func WithPodNamespace(namespace string) PodWatcherOption {
+	return func(w *PodWatcher) {
+		w.namespace = namespace
+	}
+}
+
+// WithPodLookback sets how old a termination may be when first seen on startup
+func WithPodLookback(d time.Duration) PodWatcherOption {
+	return func(w *PodWatcher) {
+		w.lookback = d
+	}
+}
+
+// WithPodLogger sets the logger for the watcher
+func WithPodLogger(logger *slog.Logger) PodWatcherOption {
+	return func(w *PodWatcher) {
+		w.logger = logger
+	}
+}
+
+// WithPodFingerprint sets how errors are grouped into fingerprints
+func WithPodFingerprint(cfg loki.FingerprintConfig) PodWatcherOption {
+	return func(w *PodWatcher) {
+		w.fingerprint = cfg
+	}
+}
+
+// WithPodWindowSize sets the deduplication window size
+func WithPodWindowSize(d time.Duration) PodWatcherOption {
+	return func(w *PodWatcher) {
+		w.windowSize = d
+	}
+}
+
+// NewPodWatcher creates a new container status watcher
+func NewPodWatcher(client kubernetes.Interface, handler loki.ErrorHandler, opts ...PodWatcherOption) *PodWatcher {
+	w := &PodWatcher{
+		source:     "kubernetes-pods",
+		client:     client,
+		lookback:   15 * time.Minute,
+		resync:     10 * time.Minute,
+		windowSize: 30 * time.Minute,
+		handler:    handler,
+		logger:     slog.Default(),
+
+		fingerprint: loki.DefaultFingerprintConfig(),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Name returns the source name the watcher tags errors with
+func (w *PodWatcher) Name() string {
+	return w.source
+}
+
+// Start runs the informer until ctx is cancelled
+func (w *PodWatcher) Start(ctx context.Context) error {
+	w.logger.Info("starting kubernetes pod watcher",
+		"source", w.source,
+		"namespace", w.namespace,
+		"lookback", w.lookback,
+	)
+
+	factory := informers.NewSharedInformerFactoryWithOptions(w.client, w.resync,
+		informers.WithNamespace(w.namespace),
+	)
+
+	informer := factory.Core().V1().Pods().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				w.handlePod(nil, pod)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			if pod, ok := newObj.(*corev1.Pod); ok {
+				w.handlePod(oldPod, pod)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("registering pod handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return ctx.Err()
+	}
+	w.logger.Info("kubernetes pod watcher synced", "source", w.source)
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			factory.Shutdown()
+			w.logger.Info("stopping kubernetes pod watcher", "source", w.source)
+			return ctx.Err()
+		case <-ticker.C:
+			remaining := w.seen.Cleanup(time.Now().Add(-w.windowSize))
+			w.logger.Debug("cleaned up seen errors", "source", w.source, "remaining", remaining)
+		}
+	}
+}
+
+// handlePod compares container statuses against the previous version of
+// the pod and emits an error for each transition into a failure state.
+// oldPod is nil when the pod is first seen. Failures already reported
+// within the dedup window are marked as repeats.
+func (w *PodWatcher) handlePod(oldPod, pod *corev1.Pod) {
+	previous := make(map[string]corev1.ContainerStatus)
+	if oldPod != nil {
+		for _, cs := range allContainerStatuses(oldPod) {
+			previous[cs.Name] = cs
+		}
+	}
+
+	var errors []loki.ParsedError
+	for _, cs := range allContainerStatuses(pod) {
+		prev, hadPrev := previous[cs.Name]
+
+		// Waiting in a failure state, e.g. CrashLoopBackOff
+		if waiting := cs.State.Waiting; waiting != nil && waitingReasons[waiting.Reason] {
+			if !hadPrev || prev.State.Waiting == nil || prev.State.Waiting.Reason != waiting.Reason {
+				msg := fmt.Sprintf("Container %s is waiting: %s", cs.Name, waiting.Reason)
+				if waiting.Message != "" {
+					msg += ": " + waiting.Message
+				}
+				errors = append(errors, *w.newError(pod, cs, "waiting", waiting.Reason, msg, time.Now(), nil))
+			}
+		}
+
+		// Restarted since the last update; report why it last terminated,
+		// unless it exited cleanly, e.g. a sidecar that completed
+		if hadPrev && cs.RestartCount > prev.RestartCount && !exitedCleanly(cs.LastTerminationState.Terminated) {
+			reason := "Unknown"
+			msg := fmt.Sprintf("Container %s restarted (restart count %d)", cs.Name, cs.RestartCount)
+			var terminated *corev1.ContainerStateTerminated
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				terminated = t
+				reason = t.Reason
+				msg += fmt.Sprintf(": last terminated with %s (exit code %d)", t.Reason, t.ExitCode)
+			}
+			errors = append(errors, *w.newError(pod, cs, "restarted", reason, msg, time.Now(), terminated))
+		}
+
+		// A recent termination on startup, which has no previous state to
+		// compare restart counts against
+		if !hadPrev {
+			if t := cs.LastTerminationState.Terminated; t != nil && isFailure(t) && time.Since(t.FinishedAt.Time) <= w.lookback {
+				msg := fmt.Sprintf("Container %s restarted (restart count %d): last terminated with %s (exit code %d)",
+					cs.Name, cs.RestartCount, t.Reason, t.ExitCode)
+				errors = append(errors, *w.newError(pod, cs, "restarted", t.Reason, msg, t.FinishedAt.Time, t))
+			}
+		}
+
+		// Terminated and not restarted, e.g. restartPolicy Never
+		if t := cs.State.Terminated; t != nil && isFailure(t) {
+			if (hadPrev && prev.State.Terminated == nil) || (!hadPrev && time.Since(t.FinishedAt.Time) <= w.lookback) {
+				msg := fmt.Sprintf("Container %s terminated with %s (exit code %d)", cs.Name, t.Reason, t.ExitCode)
+				errors = append(errors, *w.newError(pod, cs, "terminated", t.Reason, msg, t.FinishedAt.Time, t))
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		newCount := w.seen.Mark(errors, time.Now())
+		w.logger.Debug("detected container failures", "source", w.source, "pod", pod.Namespace+"/"+pod.Name, "count", len(errors), "repeats", len(errors)-newCount)
+		w.handler(errors)
+	}
+}
+
+func (w *PodWatcher) newError(pod *corev1.Pod, cs corev1.ContainerStatus, state, reason, msg string, ts time.Time, terminated *corev1.ContainerStateTerminated) *loki.ParsedError {
+	labels := map[string]string{
+		"namespace": pod.Namespace,
+		"pod":       pod.Name,
+		"container": cs.Name,
+		"reason":    reason,
+	}
+	for k, v := range pod.Labels {
+		if _, exists := labels[k]; !exists {
+			labels[k] = v
+		}
+	}
+
+	parsed := loki.NewParsedError(w.source, loki.LogEntry{
+		Timestamp: ts,
+		Labels:    labels,
+		Line:      msg,
+	})
+
+	// Fingerprint on the reason rather than the message so restart counts
+	// and exit details don't split the group
+	parsed.Message = msg
+	parsed.Workload = w.fingerprint.Workload(pod.Name)
+	parsed.Fingerprint = w.fingerprint.Fingerprint(pod.Namespace, pod.Name, cs.Name, "Pod "+state+" "+reason)
+	parsed.Fields = map[string]string{
+		"kind":          "Pod",
+		"name":          pod.Name,
+		"namespace":     pod.Namespace,
+		"container":     cs.Name,
+		"state":         state,
+		"reason":        reason,
+		"restart_count": strconv.Itoa(int(cs.RestartCount)),
+	}
+	if cs.Image != "" {
+		parsed.Fields["image"] = cs.Image
+	}
+	if pod.Spec.NodeName != "" {
+		parsed.Fields["node"] = pod.Spec.NodeName
+	}
+	if terminated != nil {
+		parsed.Fields["exit_code"] = strconv.Itoa(int(terminated.ExitCode))
+		if terminated.Signal != 0 {
+			parsed.Fields["signal"] = strconv.Itoa(int(terminated.Signal))
+		}
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			parsed.Fields["owner_kind"] = ref.Kind
+			parsed.Fields["owner_name"] = ref.Name
+		}
+	}
+
+	return parsed
+}
+
+// allContainerStatuses returns init and app container statuses together
+func allContainerStatuses(pod *corev1.Pod) []corev1.ContainerStatus {
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	return statuses
+}
+
+// exitedCleanly reports whether a known termination was not a failure
+func exitedCleanly(t *corev1.ContainerStateTerminated) bool {
+	return t != nil && !isFailure(t)
+}
+
+// isFailure reports whether a termination was abnormal
+func isFailure(t *corev1.ContainerStateTerminated) bool {
+	return t.Reason == "OOMKilled" || t.Reason == "Error" || t.ExitCode != 0
+}
@@ -0,0 +1,153 @@
+package loki
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting Loki while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("loki circuit breaker is open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops requests to Loki after consecutive failures so
+// sources fail fast instead of piling up timeouts. After OpenTimeout a
+// single probe request is let through; its success closes the circuit and
+// its failure opens it again. Clients for the same Loki share a breaker.
+type CircuitBreaker struct {
+	mu sync.Mutex
+
+	threshold   int
+	openTimeout time.Duration
+
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+	now       func() time.Time
+}
+
+// CircuitStats is a snapshot of the breaker for the dashboard and health endpoints
+type CircuitStats struct {
+	State     string    `json:"state"`
+	Failures  int       `json:"failures"`
+	OpenedAt  time.Time `json:"opened_at"`
+	RetryAt   time.Time `json:"retry_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// NewCircuitBreaker creates a breaker that opens after threshold
+// consecutive failures and probes again after openTimeout
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	circuitOpen.Set(0)
+	return &CircuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       CircuitClosed,
+		now:         time.Now,
+	}
+}
+
+// allow reports whether a request may be sent
+func (b *CircuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return nil
+
+	case CircuitHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+
+	return nil
+}
+
+// success records a request that reached a healthy Loki
+func (b *CircuitBreaker) success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+	circuitOpen.Set(0)
+}
+
+// failure records a request that failed after all retries
+func (b *CircuitBreaker) failure(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastError = err.Error()
+	b.probing = false
+
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		if b.state != CircuitOpen {
+			circuitTrips.Inc()
+		}
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+		circuitOpen.Set(1)
+	}
+}
+
+// abort releases a probe whose request was cancelled before Loki answered
+func (b *CircuitBreaker) abort() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Stats returns the current breaker state
+func (b *CircuitBreaker) Stats() CircuitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := CircuitStats{
+		State:     b.state,
+		Failures:  b.failures,
+		LastError: b.lastError,
+	}
+	if b.state != CircuitClosed {
+		stats.OpenedAt = b.openedAt
+		stats.RetryAt = b.openedAt.Add(b.openTimeout)
+	}
+	return stats
+}
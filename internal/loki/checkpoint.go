@@ -0,0 +1,211 @@
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Checkpoint captures poller progress so a restart neither misses nor replays logs
+type Checkpoint struct {
+	LastPollEnd time.Time            `json:"last_poll_end"`
+	SeenErrors  map[string]time.Time `json:"seen_errors"`
+	SeenEntries map[string]time.Time `json:"seen_entries"`
+	SavedAt     time.Time            `json:"saved_at"`
+}
+
+// CheckpointStore persists poller checkpoints by name
+type CheckpointStore interface {
+	// Load returns the named checkpoint, or nil if none has been saved
+	Load(name string) (*Checkpoint, error)
+	Save(name string, cp *Checkpoint) error
+}
+
+// maxCheckpointEntries bounds the entry hashes saved with a checkpoint
+const maxCheckpointEntries = 10000
+
+// RecentEntries returns the entry hashes of seen that a poll resuming from
+// watermark can fetch again. Polls resume from the watermark inclusively,
+// so only entries at or after it are kept, at most maxCheckpointEntries
+// of them, closest to the watermark first.
+func RecentEntries(seen map[string]time.Time, watermark time.Time) map[string]time.Time {
+	keys := make([]string, 0)
+	for key, ts := range seen {
+		if !ts.Before(watermark) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > maxCheckpointEntries {
+		sort.Slice(keys, func(i, j int) bool { return seen[keys[i]].Before(seen[keys[j]]) })
+		keys = keys[:maxCheckpointEntries]
+	}
+
+	recent := make(map[string]time.Time, len(keys))
+	for _, key := range keys {
+		recent[key] = seen[key]
+	}
+	return recent
+}
+
+// sameState reports whether two checkpoints hold the same watermark and
+// dedup state
+func (cp *Checkpoint) sameState(other *Checkpoint) bool {
+	return cp.LastPollEnd.Equal(other.LastPollEnd) &&
+		maps.EqualFunc(cp.SeenErrors, other.SeenErrors, time.Time.Equal) &&
+		maps.EqualFunc(cp.SeenEntries, other.SeenEntries, time.Time.Equal)
+}
+
+// FileCheckpointStore keeps checkpoints in a single JSON file. The file is
+// read once and only rewritten when a checkpoint's state changes.
+type FileCheckpointStore struct {
+	mu   sync.Mutex
+	path string
+	all  map[string]*Checkpoint // nil until the file is read
+}
+
+// NewFileCheckpointStore creates a checkpoint store backed by the file at path
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load reads the named checkpoint from disk
+func (s *FileCheckpointStore) Load(name string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return all[name], nil
+}
+
+// Save writes the named checkpoint, replacing the file atomically. Nothing
+// is written if the checkpoint holds the same state as the saved one.
+func (s *FileCheckpointStore) Save(name string, cp *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, err := s.read()
+	if err != nil {
+		return err
+	}
+	if prev := saved[name]; prev != nil && prev.sameState(cp) {
+		return nil
+	}
+	all := maps.Clone(saved)
+	all[name] = cp
+
+	data, err := json.Marshal(all)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating checkpoint file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing checkpoint file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing checkpoint file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing checkpoint file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replacing checkpoint file: %w", err)
+	}
+	s.all = all
+	return nil
+}
+
+// read returns the saved checkpoints, reading the file on first use
+func (s *FileCheckpointStore) read() (map[string]*Checkpoint, error) {
+	if s.all != nil {
+		return s.all, nil
+	}
+	all := make(map[string]*Checkpoint)
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.all = all
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading checkpoint file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint file: %w", err)
+	}
+	s.all = all
+	return all, nil
+}
+
+// restoreCheckpoint loads the poller state saved by a previous run
+func (p *Poller) restoreCheckpoint() {
+	if p.checkpoints == nil {
+		return
+	}
+
+	cp, err := p.checkpoints.Load(p.checkpointName)
+	if err != nil {
+		p.logger.Error("failed to load checkpoint, starting fresh", "error", err)
+		return
+	}
+	if cp == nil {
+		p.logger.Info("no checkpoint found, starting from lookback window", "name", p.checkpointName)
+		return
+	}
+
+	p.seen.Restore(cp.SeenErrors)
+
+	p.mu.Lock()
+	for key, ts := range cp.SeenEntries {
+		p.seenEntries[key] = ts
+	}
+	p.mu.Unlock()
+
+	p.lastPollEnd = cp.LastPollEnd
+	p.cleanupSeenErrors()
+
+	p.logger.Info("restored checkpoint",
+		"name", p.checkpointName,
+		"last_poll_end", cp.LastPollEnd,
+		"seen_errors", len(cp.SeenErrors),
+		"seen_entries", len(cp.SeenEntries),
+	)
+}
+
+// saveCheckpoint persists the current watermark, the dedup state and the
+// entry hashes a resumed poll can fetch again
+func (p *Poller) saveCheckpoint() {
+	if p.checkpoints == nil || p.lastPollEnd.IsZero() {
+		return
+	}
+
+	p.mu.RLock()
+	cp := &Checkpoint{
+		LastPollEnd: p.lastPollEnd,
+		SeenErrors:  p.seen.Snapshot(),
+		SeenEntries: RecentEntries(p.seenEntries, p.lastPollEnd),
+		SavedAt:     time.Now(),
+	}
+	p.mu.RUnlock()
+
+	if err := p.checkpoints.Save(p.checkpointName, cp); err != nil {
+		p.logger.Error("failed to save checkpoint", "error", err)
+	}
+}
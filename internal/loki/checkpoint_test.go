@@ -0,0 +1,76 @@
+package loki
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecentEntries(t *testing.T) {
+	watermark := time.Now()
+	seen := map[string]time.Time{
+		"before": watermark.Add(-time.Second),
+		"at":     watermark,
+		"after":  watermark.Add(time.Second),
+	}
+	recent := RecentEntries(seen, watermark)
+	if _, ok := recent["before"]; ok || len(recent) != 2 {
+		t.Errorf("RecentEntries = %v, want the entries at and after the watermark", recent)
+	}
+
+	// Past the cap the entries closest to the watermark are kept
+	seen = make(map[string]time.Time)
+	for i := 0; i <= maxCheckpointEntries; i++ {
+		seen[strconv.Itoa(i)] = watermark.Add(time.Duration(i))
+	}
+	recent = RecentEntries(seen, watermark)
+	if len(recent) != maxCheckpointEntries {
+		t.Fatalf("kept %d entries, want %d", len(recent), maxCheckpointEntries)
+	}
+	if _, ok := recent[strconv.Itoa(maxCheckpointEntries)]; ok {
+		t.Error("kept the newest entry, want the oldest ones")
+	}
+}
+
+func TestFileCheckpointStoreSkipsUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	store := NewFileCheckpointStore(path)
+
+	watermark := time.Now()
+	checkpoint := func() *Checkpoint {
+		return &Checkpoint{
+			LastPollEnd: watermark,
+			SeenErrors:  map[string]time.Time{"fp": watermark},
+			SeenEntries: map[string]time.Time{"entry": watermark},
+			SavedAt:     time.Now(),
+		}
+	}
+	if err := store.Save("app", checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving the same state again must not rewrite the file
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("app", checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("unchanged checkpoint was written: %v", err)
+	}
+
+	watermark = watermark.Add(time.Second)
+	if err := store.Save("app", checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := NewFileCheckpointStore(path).Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp == nil || !cp.LastPollEnd.Equal(watermark) {
+		t.Fatalf("loaded %v, want the changed checkpoint", cp)
+	}
+}
@@ -2,22 +2,40 @@ package loki
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// TenantLabel is the label Loki adds to each stream of a multi-tenant
+// query naming the tenant it came from
+const TenantLabel = "__tenant_id__"
+
 // Client handles communication with Loki API
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	tlsConfig  *tls.Config
 	tenantID   string
 	username   string
 	password   string
+	token      string
+	tokenFile  *tokenFile
+
+	// Requests failing with 429, 5xx or a network error are retried
+	// maxRetries times, backing off from minBackoff up to maxBackoff
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	breaker    *CircuitBreaker
 }
 
 // ClientOption configures a Client
@@ -30,6 +48,15 @@ func WithTenantID(tenantID string) ClientOption {
 	}
 }
 
+// WithTenantIDs queries several tenants at once with a federated query.
+// Loki must run with multi-tenant queries enabled; errors are tagged with
+// the tenant of their stream.
+func WithTenantIDs(tenantIDs ...string) ClientOption {
+	return func(c *Client) {
+		c.tenantID = strings.Join(tenantIDs, "|")
+	}
+}
+
 // WithBasicAuth sets basic authentication credentials
 func WithBasicAuth(username, password string) ClientOption {
 	return func(c *Client) {
@@ -38,6 +65,55 @@ func WithBasicAuth(username, password string) ClientOption {
 	}
 }
 
+// WithBearerToken sets a static bearer token
+func WithBearerToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithBearerTokenFile reads the bearer token from a file, re-reading it
+// whenever the file changes
+func WithBearerTokenFile(path string) ClientOption {
+	return func(c *Client) {
+		c.tokenFile = &tokenFile{path: path}
+	}
+}
+
+// WithTLSConfig sets the TLS configuration for HTTPS and WebSocket
+// connections, see NewTLSConfig
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithTimeout sets the timeout of each request attempt
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithRetry retries requests that fail with 429, 5xx or a network error up
+// to maxRetries times, doubling the wait from minBackoff up to maxBackoff.
+// A Retry-After header replaces the computed wait; the request fails
+// instead when Loki asks to wait longer than maxBackoff.
+func WithRetry(maxRetries int, minBackoff, maxBackoff time.Duration) ClientOption {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithCircuitBreaker makes the client fail fast while the breaker is open
+func WithCircuitBreaker(b *CircuitBreaker) ClientOption {
+	return func(c *Client) {
+		c.breaker = b
+	}
+}
+
 // WithHTTPClient sets a custom HTTP client
 func WithHTTPClient(httpClient *http.Client) ClientOption {
 	return func(c *Client) {
@@ -58,95 +134,168 @@ func NewClient(baseURL string, opts ...ClientOption) *Client {
 		opt(c)
 	}
 
+	// Copy the HTTP client rather than changing one passed by the caller
+	if c.tlsConfig != nil && c.httpClient.Transport == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = c.tlsConfig
+		httpClient := *c.httpClient
+		httpClient.Transport = transport
+		c.httpClient = &httpClient
+	}
+
 	return c
 }
 
 // QueryResponse represents the response from Loki query API
 type QueryResponse struct {
-	Status string     `json:"status"`
-	Data   QueryData  `json:"data"`
+	Status string    `json:"status"`
+	Data   QueryData `json:"data"`
 }
 
-// QueryData holds the result data from a query
+// QueryData holds the result data from a query. Result is decoded according
+// to ResultType: streams for log queries, vector or matrix for metric
+// queries.
 type QueryData struct {
-	ResultType string   `json:"resultType"`
-	Result     []Stream `json:"result"`
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
 }
 
+// Result types returned by Loki
+const (
+	ResultStreams = "streams"
+	ResultVector  = "vector"
+	ResultMatrix  = "matrix"
+	ResultScalar  = "scalar"
+)
+
 // Stream represents a log stream from Loki
 type Stream struct {
 	Stream map[string]string `json:"stream"`
 	Values [][]string        `json:"values"` // [timestamp_ns, log_line]
 }
 
+// Series is a metric query result. Vector results have a single sample.
+type Series struct {
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Sample is a single metric value
+type Sample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Last returns the most recent sample of the series
+func (s Series) Last() (Sample, bool) {
+	if len(s.Samples) == 0 {
+		return Sample{}, false
+	}
+	return s.Samples[len(s.Samples)-1], true
+}
+
 // LogEntry represents a parsed log entry
 type LogEntry struct {
 	Timestamp time.Time
 	Labels    map[string]string
 	Line      string
+
+	// Tenant is the Loki tenant the entry was read from or pushed by, if
+	// known
+	Tenant string
+
+	// Attributes holds key/value pairs a backend already stores alongside
+	// the line, such as document fields. They are mapped onto structured
+	// fields together with any parsed from the line.
+	Attributes map[string]string
 }
 
-// QueryRange executes a range query against Loki
+// Direction controls the order in which Loki returns entries
+type Direction string
+
+const (
+	DirectionForward  Direction = "forward"
+	DirectionBackward Direction = "backward"
+)
+
+// QueryRange executes a range query against Loki, newest entries first
 func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, limit int) ([]LogEntry, error) {
+	return c.QueryRangeDirection(ctx, query, start, end, limit, DirectionBackward)
+}
+
+// QueryRangeDirection executes a range query against Loki in the given direction.
+// Loki treats start as inclusive and end as exclusive.
+func (c *Client) QueryRangeDirection(ctx context.Context, query string, start, end time.Time, limit int, direction Direction) ([]LogEntry, error) {
 	params := url.Values{}
 	params.Set("query", query)
 	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
 	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
 	params.Set("limit", strconv.Itoa(limit))
-	params.Set("direction", "backward")
-
-	reqURL := fmt.Sprintf("%s/loki/api/v1/query_range?%s", c.baseURL, params.Encode())
+	params.Set("direction", string(direction))
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	data, err := c.query(ctx, "/loki/api/v1/query_range", params)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, err
 	}
+	entries, err := data.entries()
+	c.tagTenant(entries)
+	return entries, err
+}
 
-	c.setHeaders(req)
+// Query executes an instant query against Loki
+func (c *Client) Query(ctx context.Context, query string, at time.Time, limit int) ([]LogEntry, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatInt(at.UnixNano(), 10))
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("direction", "backward")
 
-	resp, err := c.httpClient.Do(req)
+	data, err := c.query(ctx, "/loki/api/v1/query", params)
 	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("loki returned status %d: %s", resp.StatusCode, string(body))
+		return nil, err
 	}
+	entries, err := data.entries()
+	c.tagTenant(entries)
+	return entries, err
+}
 
-	var queryResp QueryResponse
-	if err := json.NewDecoder(resp.Body).Decode(&queryResp); err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
-	}
+// QueryMetric executes an instant LogQL metric query such as
+// sum by (namespace) (rate({app="api"} |= "error" [5m])) at the given time
+func (c *Client) QueryMetric(ctx context.Context, query string, at time.Time) ([]Series, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatInt(at.UnixNano(), 10))
 
-	if queryResp.Status != "success" {
-		return nil, fmt.Errorf("query failed with status: %s", queryResp.Status)
+	data, err := c.query(ctx, "/loki/api/v1/query", params)
+	if err != nil {
+		return nil, err
 	}
-
-	return c.parseStreams(queryResp.Data.Result), nil
+	return data.Series()
 }
 
-// Query executes an instant query against Loki
-func (c *Client) Query(ctx context.Context, query string, at time.Time, limit int) ([]LogEntry, error) {
+// QueryMetricRange executes a LogQL metric query over [start, end]
+// evaluated every step
+func (c *Client) QueryMetricRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Series, error) {
 	params := url.Values{}
 	params.Set("query", query)
-	params.Set("time", strconv.FormatInt(at.UnixNano(), 10))
-	params.Set("limit", strconv.Itoa(limit))
-	params.Set("direction", "backward")
-
-	reqURL := fmt.Sprintf("%s/loki/api/v1/query?%s", c.baseURL, params.Encode())
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	data, err := c.query(ctx, "/loki/api/v1/query_range", params)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, err
 	}
+	return data.Series()
+}
 
-	c.setHeaders(req)
+// query performs a GET against a query endpoint and returns its data
+func (c *Client) query(ctx context.Context, path string, params url.Values) (*QueryData, error) {
+	reqURL := fmt.Sprintf("%s%s?%s", c.baseURL, path, params.Encode())
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, reqURL)
 	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -164,46 +313,266 @@ func (c *Client) Query(ctx context.Context, query string, at time.Time, limit in
 		return nil, fmt.Errorf("query failed with status: %s", queryResp.Status)
 	}
 
-	return c.parseStreams(queryResp.Data.Result), nil
+	return &queryResp.Data, nil
 }
 
 // Ready checks if Loki is ready to accept requests
 func (c *Client) Ready(ctx context.Context) error {
 	reqURL := fmt.Sprintf("%s/ready", c.baseURL)
 
+	resp, err := c.do(ctx, reqURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("loki not ready, status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// tenant returns the tenant the client queries, or "" for federated and
+// single-tenant setups
+func (c *Client) tenant() string {
+	if strings.Contains(c.tenantID, "|") {
+		return ""
+	}
+	return c.tenantID
+}
+
+// tagTenant sets the tenant of entries that don't name theirs in the
+// tenant label
+func (c *Client) tagTenant(entries []LogEntry) {
+	tenant := c.tenant()
+	if tenant == "" {
+		return
+	}
+	for i := range entries {
+		if entries[i].Tenant == "" {
+			entries[i].Tenant = tenant
+		}
+	}
+}
+
+// do sends a GET request through the circuit breaker, retrying 429 and
+// 5xx responses and network errors. Any other response is returned for the
+// caller to check; the caller closes its body.
+func (c *Client) do(ctx context.Context, reqURL string) (*http.Response, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	backoff := c.minBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, reqURL)
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			c.breaker.abort()
+			return nil, fmt.Errorf("executing request: %w", ctx.Err())
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			err = fmt.Errorf("loki returned status %d: %s", resp.StatusCode, string(body))
+			wait = retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		default:
+			c.breaker.success()
+			return resp, nil
+		}
+
+		if attempt >= c.maxRetries || wait > c.maxBackoff {
+			c.breaker.failure(err)
+			return nil, err
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff = min(backoff*2, c.maxBackoff)
+		}
+
+		requestRetries.Inc()
+		select {
+		case <-ctx.Done():
+			c.breaker.abort()
+			return nil, fmt.Errorf("executing request: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send performs a single request attempt
+func (c *Client) send(ctx context.Context, reqURL string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
-	c.setHeaders(req)
+	if err := c.setHeaders(req); err != nil {
+		return nil, err
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("executing request: %w", err)
+		return nil, fmt.Errorf("executing request: %w", err)
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("loki not ready, status: %d", resp.StatusCode)
+// retryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, returning 0 when it is absent or invalid
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
 	}
-
-	return nil
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
 }
 
-func (c *Client) setHeaders(req *http.Request) {
+func (c *Client) setHeaders(req *http.Request) error {
 	req.Header.Set("Accept", "application/json")
+	return c.setAuthHeaders(req.Header)
+}
 
+// setAuthHeaders applies tenant and credential headers, shared by HTTP and WebSocket requests
+func (c *Client) setAuthHeaders(h http.Header) error {
 	if c.tenantID != "" {
-		req.Header.Set("X-Scope-OrgID", c.tenantID)
+		h.Set("X-Scope-OrgID", c.tenantID)
+	}
+
+	token := c.token
+	if c.tokenFile != nil {
+		var err error
+		if token, err = c.tokenFile.Token(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case token != "":
+		h.Set("Authorization", "Bearer "+token)
+	case c.username != "" && c.password != "":
+		auth := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
+		h.Set("Authorization", "Basic "+auth)
+	}
+	return nil
+}
+
+// entries decodes a streams result into log entries
+func (d QueryData) entries() ([]LogEntry, error) {
+	if d.ResultType != "" && d.ResultType != ResultStreams {
+		return nil, fmt.Errorf("expected a log query, got %s result", d.ResultType)
+	}
+
+	var streams []Stream
+	if len(d.Result) > 0 {
+		if err := json.Unmarshal(d.Result, &streams); err != nil {
+			return nil, fmt.Errorf("decoding streams: %w", err)
+		}
+	}
+	return parseStreams(streams), nil
+}
+
+// Series decodes a vector, matrix or scalar result into metric series
+func (d QueryData) Series() ([]Series, error) {
+	switch d.ResultType {
+	case ResultVector:
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(d.Result, &vector); err != nil {
+			return nil, fmt.Errorf("decoding vector: %w", err)
+		}
+
+		series := make([]Series, 0, len(vector))
+		for _, v := range vector {
+			sample, err := parseSample(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			series = append(series, Series{Labels: v.Metric, Samples: []Sample{sample}})
+		}
+		return series, nil
+
+	case ResultMatrix:
+		var matrix []struct {
+			Metric map[string]string   `json:"metric"`
+			Values [][]json.RawMessage `json:"values"`
+		}
+		if err := json.Unmarshal(d.Result, &matrix); err != nil {
+			return nil, fmt.Errorf("decoding matrix: %w", err)
+		}
+
+		series := make([]Series, 0, len(matrix))
+		for _, m := range matrix {
+			s := Series{Labels: m.Metric, Samples: make([]Sample, 0, len(m.Values))}
+			for _, value := range m.Values {
+				sample, err := parseSample(value)
+				if err != nil {
+					return nil, err
+				}
+				s.Samples = append(s.Samples, sample)
+			}
+			series = append(series, s)
+		}
+		return series, nil
+
+	case ResultScalar:
+		var value []json.RawMessage
+		if err := json.Unmarshal(d.Result, &value); err != nil {
+			return nil, fmt.Errorf("decoding scalar: %w", err)
+		}
+		sample, err := parseSample(value)
+		if err != nil {
+			return nil, err
+		}
+		return []Series{{Labels: map[string]string{}, Samples: []Sample{sample}}}, nil
+
+	default:
+		return nil, fmt.Errorf("expected a metric query, got %s result", d.ResultType)
+	}
+}
+
+// parseSample decodes a [<unix seconds>, "<value>"] pair
+func parseSample(pair []json.RawMessage) (Sample, error) {
+	if len(pair) != 2 {
+		return Sample{}, fmt.Errorf("invalid sample: expected [timestamp, value]")
 	}
 
-	if c.username != "" && c.password != "" {
-		req.SetBasicAuth(c.username, c.password)
+	var ts float64
+	if err := json.Unmarshal(pair[0], &ts); err != nil {
+		return Sample{}, fmt.Errorf("invalid sample timestamp: %w", err)
 	}
+
+	var raw string
+	if err := json.Unmarshal(pair[1], &raw); err != nil {
+		return Sample{}, fmt.Errorf("invalid sample value: %w", err)
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid sample value: %w", err)
+	}
+
+	sec, frac := math.Modf(ts)
+	return Sample{
+		Timestamp: time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)),
+		Value:     value,
+	}, nil
 }
 
-func (c *Client) parseStreams(streams []Stream) []LogEntry {
+func parseStreams(streams []Stream) []LogEntry {
 	var entries []LogEntry
 
 	for _, stream := range streams {
@@ -221,6 +590,7 @@ func (c *Client) parseStreams(streams []Stream) []LogEntry {
 				Timestamp: time.Unix(0, timestampNs),
 				Labels:    stream.Stream,
 				Line:      value[1],
+				Tenant:    stream.Stream[TenantLabel],
 			})
 		}
 	}
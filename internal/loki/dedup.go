@@ -0,0 +1,77 @@
+package loki
+
+import (
+	"sync"
+	"time"
+)
+
+// Dedup tracks the fingerprints a source has already reported so later
+// occurrences within its dedup window are marked as repeats. The window
+// runs from the last occurrence, so an error that keeps recurring stays a
+// repeat. The zero value is ready to use and safe for concurrent use.
+type Dedup struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Mark sets Repeat on errors whose fingerprint was already seen and records
+// every fingerprint as last seen at now. It returns the number of new
+// errors.
+func (d *Dedup) Mark(errors []ParsedError, now time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time)
+	}
+
+	newCount := 0
+	for i := range errors {
+		if _, seen := d.seen[errors[i].Fingerprint]; seen {
+			errors[i].Repeat = true
+		} else {
+			newCount++
+		}
+		d.seen[errors[i].Fingerprint] = now
+	}
+	return newCount
+}
+
+// Cleanup forgets fingerprints last seen before cutoff and returns how many
+// remain
+func (d *Dedup) Cleanup(cutoff time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for fp, seenAt := range d.seen {
+		if seenAt.Before(cutoff) {
+			delete(d.seen, fp)
+		}
+	}
+	return len(d.seen)
+}
+
+// Snapshot returns a copy of the seen fingerprints for checkpoints
+func (d *Dedup) Snapshot() map[string]time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seen := make(map[string]time.Time, len(d.seen))
+	for fp, seenAt := range d.seen {
+		seen[fp] = seenAt
+	}
+	return seen
+}
+
+// Restore adds fingerprints saved by Snapshot
+func (d *Dedup) Restore(seen map[string]time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time, len(seen))
+	}
+	for fp, seenAt := range seen {
+		d.seen[fp] = seenAt
+	}
+}
@@ -0,0 +1,108 @@
+package loki
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupMark(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		seen        map[string]time.Time
+		batch       []string
+		wantNew     int
+		wantRepeats []bool
+	}{
+		{
+			name:        "new fingerprints",
+			batch:       []string{"a", "b"},
+			wantNew:     2,
+			wantRepeats: []bool{false, false},
+		},
+		{
+			name:        "repeat within a batch",
+			batch:       []string{"a", "a", "b", "a"},
+			wantNew:     2,
+			wantRepeats: []bool{false, true, false, true},
+		},
+		{
+			name:        "restored from a checkpoint",
+			seen:        map[string]time.Time{"a": now.Add(-time.Minute)},
+			batch:       []string{"a", "b"},
+			wantNew:     1,
+			wantRepeats: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Dedup
+			d.Restore(tt.seen)
+
+			var errors []ParsedError
+			for _, fp := range tt.batch {
+				errors = append(errors, ParsedError{Fingerprint: fp})
+			}
+
+			if got := d.Mark(errors, now); got != tt.wantNew {
+				t.Errorf("Mark = %d new, want %d", got, tt.wantNew)
+			}
+			for i, e := range errors {
+				if e.Repeat != tt.wantRepeats[i] {
+					t.Errorf("errors[%d] (%s) Repeat = %v, want %v", i, e.Fingerprint, e.Repeat, tt.wantRepeats[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDedupCleanup(t *testing.T) {
+	now := time.Now()
+
+	var d Dedup
+	d.Mark([]ParsedError{{Fingerprint: "old"}}, now.Add(-time.Hour))
+	d.Mark([]ParsedError{{Fingerprint: "recent"}}, now)
+
+	if remaining := d.Cleanup(now.Add(-30 * time.Minute)); remaining != 1 {
+		t.Fatalf("Cleanup left %d fingerprints, want 1", remaining)
+	}
+
+	snapshot := d.Snapshot()
+	if _, ok := snapshot["old"]; ok {
+		t.Error("expired fingerprint still in snapshot")
+	}
+	if !snapshot["recent"].Equal(now) {
+		t.Errorf("recent seen at %v, want %v", snapshot["recent"], now)
+	}
+
+	errors := []ParsedError{{Fingerprint: "old"}, {Fingerprint: "recent"}}
+	d.Mark(errors, now)
+	if errors[0].Repeat || !errors[1].Repeat {
+		t.Errorf("Repeat = %v/%v after cleanup, want false/true", errors[0].Repeat, errors[1].Repeat)
+	}
+}
+
+func TestDedupWindowFromLastSeen(t *testing.T) {
+	start := time.Now()
+	window := 10 * time.Minute
+
+	// An error recurring every 4 minutes stays a repeat long after the
+	// window since its first occurrence ran out
+	var d Dedup
+	for i := 0; i < 6; i++ {
+		now := start.Add(time.Duration(i) * 4 * time.Minute)
+		d.Cleanup(now.Add(-window))
+
+		errors := []ParsedError{{Fingerprint: "a"}}
+		d.Mark(errors, now)
+		if want := i > 0; errors[0].Repeat != want {
+			t.Errorf("occurrence %d Repeat = %v, want %v", i, errors[0].Repeat, want)
+		}
+	}
+
+	if remaining := d.Cleanup(start.Add(20*time.Minute + window + time.Second)); remaining != 0 {
+		t.Errorf("Cleanup left %d fingerprints after the window since the last occurrence, want 0", remaining)
+	}
+}
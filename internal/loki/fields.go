@@ -0,0 +1,220 @@
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Structured field names extracted from log lines
+const (
+	FieldLevel   = "level"
+	FieldMessage = "message"
+	FieldError   = "error"
+	FieldCaller  = "caller"
+	FieldTraceID = "trace_id"
+	FieldSpanID  = "span_id"
+
+	// Set when the error carries a stack trace
+	FieldExceptionType = "exception_type"
+	FieldTopFrame      = "top_frame"
+	FieldLanguage      = "language"
+)
+
+// FieldMapping lists, for each structured field, the keys to look for in a
+// JSON or logfmt line in order of preference. Nested JSON keys are
+// addressed with dots, e.g. "error.message".
+type FieldMapping struct {
+	Level   []string
+	Message []string
+	Error   []string
+	Caller  []string
+	TraceID []string
+	SpanID  []string
+}
+
+// DefaultFieldMapping covers the key names used by common Go, Java, Python
+// and Node.js logging libraries
+func DefaultFieldMapping() FieldMapping {
+	return FieldMapping{
+		Level:   []string{"level", "lvl", "severity", "log.level", "levelname", "loglevel"},
+		Message: []string{"message", "msg", "log.message", "event"},
+		Error:   []string{"error", "err", "error.message", "exception", "exception.message"},
+		Caller:  []string{"caller", "source.function", "log.origin.function", "funcName", "logger", "logger_name"},
+		TraceID: []string{"trace_id", "traceId", "traceID", "trace.id", "dd.trace_id", "otelTraceID"},
+		SpanID:  []string{"span_id", "spanId", "spanID", "span.id", "dd.span_id", "otelSpanID"},
+	}
+}
+
+// WithDefaults returns the mapping with empty key lists taken from
+// DefaultFieldMapping
+func (m FieldMapping) WithDefaults() FieldMapping {
+	d := DefaultFieldMapping()
+	if len(m.Level) == 0 {
+		m.Level = d.Level
+	}
+	if len(m.Message) == 0 {
+		m.Message = d.Message
+	}
+	if len(m.Error) == 0 {
+		m.Error = d.Error
+	}
+	if len(m.Caller) == 0 {
+		m.Caller = d.Caller
+	}
+	if len(m.TraceID) == 0 {
+		m.TraceID = d.TraceID
+	}
+	if len(m.SpanID) == 0 {
+		m.SpanID = d.SpanID
+	}
+	return m
+}
+
+// Extract picks the structured fields out of a flattened key/value set.
+// It returns nil when none of the mapped keys are present.
+func (m FieldMapping) Extract(values map[string]string) map[string]string {
+	var fields map[string]string
+	for _, f := range []struct {
+		name string
+		keys []string
+	}{
+		{FieldLevel, m.Level},
+		{FieldMessage, m.Message},
+		{FieldError, m.Error},
+		{FieldCaller, m.Caller},
+		{FieldTraceID, m.TraceID},
+		{FieldSpanID, m.SpanID},
+	} {
+		for _, key := range f.keys {
+			if v := values[key]; v != "" {
+				if fields == nil {
+					fields = make(map[string]string)
+				}
+				fields[f.name] = v
+				break
+			}
+		}
+	}
+	return fields
+}
+
+// ParseLine parses a JSON object or logfmt line into flattened key/value
+// pairs. Nested JSON objects are flattened with dotted keys and arrays are
+// kept as JSON. It returns nil for lines in neither format.
+func ParseLine(line string) map[string]string {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "{") {
+		return parseJSONLine(trimmed)
+	}
+	return parseLogfmt(trimmed)
+}
+
+func parseJSONLine(line string) map[string]string {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil
+	}
+
+	return FlattenJSON(obj)
+}
+
+// FlattenJSON converts a decoded JSON object into key/value pairs with
+// dotted keys for nested objects
+func FlattenJSON(obj map[string]interface{}) map[string]string {
+	values := make(map[string]string)
+	flattenJSON("", obj, values)
+	return values
+}
+
+// flattenJSON writes the leaves of obj into values using dotted keys
+func flattenJSON(prefix string, obj map[string]interface{}, values map[string]string) {
+	for k, v := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch val := v.(type) {
+		case map[string]interface{}:
+			flattenJSON(key, val, values)
+		case string:
+			values[key] = val
+		case json.Number:
+			values[key] = val.String()
+		case float64:
+			values[key] = strconv.FormatFloat(val, 'f', -1, 64)
+		case bool:
+			values[key] = strconv.FormatBool(val)
+		case nil:
+			values[key] = ""
+		default:
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(val); err == nil {
+				values[key] = strings.TrimSpace(buf.String())
+			}
+		}
+	}
+}
+
+// parseLogfmt parses key=value pairs separated by spaces, with optionally
+// double-quoted values. Lines containing anything other than pairs are
+// rejected so free text with an occasional "=" isn't mistaken for logfmt.
+func parseLogfmt(line string) map[string]string {
+	values := make(map[string]string)
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			break
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return nil
+		}
+		key := line[:eq]
+		if strings.ContainsAny(key, " \t\"") {
+			return nil
+		}
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil
+			}
+			value, err = strconv.Unquote(quoted)
+			if err != nil {
+				return nil
+			}
+			line = line[len(quoted):]
+			if line != "" && line[0] != ' ' && line[0] != '\t' {
+				return nil
+			}
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			value = line[:end]
+			if strings.Contains(value, `"`) {
+				return nil
+			}
+			line = line[end:]
+		}
+
+		values[key] = value
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
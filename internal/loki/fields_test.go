@@ -0,0 +1,162 @@
+package loki
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want map[string]string
+	}{
+		{
+			name: "json",
+			line: `{"level":"error","msg":"payment failed","order":42,"retry":false}`,
+			want: map[string]string{"level": "error", "msg": "payment failed", "order": "42", "retry": "false"},
+		},
+		{
+			name: "nested json",
+			line: `{"log":{"level":"error"},"error":{"message":"timeout","codes":[1,2]},"span":null}`,
+			want: map[string]string{"log.level": "error", "error.message": "timeout", "error.codes": "[1,2]", "span": ""},
+		},
+		{
+			name: "json keeps large numbers",
+			line: `{"trace_id":12345678901234567890}`,
+			want: map[string]string{"trace_id": "12345678901234567890"},
+		},
+		{
+			name: "logfmt",
+			line: `level=error msg="payment failed: card declined" order=42 caller=pay.go:10`,
+			want: map[string]string{"level": "error", "msg": "payment failed: card declined", "order": "42", "caller": "pay.go:10"},
+		},
+		{
+			name: "logfmt escapes",
+			line: `msg="say \"hi\"" empty=`,
+			want: map[string]string{"msg": `say "hi"`, "empty": ""},
+		},
+		{
+			name: "free text",
+			line: "ERROR failed to connect to db",
+			want: nil,
+		},
+		{
+			name: "free text with equals",
+			line: "retrying with timeout=5s",
+			want: nil,
+		},
+		{
+			name: "unterminated quote",
+			line: `level=error msg="oops`,
+			want: nil,
+		},
+		{
+			name: "invalid json",
+			line: `{"level":"error"`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseLine(tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLine = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldMappingExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping FieldMapping
+		values  map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "default keys",
+			mapping: DefaultFieldMapping(),
+			values:  map[string]string{"severity": "ERROR", "msg": "boom", "error.message": "timeout", "traceId": "abc", "other": "x"},
+			want:    map[string]string{FieldLevel: "ERROR", FieldMessage: "boom", FieldError: "timeout", FieldTraceID: "abc"},
+		},
+		{
+			name:    "preference order",
+			mapping: DefaultFieldMapping(),
+			values:  map[string]string{"msg": "second", "message": "first"},
+			want:    map[string]string{FieldMessage: "first"},
+		},
+		{
+			name:    "empty values are skipped",
+			mapping: DefaultFieldMapping(),
+			values:  map[string]string{"message": "", "msg": "used"},
+			want:    map[string]string{FieldMessage: "used"},
+		},
+		{
+			name:    "custom keys with defaults",
+			mapping: FieldMapping{Message: []string{"body"}}.WithDefaults(),
+			values:  map[string]string{"body": "custom", "msg": "ignored", "level": "warn"},
+			want:    map[string]string{FieldMessage: "custom", FieldLevel: "warn"},
+		},
+		{
+			name:    "nothing mapped",
+			mapping: DefaultFieldMapping(),
+			values:  map[string]string{"foo": "bar"},
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapping.Extract(tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEntryFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       LogEntry
+		wantMessage string
+		wantFields  map[string]string
+	}{
+		{
+			name:        "json message",
+			entry:       LogEntry{Line: `{"level":"error","msg":"payment failed","trace_id":"abc"}`},
+			wantMessage: "payment failed",
+			wantFields:  map[string]string{FieldLevel: "error", FieldMessage: "payment failed", FieldTraceID: "abc"},
+		},
+		{
+			name:        "logfmt error without message",
+			entry:       LogEntry{Line: `level=error err="connection refused"`},
+			wantMessage: "connection refused",
+			wantFields:  map[string]string{FieldLevel: "error", FieldError: "connection refused"},
+		},
+		{
+			name:        "attributes fill missing keys",
+			entry:       LogEntry{Line: `msg="from line"`, Attributes: map[string]string{"msg": "from attributes", "trace_id": "t1"}},
+			wantMessage: "from line",
+			wantFields:  map[string]string{FieldMessage: "from line", FieldTraceID: "t1"},
+		},
+		{
+			name:        "plain line",
+			entry:       LogEntry{Line: "connection refused"},
+			wantMessage: "connection refused",
+			wantFields:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseEntry("test", tt.entry, DefaultFieldMapping(), DefaultFingerprintConfig())
+			if got.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", got.Message, tt.wantMessage)
+			}
+			if !reflect.DeepEqual(got.Fields, tt.wantFields) {
+				t.Errorf("Fields = %v, want %v", got.Fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package loki
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces the parts of a message matching Pattern with Replacement,
+// which may refer to capture groups as $1
+type Mask struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+var (
+	// defaultMasks remove the variable parts of messages
+	defaultMasks = []Mask{
+		// Timestamps
+		{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T\s]\d{2}:\d{2}:\d{2}[.\d]*[Z]?`), ""},
+		// UUIDs
+		{regexp.MustCompile(`[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}`), "<UUID>"},
+		// Hex IDs
+		{regexp.MustCompile(`\b[a-f0-9]{24,}\b`), "<ID>"},
+		// IP addresses
+		{regexp.MustCompile(`\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?`), "<IP>"},
+		// Numbers (but keep error codes like 404, 500)
+		{regexp.MustCompile(`\b\d{6,}\b`), "<NUM>"},
+	}
+
+	// defaultPodPatterns extract the workload name from pod names
+	defaultPodPatterns = []*regexp.Regexp{
+		// Deployment pods: name-<replicaset-hash>-<pod-hash>
+		regexp.MustCompile(`^(.+)-[a-z0-9]{8,10}-[a-z0-9]{5}$`),
+		// StatefulSet pods: name-<ordinal>
+		regexp.MustCompile(`^(.+)-\d+$`),
+		// Job pods: name-<random>
+		regexp.MustCompile(`^(.+)-[a-z0-9]{5}$`),
+	}
+)
+
+// FingerprintConfig controls how errors are grouped into fingerprints
+type FingerprintConfig struct {
+	// StackFrames is the number of in-app frames hashed together with the
+	// exception type when a stack trace is present. Zero groups stack
+	// traces by message like any other error.
+	StackFrames int
+
+	// ExcludeFrames lists function or file prefixes of library frames,
+	// in addition to the built-in ones, that are skipped when picking
+	// in-app frames
+	ExcludeFrames []string
+
+	// Masks are applied to messages before the built-in masks, which are
+	// skipped when NoDefaultMasks is set
+	Masks          []Mask
+	NoDefaultMasks bool
+
+	// PodPatterns extract the workload name from a pod name as their first
+	// capture group and are tried before the built-in patterns. With
+	// KeepPodNames every pod is grouped separately.
+	PodPatterns  []*regexp.Regexp
+	KeepPodNames bool
+
+	// Templates, when set, learns message templates from parsed log lines
+	// and groups errors by template instead of by masked message
+	Templates *TemplateMiner
+}
+
+// DefaultFingerprintConfig hashes the top three in-app frames and uses the
+// built-in masks and pod name patterns
+func DefaultFingerprintConfig() FingerprintConfig {
+	return FingerprintConfig{StackFrames: 3}
+}
+
+// Workload returns the pod name without the random suffix added by its
+// controller, e.g. "my-app-7d4f8b9c5d-abc12" -> "my-app"
+func (c FingerprintConfig) Workload(pod string) string {
+	if c.KeepPodNames {
+		return pod
+	}
+
+	for _, patterns := range [][]*regexp.Regexp{c.PodPatterns, defaultPodPatterns} {
+		for _, re := range patterns {
+			if matches := re.FindStringSubmatch(pod); len(matches) > 1 {
+				return matches[1]
+			}
+		}
+	}
+	return pod
+}
+
+// NormalizeMessage removes variable parts from an error message
+func (c FingerprintConfig) NormalizeMessage(message string) string {
+	msg := message
+	for _, m := range c.Masks {
+		msg = m.Pattern.ReplaceAllString(msg, m.Replacement)
+	}
+	if !c.NoDefaultMasks {
+		for _, m := range defaultMasks {
+			msg = m.Pattern.ReplaceAllString(msg, m.Replacement)
+		}
+	}
+	return strings.TrimSpace(msg)
+}
+
+// Fingerprint creates a fingerprint for deduplication from the namespace,
+// workload, container and normalized message. Sources that build their own
+// message instead of parsing a log line use it directly.
+func (c FingerprintConfig) Fingerprint(namespace, pod, container, message string) string {
+	data := fmt.Sprintf("%s|%s|%s|%s", namespace, c.Workload(pod), container, c.NormalizeMessage(message))
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:8])
+}
+
+// seriesFingerprint creates a fingerprint from a metric series identity
+// without normalizing it
+func seriesFingerprint(ident string) string {
+	hash := sha256.Sum256([]byte(ident))
+	return hex.EncodeToString(hash[:8])
+}
+
+// tenantFingerprint scopes a fingerprint to a tenant, so identical errors
+// from different tenants are kept apart
+func tenantFingerprint(tenant, fingerprint string) string {
+	hash := sha256.Sum256([]byte(tenant + "|" + fingerprint))
+	return hex.EncodeToString(hash[:8])
+}
+
+// templateFingerprint creates a fingerprint from a learned template ID, so
+// messages differing only in their parameters group together
+func (c FingerprintConfig) templateFingerprint(namespace, pod, container, templateID string) string {
+	data := fmt.Sprintf("%s|%s|%s|template:%s", namespace, c.Workload(pod), container, templateID)
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:8])
+}
+
+// stackFingerprint creates a fingerprint from the exception type and
+// frames of a stack trace instead of the message
+func (c FingerprintConfig) stackFingerprint(namespace, pod, container string, st *StackTrace, frames []StackFrame) string {
+	names := make([]string, len(frames))
+	for i, f := range frames {
+		names[i] = st.frameName(f)
+	}
+
+	data := fmt.Sprintf("%s|%s|%s|%s|%s|%s", namespace, c.Workload(pod), container,
+		st.Language, st.ExceptionType, strings.Join(names, "|"))
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:8])
+}
@@ -0,0 +1,174 @@
+package loki
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     FingerprintConfig
+		message string
+		want    string
+	}{
+		{
+			name:    "timestamp",
+			message: "2024-01-02T03:04:05.123Z request failed",
+			want:    "request failed",
+		},
+		{
+			name:    "uuid",
+			message: "order 3f2b8c1e-4a5d-4e6f-8a9b-0c1d2e3f4a5b not found",
+			want:    "order <UUID> not found",
+		},
+		{
+			name:    "hex id",
+			message: "object 507f1f77bcf86cd799439011 missing",
+			want:    "object <ID> missing",
+		},
+		{
+			name:    "ip and port",
+			message: "dial tcp 10.0.0.12:5432: connection refused",
+			want:    "dial tcp <IP>: connection refused",
+		},
+		{
+			name:    "long numbers but not status codes",
+			message: "user 1234567 got 503",
+			want:    "user <NUM> got 503",
+		},
+		{
+			name:    "custom masks run first",
+			cfg:     FingerprintConfig{Masks: []Mask{{Pattern: regexp.MustCompile(`user=\w+`), Replacement: "user=<USER>"}}},
+			message: "login failed user=alice from 10.0.0.1",
+			want:    "login failed user=<USER> from <IP>",
+		},
+		{
+			name:    "capture groups",
+			cfg:     FingerprintConfig{Masks: []Mask{{Pattern: regexp.MustCompile(`(took) \d+ms`), Replacement: "$1 <DURATION>"}}},
+			message: "query took 1234ms",
+			want:    "query took <DURATION>",
+		},
+		{
+			name:    "without default masks",
+			cfg:     FingerprintConfig{NoDefaultMasks: true},
+			message: "dial tcp 10.0.0.12:5432: connection refused",
+			want:    "dial tcp 10.0.0.12:5432: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.NormalizeMessage(tt.message); got != tt.want {
+				t.Errorf("NormalizeMessage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkload(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  FingerprintConfig
+		pod  string
+		want string
+	}{
+		{"deployment", FingerprintConfig{}, "checkout-7d9f8b6c5d-abcde", "checkout"},
+		{"statefulset", FingerprintConfig{}, "postgres-0", "postgres"},
+		{"job", FingerprintConfig{}, "migrate-x7k2p", "migrate"},
+		{"bare pod", FingerprintConfig{}, "debug", "debug"},
+		{"custom pattern first", FingerprintConfig{PodPatterns: []*regexp.Regexp{regexp.MustCompile(`^(.+)-canary-\w+$`)}}, "checkout-canary-abc", "checkout"},
+		{"keep pod names", FingerprintConfig{KeepPodNames: true}, "checkout-7d9f8b6c5d-abcde", "checkout-7d9f8b6c5d-abcde"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.Workload(tt.pod); got != tt.want {
+				t.Errorf("Workload(%q) = %q, want %q", tt.pod, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEntryFingerprint(t *testing.T) {
+	entry := func(namespace, pod, line string) LogEntry {
+		return LogEntry{Labels: map[string]string{"namespace": namespace, "pod": pod, "container": "app"}, Line: line}
+	}
+	javaTrace := func(message, frame string) string {
+		return "java.lang.IllegalStateException: " + message + "\n\tat " + frame + "(Orders.java:10)\n\tat java.lang.Thread.run(Thread.java:833)"
+	}
+
+	tests := []struct {
+		name     string
+		a, b     LogEntry
+		wantSame bool
+	}{
+		{
+			name:     "replicas of one deployment",
+			a:        entry("shop", "checkout-7d9f8b6c5d-abcde", "connection refused"),
+			b:        entry("shop", "checkout-7d9f8b6c5d-fghij", "connection refused"),
+			wantSame: true,
+		},
+		{
+			name:     "masked values",
+			a:        entry("shop", "checkout-0", "dial tcp 10.0.0.1:5432: connection refused"),
+			b:        entry("shop", "checkout-0", "dial tcp 10.0.0.2:5432: connection refused"),
+			wantSame: true,
+		},
+		{
+			name: "namespaces",
+			a:    entry("shop", "checkout-0", "connection refused"),
+			b:    entry("staging", "checkout-0", "connection refused"),
+		},
+		{
+			name: "tenants",
+			a:    LogEntry{Tenant: "team-a", Labels: map[string]string{"namespace": "shop"}, Line: "connection refused"},
+			b:    LogEntry{Tenant: "team-b", Labels: map[string]string{"namespace": "shop"}, Line: "connection refused"},
+		},
+		{
+			name:     "stack traces from one place",
+			a:        entry("shop", "orders-0", javaTrace("order 1 invalid", "com.example.Orders.place")),
+			b:        entry("shop", "orders-0", javaTrace("order 2 has no items", "com.example.Orders.place")),
+			wantSame: true,
+		},
+		{
+			name: "stack traces from different places",
+			a:    entry("shop", "orders-0", javaTrace("invalid", "com.example.Orders.place")),
+			b:    entry("shop", "orders-0", javaTrace("invalid", "com.example.Orders.cancel")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultFingerprintConfig()
+			a := ParseEntry("test", tt.a, DefaultFieldMapping(), cfg)
+			b := ParseEntry("test", tt.b, DefaultFieldMapping(), cfg)
+			if same := a.Fingerprint == b.Fingerprint; same != tt.wantSame {
+				t.Errorf("same fingerprint = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestParseEntryTemplates(t *testing.T) {
+	cfg := DefaultFingerprintConfig()
+	cfg.Templates = NewTemplateMiner(DefaultTemplateMinerConfig())
+
+	labels := map[string]string{"namespace": "shop", "pod": "checkout-0"}
+	a := ParseEntry("test", LogEntry{Labels: labels, Line: "payment for order alpha failed"}, DefaultFieldMapping(), cfg)
+	b := ParseEntry("test", LogEntry{Labels: labels, Line: "payment for order beta failed"}, DefaultFieldMapping(), cfg)
+	c := ParseEntry("test", LogEntry{Labels: labels, Line: "disk quota exceeded"}, DefaultFieldMapping(), cfg)
+
+	if a.TemplateID == "" || a.TemplateID != b.TemplateID {
+		t.Fatalf("template IDs %q and %q, want one template for both orders", a.TemplateID, b.TemplateID)
+	}
+	if a.Fingerprint != b.Fingerprint {
+		t.Error("messages of one template got different fingerprints")
+	}
+	if b.Template != "payment for order <*> failed" {
+		t.Errorf("Template = %q, want the order wildcarded", b.Template)
+	}
+	if c.Fingerprint == a.Fingerprint {
+		t.Error("an unrelated message joined the template")
+	}
+}
@@ -0,0 +1,254 @@
+package loki
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Comparison operators for metric thresholds
+const (
+	OpAbove        = ">"
+	OpAboveOrEqual = ">="
+	OpBelow        = "<"
+	OpBelowOrEqual = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// Threshold compares a metric value against a limit
+type Threshold struct {
+	Op    string
+	Value float64
+}
+
+// Breached reports whether v crosses the threshold
+func (t Threshold) Breached(v float64) bool {
+	switch t.Op {
+	case OpAbove:
+		return v > t.Value
+	case OpAboveOrEqual:
+		return v >= t.Value
+	case OpBelow:
+		return v < t.Value
+	case OpBelowOrEqual:
+		return v <= t.Value
+	case OpEqual:
+		return v == t.Value
+	case OpNotEqual:
+		return v != t.Value
+	}
+	return false
+}
+
+// String returns the threshold as e.g. "> 5"
+func (t Threshold) String() string {
+	return t.Op + " " + strconv.FormatFloat(t.Value, 'g', -1, 64)
+}
+
+// MetricPoller periodically evaluates a LogQL metric query and raises a
+// synthetic error for every series that breaches its threshold. Errors
+// carry the series labels, so rules can match namespace, pod or any label
+// the query groups by. A series that keeps breaching is reported as a
+// repeat until it recovers.
+type MetricPoller struct {
+	source    string
+	client    *Client
+	query     string
+	interval  time.Duration
+	threshold Threshold
+	message   string
+	handler   ErrorHandler
+	logger    *slog.Logger
+
+	fingerprint FingerprintConfig
+
+	mu       sync.Mutex
+	breached map[string]bool // fingerprints breaching at the last evaluation
+}
+
+// MetricOption configures a MetricPoller
+type MetricOption func(*MetricPoller)
+
+// WithMetricSource sets the source name used to tag errors and metrics
+func WithMetricSource(name string) MetricOption {
+	return func(p *MetricPoller) {
+		p.source = name
+	}
+}
+
+// WithMetricLogger sets the logger for the metric poller
+func WithMetricLogger(logger *slog.Logger) MetricOption {
+	return func(p *MetricPoller) {
+		p.logger = logger
+	}
+}
+
+// WithMetricMessage sets the error message. It defaults to the source name,
+// threshold and value, and is suffixed with the value either way.
+func WithMetricMessage(message string) MetricOption {
+	return func(p *MetricPoller) {
+		p.message = message
+	}
+}
+
+// WithMetricFingerprint sets how the workload of a breaching series is
+// derived from its pod label
+func WithMetricFingerprint(cfg FingerprintConfig) MetricOption {
+	return func(p *MetricPoller) {
+		p.fingerprint = cfg
+	}
+}
+
+// NewMetricPoller creates a poller for a LogQL metric query
+func NewMetricPoller(client *Client, query string, interval time.Duration, threshold Threshold, handler ErrorHandler, opts ...MetricOption) *MetricPoller {
+	p := &MetricPoller{
+		source:      "metric",
+		client:      client,
+		query:       query,
+		interval:    interval,
+		threshold:   threshold,
+		handler:     handler,
+		logger:      slog.Default(),
+		fingerprint: DefaultFingerprintConfig(),
+		breached:    make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Name returns the source name the poller tags errors with
+func (p *MetricPoller) Name() string {
+	return p.source
+}
+
+// Start evaluates the query every interval until ctx is cancelled
+func (p *MetricPoller) Start(ctx context.Context) error {
+	p.logger.Info("starting loki metric poller",
+		"source", p.source,
+		"query", p.query,
+		"interval", p.interval,
+		"threshold", p.threshold.String(),
+	)
+
+	if err := p.evaluate(ctx, time.Now()); err != nil {
+		p.logger.Error("initial metric evaluation failed", "source", p.source, "error", err)
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("stopping loki metric poller", "source", p.source)
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := p.evaluate(ctx, time.Now()); err != nil {
+				p.logger.Error("metric evaluation failed", "source", p.source, "error", err)
+			}
+		}
+	}
+}
+
+// evaluate runs the query at the given time and reports breaching series
+func (p *MetricPoller) evaluate(ctx context.Context, at time.Time) error {
+	timer := time.Now()
+	series, err := p.client.QueryMetric(ctx, p.query, at)
+	pollDuration.WithLabelValues(p.source).Observe(time.Since(timer).Seconds())
+	if err != nil {
+		pollErrors.WithLabelValues(p.source).Inc()
+		return fmt.Errorf("querying loki: %w", err)
+	}
+
+	breached := make(map[string]bool)
+	var errors []ParsedError
+	for _, s := range series {
+		sample, ok := s.Last()
+		if !ok || !p.threshold.Breached(sample.Value) {
+			continue
+		}
+
+		parsed := p.seriesError(s.Labels, sample)
+		breached[parsed.Fingerprint] = true
+
+		p.mu.Lock()
+		parsed.Repeat = p.breached[parsed.Fingerprint]
+		p.mu.Unlock()
+
+		errors = append(errors, *parsed)
+	}
+
+	p.mu.Lock()
+	p.breached = breached
+	p.mu.Unlock()
+
+	if len(errors) > 0 {
+		p.logger.Debug("metric threshold breached", "source", p.source, "series", len(errors))
+		p.handler(errors)
+	}
+	return nil
+}
+
+// seriesError builds the synthetic error for a breaching series
+func (p *MetricPoller) seriesError(labels map[string]string, sample Sample) *ParsedError {
+	namespace := labels["namespace"]
+	pod := labels["pod"]
+	container := labels["container"]
+	tenant := labels[TenantLabel]
+	if tenant == "" {
+		tenant = p.client.tenant()
+	}
+
+	// Series are identified by their labels; the value changes every
+	// evaluation and must not split the error. Label values are kept as
+	// they are, since message masks would merge series such as status
+	// codes or pod hashes.
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var ident strings.Builder
+	fmt.Fprintf(&ident, "metric:%s|%s|", p.source, tenant)
+	for _, k := range keys {
+		fmt.Fprintf(&ident, "%s=%q,", k, labels[k])
+	}
+
+	value := strconv.FormatFloat(sample.Value, 'g', 6, 64)
+	message := p.message
+	if message == "" {
+		message = fmt.Sprintf("%s %s", p.source, p.threshold)
+	}
+	message = fmt.Sprintf("%s (value %s)", message, value)
+
+	return &ParsedError{
+		ID:          generateID(),
+		Fingerprint: seriesFingerprint(ident.String()),
+		Timestamp:   sample.Timestamp,
+		Source:      p.source,
+		Tenant:      tenant,
+		Namespace:   namespace,
+		Pod:         pod,
+		Workload:    p.fingerprint.Workload(pod),
+		Container:   container,
+		Message:     message,
+		Labels:      labels,
+		Fields: map[string]string{
+			"value":     value,
+			"threshold": p.threshold.String(),
+			"query":     p.query,
+		},
+		Raw: fmt.Sprintf("%s %s", p.query, p.threshold),
+	}
+}
@@ -0,0 +1,120 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// vectorServer serves instant metric queries from the vector set by the
+// test, as a raw JSON result
+type vectorServer struct {
+	mu     sync.Mutex
+	result string
+}
+
+func (s *vectorServer) set(result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.result = result
+}
+
+func (s *vectorServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":` + s.result + `}}`))
+}
+
+func TestMetricPollerSeriesFingerprints(t *testing.T) {
+	tests := []struct {
+		name      string
+		masks     []Mask
+		first     string
+		second    string
+		wantSame  bool
+		wantCount int
+	}{
+		{
+			name:      "value changes keep the series",
+			first:     `[{"metric":{"namespace":"shop","pod":"checkout-0"},"value":[1700000000,"7"]}]`,
+			second:    `[{"metric":{"namespace":"shop","pod":"checkout-0"},"value":[1700000030,"12.5"]}]`,
+			wantSame:  true,
+			wantCount: 1,
+		},
+		{
+			name:      "status codes stay apart under a message mask",
+			masks:     []Mask{{Pattern: regexp.MustCompile(`\d+`), Replacement: "N"}},
+			first:     `[{"metric":{"namespace":"shop","status":"500"},"value":[1700000000,"7"]}]`,
+			second:    `[{"metric":{"namespace":"shop","status":"503"},"value":[1700000000,"7"]}]`,
+			wantCount: 1,
+		},
+		{
+			name:      "instances stay apart under the IP mask",
+			first:     `[{"metric":{"namespace":"shop","instance":"10.0.0.1:8080"},"value":[1700000000,"7"]}]`,
+			second:    `[{"metric":{"namespace":"shop","instance":"10.0.0.2:8080"},"value":[1700000000,"7"]}]`,
+			wantCount: 1,
+		},
+		{
+			name:      "series in one evaluation",
+			first:     `[{"metric":{"namespace":"shop","status":"500"},"value":[1700000000,"7"]},{"metric":{"namespace":"shop","status":"502"},"value":[1700000000,"9"]}]`,
+			second:    `[]`,
+			wantCount: 2,
+		},
+		{
+			name:      "below threshold",
+			first:     `[{"metric":{"namespace":"shop"},"value":[1700000000,"1"]}]`,
+			second:    `[]`,
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &vectorServer{}
+			srv := httptest.NewServer(stub)
+			defer srv.Close()
+
+			var first, second []ParsedError
+			handler := &first
+			p := NewMetricPoller(NewClient(srv.URL), `sum by (namespace) (rate({app="shop"}[1m]))`, time.Minute,
+				Threshold{Op: OpAbove, Value: 5},
+				func(errors []ParsedError) { *handler = append(*handler, errors...) },
+				WithMetricLogger(discardLogger()),
+				WithMetricFingerprint(FingerprintConfig{Masks: tt.masks}),
+			)
+
+			stub.set(tt.first)
+			if err := p.evaluate(context.Background(), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if len(first) != tt.wantCount {
+				t.Fatalf("first evaluation raised %d errors, want %d", len(first), tt.wantCount)
+			}
+			if tt.wantCount == 2 && first[0].Fingerprint == first[1].Fingerprint {
+				t.Errorf("series in one evaluation share fingerprint %s", first[0].Fingerprint)
+			}
+
+			handler = &second
+			stub.set(tt.second)
+			if err := p.evaluate(context.Background(), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if len(first) != 1 || len(second) != 1 {
+				return
+			}
+
+			same := first[0].Fingerprint == second[0].Fingerprint
+			if same != tt.wantSame {
+				t.Errorf("same fingerprint = %v, want %v", same, tt.wantSame)
+			}
+			if second[0].Repeat != tt.wantSame {
+				t.Errorf("Repeat = %v, want %v", second[0].Repeat, tt.wantSame)
+			}
+		})
+	}
+}
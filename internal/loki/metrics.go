@@ -0,0 +1,64 @@
+package loki
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pollDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_sentinel_loki_poll_duration_seconds",
+		Help:    "Duration of a complete paginated Loki poll.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"source"})
+
+	pollErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_poll_errors_total",
+		Help: "Number of Loki polls that failed.",
+	}, []string{"source"})
+
+	pagesFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_pages_total",
+		Help: "Number of query_range pages fetched from Loki.",
+	}, []string{"source"})
+
+	pagesTruncated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_truncated_pages_total",
+		Help: "Number of query_range pages that hit the page size limit and required a follow-up page.",
+	}, []string{"source"})
+
+	windowsIncomplete = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_incomplete_windows_total",
+		Help: "Number of polls that stopped at max_pages before the window was exhausted.",
+	}, []string{"source"})
+
+	entriesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_entries_total",
+		Help: "Number of log entries received from Loki.",
+	}, []string{"source"})
+
+	entriesDuplicate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_duplicate_entries_total",
+		Help: "Number of log entries skipped because they were already ingested.",
+	}, []string{"source"})
+
+	requestRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_request_retries_total",
+		Help: "Number of Loki requests retried after a 429, 5xx or network error.",
+	})
+
+	circuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kube_sentinel_loki_circuit_open",
+		Help: "Whether the Loki circuit breaker is open (1) or closed (0).",
+	})
+
+	circuitTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kube_sentinel_loki_circuit_trips_total",
+		Help: "Number of times the Loki circuit breaker opened.",
+	})
+
+	templatesLearned = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kube_sentinel_log_templates",
+		Help: "Number of message templates currently learned by the template miner.",
+	})
+)
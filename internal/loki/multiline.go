@@ -0,0 +1,227 @@
+package loki
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// javaExceptionLine matches "java.lang.IllegalStateException: msg" and
+	// `Exception in thread "main" java.lang...`
+	javaExceptionLine = regexp.MustCompile(`^(Exception in thread "[^"]*" )?([a-zA-Z_$][\w$]*\.)+[\w$]*(Exception|Error|Throwable)\b`)
+
+	// goPanicLine matches the first line of a Go panic or fatal error
+	goPanicLine = regexp.MustCompile(`^(panic: |fatal error: )`)
+
+	// goTraceLine matches the unindented lines of a goroutine dump
+	goTraceLine = regexp.MustCompile(`^(goroutine \d+ \[.*\]:$|created by |exit status \d+$|\[signal |[\w./*()\[\]{}-]+\(.*\)$)`)
+)
+
+const (
+	pythonTraceback = "Traceback (most recent call last):"
+	pythonDuring    = "During handling of the above exception"
+	pythonCause     = "The above exception was the direct cause"
+)
+
+// assembler joins the continuation lines of stack traces into a single
+// entry. Lines are grouped per stream; a line continues the previous one
+// when it arrives within maxGap and looks like part of a trace.
+type assembler struct {
+	mu       sync.Mutex
+	maxGap   time.Duration
+	maxLines int
+	pending  map[string]*pendingTrace
+}
+
+// pendingTrace is an entry that may still receive continuation lines
+type pendingTrace struct {
+	entry LogEntry
+	lines []string
+	last  time.Time
+
+	goPanic    bool // started with a Go panic, so goroutine dumps continue it
+	python     bool // inside a Python traceback, which ends at the exception line
+	pythonSeen bool // a Python traceback was seen, so chained ones continue it
+}
+
+func newAssembler(maxGap time.Duration, maxLines int) *assembler {
+	return &assembler{
+		maxGap:   maxGap,
+		maxLines: maxLines,
+		pending:  make(map[string]*pendingTrace),
+	}
+}
+
+// add feeds entries through the assembler and returns the entries that are
+// complete. The last entry of each stream is held back until a line from
+// the same stream shows it has ended, or flush releases it.
+func (a *assembler) add(entries []LogEntry) []LogEntry {
+	sorted := make([]LogEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var complete []LogEntry
+	for _, entry := range sorted {
+		key := entry.Tenant + "/" + streamKey(entry.Labels)
+
+		if pt := a.pending[key]; pt != nil {
+			if entry.Timestamp.Sub(pt.last) <= a.maxGap && len(pt.lines) < a.maxLines && pt.continues(entry.Line) {
+				pt.append(entry)
+				continue
+			}
+			complete = append(complete, pt.finish())
+		}
+
+		a.pending[key] = newPendingTrace(entry)
+	}
+
+	return complete
+}
+
+// flush releases pending entries that can no longer be continued once
+// every line up to upTo has been seen. A zero upTo releases everything.
+func (a *assembler) flush(upTo time.Time) []LogEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cutoff := upTo.Add(-a.maxGap)
+
+	var complete []LogEntry
+	for key, pt := range a.pending {
+		if upTo.IsZero() || pt.last.Before(cutoff) {
+			complete = append(complete, pt.finish())
+			delete(a.pending, key)
+		}
+	}
+
+	sort.Slice(complete, func(i, j int) bool {
+		return complete[i].Timestamp.Before(complete[j].Timestamp)
+	})
+	return complete
+}
+
+func newPendingTrace(entry LogEntry) *pendingTrace {
+	python := strings.HasPrefix(entry.Line, pythonTraceback)
+	return &pendingTrace{
+		entry:      entry,
+		lines:      []string{strings.TrimRight(entry.Line, "\r\n")},
+		last:       entry.Timestamp,
+		goPanic:    goPanicLine.MatchString(entry.Line),
+		python:     python,
+		pythonSeen: python,
+	}
+}
+
+func (pt *pendingTrace) append(entry LogEntry) {
+	line := strings.TrimRight(entry.Line, "\r\n")
+	pt.lines = append(pt.lines, line)
+	pt.last = entry.Timestamp
+
+	switch {
+	case strings.HasPrefix(line, pythonTraceback):
+		pt.python = true
+		pt.pythonSeen = true
+	case pt.python && line != "" && !isIndented(line):
+		// The exception line ends the traceback
+		pt.python = false
+	}
+}
+
+// continues reports whether line is a continuation of the pending entry
+func (pt *pendingTrace) continues(line string) bool {
+	if pt.python {
+		return true
+	}
+
+	switch {
+	case line == "":
+		return pt.goPanic || pt.pythonSeen
+	case isIndented(line):
+		return true
+	case strings.HasPrefix(line, "Caused by: "),
+		strings.HasPrefix(line, "Suppressed: "):
+		// Only chained exceptions continue a Java trace; an unindented
+		// exception header starts a new one
+		return true
+	case strings.HasPrefix(line, pythonTraceback):
+		// logging.exception writes the message line before the traceback
+		return !pt.goPanic
+	case strings.HasPrefix(line, pythonDuring),
+		strings.HasPrefix(line, pythonCause):
+		return pt.pythonSeen
+	case pt.goPanic && goTraceLine.MatchString(line):
+		return true
+	}
+	return false
+}
+
+// finish returns the assembled entry, with lines joined by newlines
+func (pt *pendingTrace) finish() LogEntry {
+	lines := pt.lines
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	entry := pt.entry
+	if len(lines) > 1 {
+		entry.Line = strings.Join(lines, "\n")
+	}
+	return entry
+}
+
+// stackHeader picks the line describing the exception from an assembled
+// trace: the final exception line of a Python traceback, the first Java
+// exception or Go panic line, or otherwise the first line
+func stackHeader(text string) string {
+	lines := strings.Split(text, "\n")
+
+	header := ""
+	inTraceback := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, pythonTraceback):
+			inTraceback = true
+		case inTraceback && line != "" && !isIndented(line):
+			header = line
+			inTraceback = false
+		}
+	}
+	if header != "" {
+		return header
+	}
+
+	for _, line := range lines {
+		if javaExceptionLine.MatchString(line) || goPanicLine.MatchString(line) {
+			return line
+		}
+	}
+	return lines[0]
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+// streamKey identifies the stream an entry belongs to by its label set
+func streamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%q,", k, labels[k])
+	}
+	return b.String()
+}
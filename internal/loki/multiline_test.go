@@ -0,0 +1,218 @@
+package loki
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lineEntries turns lines into entries of one stream, 10ms apart
+func lineEntries(start time.Time, lines ...string) []LogEntry {
+	entries := make([]LogEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = LogEntry{
+			Timestamp: start.Add(time.Duration(i) * 10 * time.Millisecond),
+			Labels:    map[string]string{"pod": "web-0"},
+			Line:      line,
+		}
+	}
+	return entries
+}
+
+func TestAssembler(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLines int
+		lines    []string
+		want     []string
+	}{
+		{
+			name: "java trace with cause",
+			lines: []string{
+				"java.lang.IllegalStateException: boom",
+				"\tat com.example.Foo.bar(Foo.java:10)",
+				"Caused by: java.io.IOException: closed",
+				"\t... 3 more",
+				"INFO request done",
+			},
+			want: []string{
+				"java.lang.IllegalStateException: boom\n\tat com.example.Foo.bar(Foo.java:10)\nCaused by: java.io.IOException: closed\n\t... 3 more",
+				"INFO request done",
+			},
+		},
+		{
+			name: "java suppressed",
+			lines: []string{
+				"java.lang.RuntimeException: close failed",
+				"\tat com.example.Foo.close(Foo.java:20)",
+				"Suppressed: java.io.IOException: flush failed",
+				"\tat com.example.Foo.flush(Foo.java:30)",
+			},
+			want: []string{
+				"java.lang.RuntimeException: close failed\n\tat com.example.Foo.close(Foo.java:20)\nSuppressed: java.io.IOException: flush failed\n\tat com.example.Foo.flush(Foo.java:30)",
+			},
+		},
+		{
+			name: "unrelated java exceptions stay apart",
+			lines: []string{
+				"java.lang.IllegalStateException: first",
+				"\tat com.example.Foo.bar(Foo.java:10)",
+				"java.lang.NullPointerException: second",
+				"\tat com.example.Baz.qux(Baz.java:5)",
+			},
+			want: []string{
+				"java.lang.IllegalStateException: first\n\tat com.example.Foo.bar(Foo.java:10)",
+				"java.lang.NullPointerException: second\n\tat com.example.Baz.qux(Baz.java:5)",
+			},
+		},
+		{
+			name: "go panic with goroutine dump",
+			lines: []string{
+				"panic: runtime error: index out of range [3] with length 3",
+				"",
+				"goroutine 1 [running]:",
+				"main.handler(0x3)",
+				"\t/app/main.go:42 +0x1d",
+				"exit status 2",
+				"listening on :8080",
+			},
+			want: []string{
+				"panic: runtime error: index out of range [3] with length 3\n\ngoroutine 1 [running]:\nmain.handler(0x3)\n\t/app/main.go:42 +0x1d\nexit status 2",
+				"listening on :8080",
+			},
+		},
+		{
+			name: "python chained traceback",
+			lines: []string{
+				"Traceback (most recent call last):",
+				`  File "app.py", line 3, in <module>`,
+				"KeyError: 'id'",
+				"",
+				"During handling of the above exception, another exception occurred:",
+				"",
+				"Traceback (most recent call last):",
+				`  File "app.py", line 5, in <module>`,
+				"ValueError: bad id",
+				"GET /health 200",
+			},
+			want: []string{
+				"Traceback (most recent call last):\n  File \"app.py\", line 3, in <module>\nKeyError: 'id'\n\nDuring handling of the above exception, another exception occurred:\n\nTraceback (most recent call last):\n  File \"app.py\", line 5, in <module>\nValueError: bad id",
+				"GET /health 200",
+			},
+		},
+		{
+			name:     "max lines",
+			maxLines: 2,
+			lines: []string{
+				"java.lang.IllegalStateException: boom",
+				"\tat a.A.a(A.java:1)",
+				"\tat b.B.b(B.java:2)",
+			},
+			want: []string{
+				"java.lang.IllegalStateException: boom\n\tat a.A.a(A.java:1)",
+				"\tat b.B.b(B.java:2)",
+			},
+		},
+	}
+
+	start := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxLines := tt.maxLines
+			if maxLines == 0 {
+				maxLines = 500
+			}
+			a := newAssembler(time.Second, maxLines)
+
+			entries := a.add(lineEntries(start, tt.lines...))
+			entries = append(entries, a.flush(time.Time{})...)
+
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssemblerGapAndStreams(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	a := newAssembler(time.Second, 500)
+
+	header := LogEntry{Timestamp: start, Labels: map[string]string{"pod": "a"}, Line: "java.lang.IllegalStateException: boom"}
+	other := LogEntry{Timestamp: start.Add(100 * time.Millisecond), Labels: map[string]string{"pod": "b"}, Line: "\tat b.B.b(B.java:2)"}
+	frame := LogEntry{Timestamp: start.Add(200 * time.Millisecond), Labels: map[string]string{"pod": "a"}, Line: "\tat a.A.a(A.java:1)"}
+	late := LogEntry{Timestamp: start.Add(5 * time.Second), Labels: map[string]string{"pod": "a"}, Line: "\tat c.C.c(C.java:3)"}
+
+	if got := a.add([]LogEntry{header, other, frame}); len(got) != 0 {
+		t.Fatalf("add released %d entries, want 0 while traces may continue", len(got))
+	}
+
+	// Nothing is released until maxGap has passed since the last line
+	if got := a.flush(start.Add(time.Second)); len(got) != 0 {
+		t.Fatalf("flush released %d entries before maxGap passed", len(got))
+	}
+
+	got := a.add([]LogEntry{late})
+	if len(got) != 1 || got[0].Line != "java.lang.IllegalStateException: boom\n\tat a.A.a(A.java:1)" {
+		t.Fatalf("a line after maxGap must end the trace, got %q", got)
+	}
+
+	rest := a.flush(start.Add(10 * time.Second))
+	var lines []string
+	for _, e := range rest {
+		lines = append(lines, e.Line)
+	}
+	want := []string{"\tat b.B.b(B.java:2)", "\tat c.C.c(C.java:3)"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("flush = %q, want %q", lines, want)
+	}
+}
+
+func TestStackHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"java", "ERROR request failed\njava.lang.IllegalStateException: boom\n\tat a.A.a(A.java:1)", "java.lang.IllegalStateException: boom"},
+		{"go", "panic: nil map\n\ngoroutine 1 [running]:", "panic: nil map"},
+		{"python", "Traceback (most recent call last):\n  File \"app.py\", line 1\nKeyError: 'id'", "KeyError: 'id'"},
+		{"plain", "something failed\n  detail", "something failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stackHeader(tt.text); got != tt.want {
+				t.Errorf("stackHeader = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollerLineFilterAfterAssembly(t *testing.T) {
+	c := &errorCollector{}
+	r := NewReplayer(c.handle,
+		WithLogger(discardLogger()),
+		WithMultiline(time.Second, 500),
+		WithLineFilter(regexp.MustCompile(`Exception`)),
+	)
+
+	r.Replay(lineEntries(time.Unix(1700000000, 0),
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Foo.bar(Foo.java:10)",
+		"GET /health 200",
+	))
+
+	if len(c.errors) != 1 {
+		t.Fatalf("got %d errors, want only the trace", len(c.errors))
+	}
+	if !strings.Contains(c.errors[0].Raw, "Foo.java:10") {
+		t.Errorf("Raw = %q, want the continuation lines kept", c.errors[0].Raw)
+	}
+}
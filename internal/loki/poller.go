@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,19 +18,50 @@ type ParsedError struct {
 	ID          string
 	Fingerprint string
 	Timestamp   time.Time
+	Source      string // name of the query source that produced the error
+	Tenant      string // Loki tenant, when the source knows it
 	Namespace   string
 	Pod         string
+	Workload    string // pod name without its controller's random suffix
 	Container   string
 	Message     string
 	Labels      map[string]string
+	Fields      map[string]string // structured data extracted by the source
 	Raw         string
+
+	// TemplateID and Template identify the learned message template when
+	// template mining is enabled
+	TemplateID string
+	Template   string
+
+	// Repeat is set when the source already reported this fingerprint
+	// within its dedup window. Repeats are counted but not stored or
+	// remediated again.
+	Repeat bool
+
+	// Occurrences is how many occurrences the error stands for when the
+	// source reports several at once, e.g. the count increase of a
+	// Kubernetes event. Zero counts as one.
+	Occurrences int
 }
 
+var (
+	defaultFieldMapping = DefaultFieldMapping()
+	defaultFingerprint  = DefaultFingerprintConfig()
+
+	// messagePatterns extract the message from unstructured lines
+	messagePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(?:error|fatal|panic|exception|fail(?:ed|ure)?)\b[:\s]+(.+)`),
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T\s]\d{2}:\d{2}:\d{2}[^\s]*\s+\w+\s+(.+)`),
+	}
+)
+
 // ErrorHandler is called when new errors are found
 type ErrorHandler func([]ParsedError)
 
 // Poller continuously polls Loki for errors
 type Poller struct {
+	source       string
 	client       *Client
 	query        string
 	pollInterval time.Duration
@@ -37,11 +69,30 @@ type Poller struct {
 	handler      ErrorHandler
 	logger       *slog.Logger
 
+	// Pagination
+	pageSize int
+	maxPages int
+
 	// Deduplication
-	mu            sync.RWMutex
-	seenErrors    map[string]time.Time
-	windowSize    time.Duration
-	lastPollEnd   time.Time
+	seen        Dedup
+	mu          sync.RWMutex
+	seenEntries map[string]time.Time // entry hash -> entry timestamp
+	windowSize  time.Duration
+	lastPollEnd time.Time
+	now         func() time.Time // clock for the dedup window
+
+	// Structured field extraction and grouping
+	fieldMapping FieldMapping
+	fingerprint  FingerprintConfig
+
+	// Multi-line assembly, nil when disabled
+	assembler  *assembler
+	lineFilter *regexp.Regexp
+
+	// Persistence across restarts
+	checkpoints    CheckpointStore
+	checkpointName string
+	maxCatchUp     time.Duration
 }
 
 // PollerOption configures a Poller
@@ -54,6 +105,13 @@ func WithLogger(logger *slog.Logger) PollerOption {
 	}
 }
 
+// WithSource sets the source name used to tag errors, metrics and checkpoints
+func WithSource(name string) PollerOption {
+	return func(p *Poller) {
+		p.source = name
+	}
+}
+
 // WithWindowSize sets the deduplication window size
 func WithWindowSize(d time.Duration) PollerOption {
 	return func(p *Poller) {
@@ -61,17 +119,91 @@ func WithWindowSize(d time.Duration) PollerOption {
 	}
 }
 
+// WithPageSize sets the number of entries requested per query_range page
+func WithPageSize(n int) PollerOption {
+	return func(p *Poller) {
+		p.pageSize = n
+	}
+}
+
+// WithMaxPages caps the number of pages fetched in a single poll. A window
+// that is not exhausted is resumed on the next poll.
+func WithMaxPages(n int) PollerOption {
+	return func(p *Poller) {
+		p.maxPages = n
+	}
+}
+
+// WithFieldMapping sets the keys structured fields are read from
+func WithFieldMapping(m FieldMapping) PollerOption {
+	return func(p *Poller) {
+		p.fieldMapping = m
+	}
+}
+
+// WithFingerprint sets how errors are grouped into fingerprints
+func WithFingerprint(cfg FingerprintConfig) PollerOption {
+	return func(p *Poller) {
+		p.fingerprint = cfg
+	}
+}
+
+// WithMultiline joins stack trace continuation lines that follow within
+// maxGap of each other in the same stream, up to maxLines per entry.
+// A zero maxGap disables assembly.
+func WithMultiline(maxGap time.Duration, maxLines int) PollerOption {
+	return func(p *Poller) {
+		if maxGap > 0 {
+			p.assembler = newAssembler(maxGap, maxLines)
+		} else {
+			p.assembler = nil
+		}
+	}
+}
+
+// WithLineFilter only processes entries matching re; nil processes every
+// entry. Multi-line entries are filtered after assembly, so continuation
+// lines are kept when the header matches.
+func WithLineFilter(re *regexp.Regexp) PollerOption {
+	return func(p *Poller) {
+		p.lineFilter = re
+	}
+}
+
+// WithCheckpoint persists the poll watermark and dedup state under name
+func WithCheckpoint(store CheckpointStore, name string) PollerOption {
+	return func(p *Poller) {
+		p.checkpoints = store
+		p.checkpointName = name
+	}
+}
+
+// WithMaxCatchUp limits how far back a restored watermark is backfilled.
+// Anything older is skipped with a warning.
+func WithMaxCatchUp(d time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.maxCatchUp = d
+	}
+}
+
 // NewPoller creates a new Loki poller
 func NewPoller(client *Client, query string, pollInterval, lookback time.Duration, handler ErrorHandler, opts ...PollerOption) *Poller {
 	p := &Poller{
+		source:       "default",
 		client:       client,
 		query:        query,
 		pollInterval: pollInterval,
 		lookback:     lookback,
 		handler:      handler,
 		logger:       slog.Default(),
-		seenErrors:   make(map[string]time.Time),
+		pageSize:     1000,
+		maxPages:     50,
+		seenEntries:  make(map[string]time.Time),
 		windowSize:   30 * time.Minute,
+		now:          time.Now,
+		maxCatchUp:   time.Hour,
+		fieldMapping: DefaultFieldMapping(),
+		fingerprint:  DefaultFingerprintConfig(),
 	}
 
 	for _, opt := range opts {
@@ -81,18 +213,28 @@ func NewPoller(client *Client, query string, pollInterval, lookback time.Duratio
 	return p
 }
 
+// Name returns the source name the poller tags errors with
+func (p *Poller) Name() string {
+	return p.source
+}
+
 // Start begins the polling loop
 func (p *Poller) Start(ctx context.Context) error {
 	p.logger.Info("starting loki poller",
+		"source", p.source,
 		"query", p.query,
 		"poll_interval", p.pollInterval,
 		"lookback", p.lookback,
 	)
 
+	p.restoreCheckpoint()
+	defer p.saveCheckpoint()
+
 	// Do an initial poll immediately
 	if err := p.poll(ctx); err != nil {
 		p.logger.Error("initial poll failed", "error", err)
 	}
+	p.saveCheckpoint()
 
 	ticker := time.NewTicker(p.pollInterval)
 	defer ticker.Stop()
@@ -103,6 +245,7 @@ func (p *Poller) Start(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
+			p.flushMultiline(time.Time{})
 			p.logger.Info("stopping loki poller")
 			return ctx.Err()
 
@@ -110,6 +253,7 @@ func (p *Poller) Start(ctx context.Context) error {
 			if err := p.poll(ctx); err != nil {
 				p.logger.Error("poll failed", "error", err)
 			}
+			p.saveCheckpoint()
 
 		case <-cleanupTicker.C:
 			p.cleanupSeenErrors()
@@ -121,114 +265,342 @@ func (p *Poller) poll(ctx context.Context) error {
 	end := time.Now()
 	start := end.Add(-p.lookback)
 
-	// If we have a last poll time, use that to avoid re-fetching
-	if !p.lastPollEnd.IsZero() && p.lastPollEnd.After(start) {
+	// If we have a last poll time (possibly restored from a checkpoint),
+	// resume from it so nothing is missed, bounded by the catch-up limit
+	if !p.lastPollEnd.IsZero() {
 		start = p.lastPollEnd
+
+		maxCatchUp := p.maxCatchUp
+		if maxCatchUp < p.lookback {
+			maxCatchUp = p.lookback
+		}
+		if earliest := end.Add(-maxCatchUp); start.Before(earliest) {
+			p.logger.Warn("watermark older than max catch-up, skipping logs",
+				"watermark", start,
+				"resume_from", earliest,
+				"max_catch_up", maxCatchUp,
+			)
+			start = earliest
+		}
 	}
 
 	p.logger.Debug("polling loki", "start", start, "end", end)
 
-	entries, err := p.client.QueryRange(ctx, p.query, start, end, 1000)
+	timer := time.Now()
+	watermark, err := p.pollRange(ctx, start, end)
+	pollDuration.WithLabelValues(p.source).Observe(time.Since(timer).Seconds())
+
+	// Only advance past what was actually fetched so a failed or
+	// truncated poll is resumed rather than skipped
+	if watermark.After(p.lastPollEnd) {
+		p.lastPollEnd = watermark
+	}
+
+	// Traces still within the gap of the watermark may continue next poll
+	p.flushMultiline(watermark)
+
 	if err != nil {
+		pollErrors.WithLabelValues(p.source).Inc()
 		return fmt.Errorf("querying loki: %w", err)
 	}
 
-	p.lastPollEnd = end
+	return nil
+}
+
+// maxPageLimit is the largest page a single timestamp is widened to, Loki's
+// default max_entries_limit_per_query
+const maxPageLimit = 5000
 
-	if len(entries) == 0 {
-		return nil
+// pollRange fetches [start, end) page by page in ascending order and returns
+// the point up to which the window has been fully ingested
+func (p *Poller) pollRange(ctx context.Context, start, end time.Time) (time.Time, error) {
+	pageStart := start
+	limit := p.pageSize
+
+	for page := 1; ; page++ {
+		entries, err := p.client.QueryRangeDirection(ctx, p.query, pageStart, end, limit, DirectionForward)
+		if err != nil {
+			return pageStart, err
+		}
+
+		pagesFetched.WithLabelValues(p.source).Inc()
+		entriesReceived.WithLabelValues(p.source).Add(float64(len(entries)))
+
+		if len(entries) > 0 {
+			p.logger.Debug("received log entries", "count", len(entries), "page", page)
+			p.process(p.filterSeenEntries(entries))
+		}
+
+		if len(entries) < limit {
+			return end, nil
+		}
+
+		// The page was cut off by the limit; continue from the newest
+		// timestamp received. Start is inclusive, so entries sharing that
+		// timestamp are fetched again and dropped by the entry hash check.
+		pagesTruncated.WithLabelValues(p.source).Inc()
+
+		switch next := latestTimestamp(entries); {
+		case next.After(pageStart):
+			pageStart = next
+			limit = p.pageSize
+		case limit < maxPageLimit:
+			// Every entry shares the start timestamp, so the same page
+			// would come back; widen it until the timestamp fits
+			limit = min(limit*2, maxPageLimit)
+			p.logger.Debug("loki page filled by a single timestamp, widening page",
+				"timestamp", pageStart,
+				"limit", limit,
+			)
+		default:
+			p.logger.Warn("loki page filled by a single timestamp at the largest limit, skipping remaining entries at it",
+				"timestamp", pageStart,
+				"limit", limit,
+			)
+			pageStart = pageStart.Add(time.Nanosecond)
+			limit = p.pageSize
+		}
+
+		if page >= p.maxPages {
+			windowsIncomplete.WithLabelValues(p.source).Inc()
+			p.logger.Warn("loki poll stopped at max pages, resuming on next poll",
+				"source", p.source,
+				"max_pages", p.maxPages,
+				"resume_from", pageStart,
+				"window_end", end,
+			)
+			return pageStart, nil
+		}
 	}
+}
 
-	p.logger.Debug("received log entries", "count", len(entries))
+// filterSeenEntries drops entries already ingested by an overlapping page or window
+func (p *Poller) filterSeenEntries(entries []LogEntry) []LogEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Parse and deduplicate
-	var newErrors []ParsedError
+	fresh := entries[:0:0]
 	for _, entry := range entries {
-		parsed := p.parseEntry(entry)
-		if parsed == nil {
+		key := entryHash(entry)
+		if _, seen := p.seenEntries[key]; seen {
+			entriesDuplicate.WithLabelValues(p.source).Inc()
 			continue
 		}
+		p.seenEntries[key] = entry.Timestamp
+		fresh = append(fresh, entry)
+	}
+	return fresh
+}
+
+// process assembles multi-line entries and handles those that are complete
+func (p *Poller) process(entries []LogEntry) {
+	if p.assembler != nil {
+		entries = p.assembler.add(entries)
+	}
+	p.handleEntries(entries)
+}
+
+// flushMultiline handles assembled entries that can no longer be continued
+// once every line up to upTo has been seen. A zero upTo flushes everything.
+func (p *Poller) flushMultiline(upTo time.Time) {
+	if p.assembler != nil {
+		p.handleEntries(p.assembler.flush(upTo))
+	}
+}
 
-		if p.isNew(parsed.Fingerprint) {
-			newErrors = append(newErrors, *parsed)
-			p.markSeen(parsed.Fingerprint)
+// handleEntries parses entries, marks fingerprints seen within the dedup
+// window as repeats and hands every occurrence to the handler
+func (p *Poller) handleEntries(entries []LogEntry) {
+	if p.lineFilter != nil {
+		matched := entries[:0:0]
+		for _, entry := range entries {
+			if p.lineFilter.MatchString(entry.Line) {
+				matched = append(matched, entry)
+			}
 		}
+		entries = matched
 	}
 
-	if len(newErrors) > 0 {
-		p.logger.Info("found new errors", "count", len(newErrors))
-		p.handler(newErrors)
+	var parsedErrors []ParsedError
+	for _, entry := range entries {
+		if parsed := p.parseEntry(entry); parsed != nil {
+			parsedErrors = append(parsedErrors, *parsed)
+		}
 	}
 
-	return nil
+	if len(parsedErrors) > 0 {
+		newCount := p.seen.Mark(parsedErrors, p.now())
+		if newCount > 0 {
+			p.logger.Info("found new errors", "source", p.source, "count", newCount, "repeats", len(parsedErrors)-newCount)
+		}
+		p.handler(parsedErrors)
+	}
 }
 
 func (p *Poller) parseEntry(entry LogEntry) *ParsedError {
+	return ParseEntry(p.source, entry, p.fieldMapping, p.fingerprint)
+}
+
+// NewParsedError builds a ParsedError from a log entry using the default
+// field mapping. Other log backends use it so their errors group and
+// deduplicate the same way as Loki's.
+func NewParsedError(source string, entry LogEntry) *ParsedError {
+	return ParseEntry(source, entry, defaultFieldMapping, defaultFingerprint)
+}
+
+// ParseEntry builds a ParsedError from a log entry. JSON and logfmt lines
+// are parsed into structured fields using mapping, and the message is taken
+// from the message or error field when present. Errors with a stack trace
+// are fingerprinted by exception type and top in-app frames per fp, others
+// by their learned template when fp has a template miner.
+func ParseEntry(source string, entry LogEntry, mapping FieldMapping, fp FingerprintConfig) *ParsedError {
 	namespace := entry.Labels["namespace"]
 	pod := entry.Labels["pod"]
 	container := entry.Labels["container"]
 
-	// Try to extract structured info from the log line
-	message := extractMessage(entry.Line)
+	// Assembled stack traces are described by their exception header;
+	// structured fields can only come from the first line
+	line, multiline := entry.Line, false
+	if first, _, found := strings.Cut(entry.Line, "\n"); found {
+		line, multiline = first, true
+	}
+
+	values := ParseLine(line)
+	if len(entry.Attributes) > 0 {
+		if values == nil {
+			values = make(map[string]string, len(entry.Attributes))
+		}
+		for k, v := range entry.Attributes {
+			if _, exists := values[k]; !exists {
+				values[k] = v
+			}
+		}
+	}
+	fields := mapping.Extract(values)
+
+	var message string
+	if multiline {
+		message = stackHeader(entry.Line)
+	} else {
+		message = fields[FieldMessage]
+		if message == "" {
+			message = fields[FieldError]
+		}
+		if message == "" {
+			message = extractMessage(entry.Line)
+		}
+	}
+
+	// Generate fingerprint for deduplication. The same exception thrown
+	// from the same place groups together whatever its message says.
+	var fingerprint string
+	if st := findStackTrace(entry.Line, values); st != nil {
+		frames := st.InAppFrames(max(fp.StackFrames, 1), fp.ExcludeFrames)
+
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[FieldLanguage] = st.Language
+		fields[FieldExceptionType] = st.ExceptionType
+		if len(frames) > 0 {
+			fields[FieldTopFrame] = st.frameName(frames[0])
+		}
 
-	// Generate fingerprint for deduplication
-	fingerprint := generateFingerprint(namespace, pod, container, message)
+		if fp.StackFrames > 0 {
+			fingerprint = fp.stackFingerprint(namespace, pod, container, st, frames)
+		}
+	}
+	var templateID, template string
+	if fingerprint == "" && fp.Templates != nil {
+		templateID, template = fp.Templates.Add(fp.NormalizeMessage(message), entry.Timestamp)
+		if templateID != "" {
+			fingerprint = fp.templateFingerprint(namespace, pod, container, templateID)
+		}
+	}
+	if fingerprint == "" {
+		fingerprint = fp.Fingerprint(namespace, pod, container, message)
+	}
+	if entry.Tenant != "" {
+		// Teams sharing a Loki often reuse namespace and workload names
+		fingerprint = tenantFingerprint(entry.Tenant, fingerprint)
+	}
 
 	return &ParsedError{
 		ID:          generateID(),
 		Fingerprint: fingerprint,
 		Timestamp:   entry.Timestamp,
+		Source:      source,
+		Tenant:      entry.Tenant,
 		Namespace:   namespace,
 		Pod:         pod,
+		Workload:    fp.Workload(pod),
 		Container:   container,
 		Message:     message,
 		Labels:      entry.Labels,
+		Fields:      fields,
 		Raw:         entry.Line,
+		TemplateID:  templateID,
+		Template:    template,
 	}
 }
 
-func (p *Poller) isNew(fingerprint string) bool {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	_, seen := p.seenErrors[fingerprint]
-	return !seen
-}
+func (p *Poller) cleanupSeenErrors() {
+	now := p.now()
+	cutoff := now.Add(-p.windowSize)
+	remaining := p.seen.Cleanup(cutoff)
 
-func (p *Poller) markSeen(fingerprint string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.seenErrors[fingerprint] = time.Now()
+
+	// Entries older than both the window and the lookback can no longer be refetched
+	entryCutoff := cutoff
+	if lookbackCutoff := now.Add(-p.lookback); lookbackCutoff.Before(entryCutoff) {
+		entryCutoff = lookbackCutoff
+	}
+	for key, ts := range p.seenEntries {
+		if ts.Before(entryCutoff) {
+			delete(p.seenEntries, key)
+		}
+	}
+
+	p.logger.Debug("cleaned up seen errors", "remaining", remaining, "entries", len(p.seenEntries))
 }
 
-func (p *Poller) cleanupSeenErrors() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// entryHash identifies a single log entry by stream, timestamp and line
+func entryHash(entry LogEntry) string {
+	keys := make([]string, 0, len(entry.Labels))
+	for k := range entry.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	cutoff := time.Now().Add(-p.windowSize)
-	for fp, seenAt := range p.seenErrors {
-		if seenAt.Before(cutoff) {
-			delete(p.seenErrors, fp)
-		}
+	h := sha256.New()
+	if entry.Tenant != "" {
+		fmt.Fprintf(h, "%s/", entry.Tenant)
 	}
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%q,", k, entry.Labels[k])
+	}
+	fmt.Fprintf(h, "|%d|%s", entry.Timestamp.UnixNano(), entry.Line)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
 
-	p.logger.Debug("cleaned up seen errors", "remaining", len(p.seenErrors))
+// latestTimestamp returns the newest timestamp among entries
+func latestTimestamp(entries []LogEntry) time.Time {
+	var latest time.Time
+	for _, entry := range entries {
+		if entry.Timestamp.After(latest) {
+			latest = entry.Timestamp
+		}
+	}
+	return latest
 }
 
 // extractMessage attempts to extract a clean error message from a log line
 func extractMessage(line string) string {
-	// Try to extract JSON message field
-	if msg := extractJSONField(line, "message", "msg", "error", "err"); msg != "" {
-		return msg
-	}
-
 	// Try to extract common log format message
 	// e.g., "2024-01-01 10:00:00 ERROR some error message"
-	patterns := []*regexp.Regexp{
-		regexp.MustCompile(`(?i)\b(?:error|fatal|panic|exception|fail(?:ed|ure)?)\b[:\s]+(.+)`),
-		regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T\s]\d{2}:\d{2}:\d{2}[^\s]*\s+\w+\s+(.+)`),
-	}
-
-	for _, pattern := range patterns {
+	for _, pattern := range messagePatterns {
 		if matches := pattern.FindStringSubmatch(line); len(matches) > 1 {
 			return strings.TrimSpace(matches[1])
 		}
@@ -241,76 +613,6 @@ func extractMessage(line string) string {
 	return line
 }
 
-// extractJSONField tries to extract a field from a JSON log line
-func extractJSONField(line string, fields ...string) string {
-	for _, field := range fields {
-		// Simple regex-based extraction (faster than full JSON parsing)
-		pattern := regexp.MustCompile(fmt.Sprintf(`"%s"\s*:\s*"([^"]*)"`, field))
-		if matches := pattern.FindStringSubmatch(line); len(matches) > 1 {
-			return matches[1]
-		}
-	}
-	return ""
-}
-
-// generateFingerprint creates a fingerprint for deduplication
-// Uses namespace, pod base name, container, and normalized message
-func generateFingerprint(namespace, pod, container, message string) string {
-	// Normalize pod name by removing random suffix
-	// e.g., "my-app-7d4f8b9c5d-abc12" -> "my-app"
-	podBase := normalizePodName(pod)
-
-	// Normalize message by removing variable parts
-	normalizedMsg := normalizeMessage(message)
-
-	data := fmt.Sprintf("%s|%s|%s|%s", namespace, podBase, container, normalizedMsg)
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:8])
-}
-
-// normalizePodName removes the random suffix from pod names
-func normalizePodName(pod string) string {
-	// Match deployment pods: name-<replicaset-hash>-<pod-hash>
-	deployPattern := regexp.MustCompile(`^(.+)-[a-z0-9]{8,10}-[a-z0-9]{5}$`)
-	if matches := deployPattern.FindStringSubmatch(pod); len(matches) > 1 {
-		return matches[1]
-	}
-
-	// Match statefulset pods: name-<ordinal>
-	stsPattern := regexp.MustCompile(`^(.+)-\d+$`)
-	if matches := stsPattern.FindStringSubmatch(pod); len(matches) > 1 {
-		return matches[1]
-	}
-
-	// Match job pods: name-<random>
-	jobPattern := regexp.MustCompile(`^(.+)-[a-z0-9]{5}$`)
-	if matches := jobPattern.FindStringSubmatch(pod); len(matches) > 1 {
-		return matches[1]
-	}
-
-	return pod
-}
-
-// normalizeMessage removes variable parts from error messages
-func normalizeMessage(message string) string {
-	// Remove timestamps
-	msg := regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T\s]\d{2}:\d{2}:\d{2}[.\d]*[Z]?`).ReplaceAllString(message, "")
-
-	// Remove UUIDs
-	msg = regexp.MustCompile(`[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}`).ReplaceAllString(msg, "<UUID>")
-
-	// Remove hex IDs
-	msg = regexp.MustCompile(`\b[a-f0-9]{24,}\b`).ReplaceAllString(msg, "<ID>")
-
-	// Remove IP addresses
-	msg = regexp.MustCompile(`\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?`).ReplaceAllString(msg, "<IP>")
-
-	// Remove numbers (but keep error codes like 404, 500)
-	msg = regexp.MustCompile(`\b\d{6,}\b`).ReplaceAllString(msg, "<NUM>")
-
-	return strings.TrimSpace(msg)
-}
-
 // generateID creates a unique ID for an error
 func generateID() string {
 	data := fmt.Sprintf("%d-%d", time.Now().UnixNano(), time.Now().Nanosecond())
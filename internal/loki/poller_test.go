@@ -0,0 +1,246 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lokiStub serves forward query_range requests from a fixed set of
+// entries, honoring the inclusive start, exclusive end and limit like Loki
+type lokiStub struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	limits  []int
+}
+
+func (s *lokiStub) add(entries ...LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entries...)
+	sort.SliceStable(s.entries, func(i, j int) bool {
+		return s.entries[i].Timestamp.Before(s.entries[j].Timestamp)
+	})
+}
+
+func (s *lokiStub) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/loki/api/v1/query_range" {
+			http.NotFound(w, req)
+			return
+		}
+		q := req.URL.Query()
+		start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.limits = append(s.limits, limit)
+
+		var streams []Stream
+		for _, e := range s.entries {
+			ts := e.Timestamp.UnixNano()
+			if ts < start || ts >= end {
+				continue
+			}
+			if len(streams) == limit {
+				break
+			}
+			streams = append(streams, Stream{
+				Stream: e.Labels,
+				Values: [][]string{{strconv.FormatInt(ts, 10), e.Line}},
+			})
+		}
+		writeStreams(t, w, streams)
+	})
+}
+
+// stubEntries returns n error lines per timestamp
+func stubEntries(n int, timestamps ...time.Time) []LogEntry {
+	var entries []LogEntry
+	for _, ts := range timestamps {
+		for i := 0; i < n; i++ {
+			entries = append(entries, LogEntry{
+				Timestamp: ts,
+				Labels:    map[string]string{"namespace": "shop", "pod": "checkout-0"},
+				Line:      "error: request " + strconv.Itoa(i) + " failed at " + ts.Format(time.StampNano),
+			})
+		}
+	}
+	return entries
+}
+
+func TestPollerPagination(t *testing.T) {
+	base := time.Now().Add(-time.Minute).Truncate(time.Second)
+	at := func(seconds ...int) []time.Time {
+		var ts []time.Time
+		for _, s := range seconds {
+			ts = append(ts, base.Add(time.Duration(s)*time.Second))
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name       string
+		entries    []LogEntry
+		pageSize   int
+		maxPages   int
+		polls      int
+		wantLimits []int
+	}{
+		{
+			name:       "pages across timestamps",
+			entries:    stubEntries(1, at(0, 1, 2, 3, 4)...),
+			pageSize:   2,
+			maxPages:   10,
+			polls:      1,
+			wantLimits: []int{2, 2, 2, 2, 2},
+		},
+		{
+			name:       "single timestamp fills a page",
+			entries:    append(stubEntries(5, at(0)...), stubEntries(2, at(1)...)...),
+			pageSize:   3,
+			maxPages:   10,
+			polls:      1,
+			wantLimits: []int{3, 3, 6, 3},
+		},
+		{
+			name:       "single timestamp fills several pages",
+			entries:    stubEntries(13, at(0)...),
+			pageSize:   3,
+			maxPages:   10,
+			polls:      1,
+			wantLimits: []int{3, 3, 6, 12, 24},
+		},
+		{
+			name:       "max pages resumes on the next poll",
+			entries:    stubEntries(1, at(0, 1, 2, 3, 4, 5)...),
+			pageSize:   2,
+			maxPages:   2,
+			polls:      3,
+			wantLimits: []int{2, 2, 2, 2, 2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &lokiStub{}
+			stub.add(tt.entries...)
+			srv := httptest.NewServer(stub.handler(t))
+			defer srv.Close()
+
+			c := &errorCollector{}
+			p := NewPoller(NewClient(srv.URL), `{namespace="shop"}`, time.Minute, 5*time.Minute, c.handle,
+				WithLogger(discardLogger()),
+				WithPageSize(tt.pageSize),
+				WithMaxPages(tt.maxPages),
+			)
+			for i := 0; i < tt.polls; i++ {
+				if err := p.poll(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lines := make(map[string]int)
+			for _, e := range c.errors {
+				lines[e.Raw]++
+			}
+			for _, e := range tt.entries {
+				if n := lines[e.Line]; n != 1 {
+					t.Errorf("%q handled %d times, want 1", e.Line, n)
+				}
+			}
+			if len(c.errors) != len(tt.entries) {
+				t.Errorf("handled %d errors, want %d", len(c.errors), len(tt.entries))
+			}
+
+			stub.mu.Lock()
+			limits := stub.limits
+			stub.mu.Unlock()
+			if !reflect.DeepEqual(limits, tt.wantLimits) {
+				t.Errorf("limits = %v, want %v", limits, tt.wantLimits)
+			}
+		})
+	}
+}
+
+func TestPollerCheckpointResume(t *testing.T) {
+	base := time.Now().Add(-time.Minute).Truncate(time.Second)
+	stub := &lokiStub{}
+	stub.add(stubEntries(1, base, base.Add(time.Second))...)
+	srv := httptest.NewServer(stub.handler(t))
+	defer srv.Close()
+
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	newPoller := func(c *errorCollector) *Poller {
+		return NewPoller(NewClient(srv.URL), `{namespace="shop"}`, time.Minute, 5*time.Minute, c.handle,
+			WithLogger(discardLogger()),
+			WithCheckpoint(store, "app"),
+		)
+	}
+
+	first := &errorCollector{}
+	p := newPoller(first)
+	p.restoreCheckpoint()
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.errors) != 2 {
+		t.Fatalf("first run handled %d errors, want 2", len(first.errors))
+	}
+
+	// A poll cut off by max pages resumes from the last timestamp it
+	// fetched, so only the entry hashes from there on are saved
+	p.lastPollEnd = base.Add(time.Second)
+	p.saveCheckpoint()
+	cp, err := store.Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.SeenEntries) != 1 {
+		t.Errorf("saved %d entry hashes, want only the one at the watermark", len(cp.SeenEntries))
+	}
+
+	// After a restart one message repeats and one is new
+	now := time.Now()
+	repeat := stubEntries(1, now)[0]
+	repeat.Line = first.errors[0].Raw
+	fresh := stubEntries(1, now)[0]
+	fresh.Line = "error: payment declined"
+	stub.add(repeat, fresh)
+	time.Sleep(time.Millisecond)
+
+	second := &errorCollector{}
+	p = newPoller(second)
+	p.restoreCheckpoint()
+	if !p.lastPollEnd.Equal(base.Add(time.Second)) {
+		t.Fatalf("restored watermark %v, want %v", p.lastPollEnd, base.Add(time.Second))
+	}
+
+	// The entry at the watermark is fetched again; its restored hash drops it
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]bool)
+	for _, e := range second.errors {
+		got[e.Raw] = e.Repeat
+	}
+	if len(second.errors) != 2 {
+		t.Fatalf("second run handled %v, want only the two new entries", got)
+	}
+	if !got[repeat.Line] {
+		t.Errorf("%q not marked as a repeat after restore", repeat.Line)
+	}
+	if got[fresh.Line] {
+		t.Errorf("%q marked as a repeat", fresh.Line)
+	}
+}
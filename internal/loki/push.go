@@ -0,0 +1,427 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// PushRequest is the JSON body of a Loki push API request
+type PushRequest struct {
+	Streams []PushStream `json:"streams"`
+}
+
+// PushStream is a single stream in a push request. Values are
+// [timestamp, line] or [timestamp, line, structuredMetadata] tuples;
+// structured metadata is kept as entry attributes.
+type PushStream struct {
+	Stream map[string]string   `json:"stream"`
+	Values [][]json.RawMessage `json:"values"`
+}
+
+// PushReceiver implements the Loki push API so Promtail or Alloy can send
+// logs directly instead of kube-sentinel polling for them
+type PushReceiver struct {
+	poller  *Poller
+	maxBody int64
+	auth    *ReceiverAuth
+	tenants map[string]bool
+}
+
+// PushOption configures a PushReceiver
+type PushOption func(*PushReceiver)
+
+// WithMaxBodySize limits the decompressed size of a push request
+func WithMaxBodySize(n int64) PushOption {
+	return func(r *PushReceiver) {
+		r.maxBody = n
+	}
+}
+
+// WithPushAuth requires requests to pass auth
+func WithPushAuth(auth *ReceiverAuth) PushOption {
+	return func(r *PushReceiver) {
+		r.auth = auth
+	}
+}
+
+// WithAllowedTenants only accepts requests whose X-Scope-OrgID header names
+// one of tenants. No tenants accepts any request, with or without a tenant.
+func WithAllowedTenants(tenants ...string) PushOption {
+	return func(r *PushReceiver) {
+		r.tenants = nil
+		for _, tenant := range tenants {
+			if r.tenants == nil {
+				r.tenants = make(map[string]bool, len(tenants))
+			}
+			r.tenants[tenant] = true
+		}
+	}
+}
+
+// NewPushReceiver creates a new push receiver. The poller options configure
+// the source name, logger and deduplication shared with Poller.
+func NewPushReceiver(handler ErrorHandler, pollerOpts []PollerOption, opts ...PushOption) *PushReceiver {
+	r := &PushReceiver{
+		poller:  NewPoller(nil, "", time.Minute, 5*time.Minute, handler, pollerOpts...),
+		maxBody: 10 << 20,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Name returns the source name the receiver tags errors with
+func (r *PushReceiver) Name() string {
+	return r.poller.source
+}
+
+// Start runs periodic dedup cleanup until ctx is cancelled. Entries arrive
+// through ServeHTTP.
+func (r *PushReceiver) Start(ctx context.Context) error {
+	p := r.poller
+	p.logger.Info("starting loki push receiver", "source", p.source)
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	flushTicker := time.NewTicker(time.Second)
+	defer flushTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.flushMultiline(time.Time{})
+			p.logger.Info("stopping loki push receiver", "source", p.source)
+			return ctx.Err()
+		case <-ticker.C:
+			p.cleanupSeenErrors()
+		case <-flushTicker.C:
+			p.flushMultiline(time.Now())
+		}
+	}
+}
+
+// ServeHTTP handles POST /loki/api/v1/push
+func (r *PushReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p := r.poller
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.auth.Check(req); err != nil {
+		p.logger.Warn("rejected push request", "source", p.source, "remote", req.RemoteAddr, "error", err)
+		r.auth.Reject(w, err)
+		return
+	}
+
+	// Promtail and Alloy send the tenant they push for
+	tenant := req.Header.Get("X-Scope-OrgID")
+	if r.tenants != nil && !r.tenants[tenant] {
+		p.logger.Warn("rejected push request for tenant", "source", p.source, "tenant", tenant, "remote", req.RemoteAddr)
+		http.Error(w, fmt.Sprintf("tenant %q is not allowed", tenant), http.StatusForbidden)
+		return
+	}
+
+	body, err := ReadBody(w, req, r.maxBody)
+	if err != nil {
+		p.logger.Warn("failed to read push request", "source", p.source, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	var entries []LogEntry
+	switch contentType {
+	case "application/json":
+		entries, err = decodePushJSON(body)
+	case "application/x-protobuf", "":
+		entries, err = decodePushProto(body, r.maxBody)
+	default:
+		err = fmt.Errorf("unsupported content type %q", contentType)
+	}
+	if err != nil {
+		p.logger.Warn("failed to decode push request", "source", p.source, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if tenant != "" {
+		for i := range entries {
+			entries[i].Tenant = tenant
+		}
+	}
+
+	entriesReceived.WithLabelValues(p.source).Add(float64(len(entries)))
+
+	if len(entries) > 0 {
+		p.process(p.filterSeenEntries(entries))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodePushJSON decodes the JSON push format
+func decodePushJSON(body []byte) ([]LogEntry, error) {
+	var push PushRequest
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	}
+
+	var entries []LogEntry
+	for _, s := range push.Streams {
+		for _, value := range s.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("entry must have a timestamp and a line")
+			}
+
+			var tsStr, line string
+			if err := json.Unmarshal(value[0], &tsStr); err != nil {
+				return nil, fmt.Errorf("decoding timestamp: %w", err)
+			}
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, fmt.Errorf("decoding line: %w", err)
+			}
+
+			ts, err := strconv.ParseInt(tsStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing timestamp %q: %w", tsStr, err)
+			}
+
+			entry := LogEntry{
+				Timestamp: time.Unix(0, ts),
+				Labels:    s.Stream,
+				Line:      line,
+			}
+			if len(value) > 2 {
+				if err := json.Unmarshal(value[2], &entry.Attributes); err != nil {
+					return nil, fmt.Errorf("decoding structured metadata: %w", err)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// decodePushProto decodes the snappy-compressed logproto.PushRequest format
+func decodePushProto(body []byte, maxSize int64) ([]LogEntry, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading snappy header: %w", err)
+	}
+	if int64(size) > maxSize {
+		return nil, fmt.Errorf("decompressed body exceeds %d bytes", maxSize)
+	}
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing snappy body: %w", err)
+	}
+
+	var entries []LogEntry
+	err = walkProto(data, func(num protowire.Number, v []byte) error {
+		// PushRequest.streams = 1
+		if num != 1 {
+			return nil
+		}
+		stream, err := decodeProtoStream(v)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, stream...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decoding protobuf: %w", err)
+	}
+
+	return entries, nil
+}
+
+// decodeProtoStream decodes a logproto.StreamAdapter message
+func decodeProtoStream(data []byte) ([]LogEntry, error) {
+	var labels map[string]string
+	var entries []LogEntry
+	err := walkProto(data, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1: // labels
+			parsed, err := ParseLabels(string(v))
+			if err != nil {
+				return err
+			}
+			labels = parsed
+		case 2: // entries
+			entry, err := decodeProtoEntry(v)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Labels may be encoded after the entries
+	for i := range entries {
+		entries[i].Labels = labels
+	}
+	return entries, nil
+}
+
+// decodeProtoEntry decodes a logproto.EntryAdapter message
+func decodeProtoEntry(data []byte) (LogEntry, error) {
+	var entry LogEntry
+	err := walkProto(data, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1: // timestamp
+			var seconds, nanos uint64
+			if err := walkProtoVarints(v, func(num protowire.Number, x uint64) {
+				switch num {
+				case 1:
+					seconds = x
+				case 2:
+					nanos = x
+				}
+			}); err != nil {
+				return err
+			}
+			entry.Timestamp = time.Unix(int64(seconds), int64(nanos))
+		case 2: // line
+			entry.Line = string(v)
+		case 3: // structuredMetadata
+			var name, value string
+			if err := walkProto(v, func(num protowire.Number, v []byte) error {
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if entry.Attributes == nil {
+				entry.Attributes = make(map[string]string)
+			}
+			entry.Attributes[name] = value
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// walkProto calls fn for every length-delimited field in a message,
+// skipping fields of other wire types
+func walkProto(data []byte, fn func(num protowire.Number, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkProtoVarints calls fn for every varint field in a message
+func walkProtoVarints(data []byte, fn func(num protowire.Number, v uint64)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.VarintType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		fn(num, v)
+	}
+	return nil
+}
+
+// ParseLabels parses a Prometheus-style label set such as
+// {namespace="default", pod="web-1"}
+func ParseLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid label set %q", s)
+	}
+	s = s[1 : len(s)-1]
+
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return labels, nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid label set: missing '=' in %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		rest := strings.TrimSpace(s[eq+1:])
+
+		value, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label value for %s: %w", name, err)
+		}
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label value for %s: %w", name, err)
+		}
+
+		labels[name] = unquoted
+		s = rest[len(value):]
+	}
+}
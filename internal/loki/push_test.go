@@ -0,0 +1,339 @@
+package loki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// goldenPushEntries are the entries encoded in testdata/push.json and
+// testdata/push.pb.sz
+var goldenPushEntries = []LogEntry{
+	{
+		Timestamp:  time.Unix(1700000000, 500),
+		Labels:     map[string]string{"namespace": "shop", "pod": "checkout-7d9f8-abcde", "container": "app"},
+		Line:       `level=error msg="payment failed" order=42`,
+		Attributes: map[string]string{"trace_id": "abc123"},
+	},
+	{
+		Timestamp: time.Unix(1700000001, 0),
+		Labels:    map[string]string{"namespace": "shop", "pod": "checkout-7d9f8-abcde", "container": "app"},
+		Line:      "panic: runtime error: index out of range",
+	},
+	{
+		Timestamp: time.Unix(1700000002, 250000000),
+		Labels:    map[string]string{"namespace": "auth", "pod": "login-0"},
+		Line:      `{"level":"error","msg":"token expired"}`,
+	},
+}
+
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodePushGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		decode func([]byte) ([]LogEntry, error)
+	}{
+		{"json", "push.json", decodePushJSON},
+		{"protobuf", "push.pb.sz", func(b []byte) ([]LogEntry, error) { return decodePushProto(b, 1<<20) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := tt.decode(readGolden(t, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(goldenPushEntries) {
+				t.Fatalf("decoded %d entries, want %d", len(entries), len(goldenPushEntries))
+			}
+			for i, want := range goldenPushEntries {
+				got := entries[i]
+				if !got.Timestamp.Equal(want.Timestamp) {
+					t.Errorf("entry %d timestamp = %v, want %v", i, got.Timestamp, want.Timestamp)
+				}
+				if got.Line != want.Line {
+					t.Errorf("entry %d line = %q, want %q", i, got.Line, want.Line)
+				}
+				if !reflect.DeepEqual(got.Labels, want.Labels) {
+					t.Errorf("entry %d labels = %v, want %v", i, got.Labels, want.Labels)
+				}
+				if len(got.Attributes) != 0 || len(want.Attributes) != 0 {
+					if !reflect.DeepEqual(got.Attributes, want.Attributes) {
+						t.Errorf("entry %d attributes = %v, want %v", i, got.Attributes, want.Attributes)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodePushErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		decode func([]byte) ([]LogEntry, error)
+	}{
+		{"json syntax", []byte(`{"streams":`), decodePushJSON},
+		{"json missing line", []byte(`{"streams":[{"stream":{},"values":[["1"]]}]}`), decodePushJSON},
+		{"json bad timestamp", []byte(`{"streams":[{"stream":{},"values":[["soon","x"]]}]}`), decodePushJSON},
+		{"not snappy", []byte("plain text"), func(b []byte) ([]LogEntry, error) { return decodePushProto(b, 1<<20) }},
+		{"over max size", readGolden(t, "push.pb.sz"), func(b []byte) ([]LogEntry, error) { return decodePushProto(b, 16) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.decode(tt.body); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: `{}`, want: map[string]string{}},
+		{in: `{namespace="shop", pod="web-1"}`, want: map[string]string{"namespace": "shop", "pod": "web-1"}},
+		{in: `{msg="a \"quoted\", value"}`, want: map[string]string{"msg": `a "quoted", value`}},
+		{in: `namespace="shop"`, wantErr: true},
+		{in: `{namespace}`, wantErr: true},
+		{in: `{namespace=shop}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLabels(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// errorCollector records every error handed to it
+type errorCollector struct {
+	mu     sync.Mutex
+	errors []ParsedError
+}
+
+func (c *errorCollector) handle(errors []ParsedError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors = append(c.errors, errors...)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPushReceiverServeHTTP(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonBody := readGolden(t, "push.json")
+
+	tests := []struct {
+		name       string
+		opts       []PushOption
+		pollerOpts []PollerOption
+		headers    map[string]string
+		body       []byte
+		wantStatus int
+		wantErrors int
+		wantTenant string
+	}{
+		{
+			name:       "unauthenticated without auth",
+			headers:    map[string]string{"Content-Type": "application/json"},
+			body:       jsonBody,
+			wantStatus: http.StatusNoContent,
+			wantErrors: 3,
+		},
+		{
+			name:       "protobuf is the default content type",
+			body:       readGolden(t, "push.pb.sz"),
+			wantStatus: http.StatusNoContent,
+			wantErrors: 3,
+		},
+		{
+			name:       "gzip encoded",
+			headers:    map[string]string{"Content-Type": "application/json", "Content-Encoding": "gzip"},
+			body:       gzipped(t, jsonBody),
+			wantStatus: http.StatusNoContent,
+			wantErrors: 3,
+		},
+		{
+			name:       "missing token",
+			opts:       []PushOption{WithPushAuth(NewReceiverAuth("s3cret", ""))},
+			headers:    map[string]string{"Content-Type": "application/json"},
+			body:       jsonBody,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			opts:       []PushOption{WithPushAuth(NewReceiverAuth("s3cret", ""))},
+			headers:    map[string]string{"Content-Type": "application/json", "Authorization": "Bearer guess"},
+			body:       jsonBody,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token",
+			opts:       []PushOption{WithPushAuth(NewReceiverAuth("s3cret", ""))},
+			headers:    map[string]string{"Content-Type": "application/json", "Authorization": "Bearer s3cret"},
+			body:       jsonBody,
+			wantStatus: http.StatusNoContent,
+			wantErrors: 3,
+		},
+		{
+			name:       "token file",
+			opts:       []PushOption{WithPushAuth(NewReceiverAuth("", tokenFile))},
+			headers:    map[string]string{"Content-Type": "application/json", "Authorization": "Bearer s3cret"},
+			body:       jsonBody,
+			wantStatus: http.StatusNoContent,
+			wantErrors: 3,
+		},
+		{
+			name:       "tenant tags entries",
+			headers:    map[string]string{"Content-Type": "application/json", "X-Scope-OrgID": "team-a"},
+			body:       jsonBody,
+			wantStatus: http.StatusNoContent,
+			wantErrors: 3,
+			wantTenant: "team-a",
+		},
+		{
+			name:       "allowed tenant",
+			opts:       []PushOption{WithAllowedTenants("team-a", "team-b")},
+			headers:    map[string]string{"Content-Type": "application/json", "X-Scope-OrgID": "team-b"},
+			body:       jsonBody,
+			wantStatus: http.StatusNoContent,
+			wantErrors: 3,
+			wantTenant: "team-b",
+		},
+		{
+			name:       "tenant not allowed",
+			opts:       []PushOption{WithAllowedTenants("team-a")},
+			headers:    map[string]string{"Content-Type": "application/json", "X-Scope-OrgID": "team-b"},
+			body:       jsonBody,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing tenant with allowed tenants",
+			opts:       []PushOption{WithAllowedTenants("team-a")},
+			headers:    map[string]string{"Content-Type": "application/json"},
+			body:       jsonBody,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "line filter",
+			pollerOpts: []PollerOption{WithLineFilter(regexp.MustCompile("panic"))},
+			headers:    map[string]string{"Content-Type": "application/json"},
+			body:       jsonBody,
+			wantStatus: http.StatusNoContent,
+			wantErrors: 1,
+		},
+		{
+			name:       "body too large",
+			opts:       []PushOption{WithMaxBodySize(64)},
+			headers:    map[string]string{"Content-Type": "application/json"},
+			body:       jsonBody,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unsupported content type",
+			headers:    map[string]string{"Content-Type": "text/plain"},
+			body:       []byte("error"),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &errorCollector{}
+			pollerOpts := append([]PollerOption{WithLogger(discardLogger())}, tt.pollerOpts...)
+			r := NewPushReceiver(c.handle, pollerOpts, tt.opts...)
+
+			req := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", bytes.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", rec.Code, strings.TrimSpace(rec.Body.String()), tt.wantStatus)
+			}
+			if len(c.errors) != tt.wantErrors {
+				t.Fatalf("handled %d errors, want %d", len(c.errors), tt.wantErrors)
+			}
+			for _, e := range c.errors {
+				if e.Tenant != tt.wantTenant {
+					t.Errorf("tenant = %q, want %q", e.Tenant, tt.wantTenant)
+				}
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestPushReceiverDeduplicates(t *testing.T) {
+	c := &errorCollector{}
+	r := NewPushReceiver(c.handle, []PollerOption{WithLogger(discardLogger())})
+
+	body := readGolden(t, "push.json")
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The retried request carries the same entries, which are dropped
+	if len(c.errors) != 3 {
+		t.Fatalf("handled %d errors, want 3", len(c.errors))
+	}
+	for _, e := range c.errors {
+		if e.Repeat {
+			t.Errorf("%q marked as a repeat", e.Message)
+		}
+	}
+}
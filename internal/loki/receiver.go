@@ -0,0 +1,91 @@
+package loki
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthorized is returned for receiver requests without the expected
+// bearer token
+var ErrUnauthorized = errors.New("missing or invalid bearer token")
+
+// ReceiverAuth checks the bearer token of requests to a log receiver such
+// as the push API. A nil ReceiverAuth accepts every request.
+type ReceiverAuth struct {
+	token     string
+	tokenFile *tokenFile
+}
+
+// NewReceiverAuth requires requests to carry token, or the token in the
+// file at path, as a bearer token. The file is re-read when it changes so
+// the token can be rotated. It returns nil when both are empty.
+func NewReceiverAuth(token, path string) *ReceiverAuth {
+	switch {
+	case path != "":
+		return &ReceiverAuth{tokenFile: &tokenFile{path: path}}
+	case token != "":
+		return &ReceiverAuth{token: token}
+	default:
+		return nil
+	}
+}
+
+// Check returns ErrUnauthorized unless req carries the expected token
+func (a *ReceiverAuth) Check(req *http.Request) error {
+	if a == nil {
+		return nil
+	}
+
+	want := a.token
+	if a.tokenFile != nil {
+		var err error
+		if want, err = a.tokenFile.Token(); err != nil {
+			return err
+		}
+	}
+
+	got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Reject writes the response for a request that failed Check
+func (a *ReceiverAuth) Reject(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUnauthorized) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kube-sentinel"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, "authentication unavailable", http.StatusInternalServerError)
+}
+
+// ReadBody reads a receiver request body of at most maxBody bytes, undoing
+// any gzip content encoding
+func ReadBody(w http.ResponseWriter, req *http.Request, maxBody int64) ([]byte, error) {
+	var reader io.Reader = http.MaxBytesReader(w, req.Body, maxBody)
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = io.LimitReader(gz, maxBody+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	if int64(len(body)) > maxBody {
+		return nil, fmt.Errorf("request body exceeds %d bytes", maxBody)
+	}
+	return body, nil
+}
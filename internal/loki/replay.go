@@ -0,0 +1,135 @@
+package loki
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Export formats accepted by ReadExport
+const (
+	ExportAuto  = "auto"
+	ExportLoki  = "loki"  // query_range JSON response
+	ExportLines = "lines" // newline-delimited log lines
+)
+
+// ReadExport reads log entries from a Loki query_range JSON response or a
+// newline-delimited log file. Lines are given labels and take their
+// timestamp from a leading RFC 3339 timestamp; lines without one reuse the
+// previous line's timestamp, starting at start. ExportAuto picks the Loki
+// format when the input is a query_range response.
+func ReadExport(r io.Reader, format string, labels map[string]string, start time.Time) ([]LogEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading export: %w", err)
+	}
+
+	if format == ExportAuto {
+		format = ExportLines
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			var probe struct {
+				Data *json.RawMessage `json:"data"`
+			}
+			if json.Unmarshal(trimmed, &probe) == nil && probe.Data != nil {
+				format = ExportLoki
+			}
+		}
+	}
+
+	switch format {
+	case ExportLoki:
+		var resp QueryResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("decoding query_range response: %w", err)
+		}
+		return resp.Data.entries()
+
+	case ExportLines:
+		return readLines(data, labels, start)
+
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func readLines(data []byte, labels map[string]string, start time.Time) ([]LogEntry, error) {
+	var entries []LogEntry
+	ts := start
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 10<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if first, _, _ := strings.Cut(line, " "); first != "" {
+			if t, err := time.Parse(time.RFC3339Nano, first); err == nil {
+				ts = t
+			}
+		}
+
+		entries = append(entries, LogEntry{
+			Timestamp: ts,
+			Labels:    labels,
+			Line:      line,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading lines: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Replayer feeds exported log entries through the same multi-line assembly,
+// parsing, fingerprinting and deduplication as a Poller. The dedup window
+// follows the entries' timestamps instead of the wall clock, so repeats are
+// marked as they were when the logs were written.
+type Replayer struct {
+	poller      *Poller
+	clock       time.Time
+	lastCleanup time.Time
+}
+
+// NewReplayer creates a replayer. The poller options configure the source
+// name, field mapping, fingerprinting, multi-line assembly and dedup window.
+func NewReplayer(handler ErrorHandler, opts ...PollerOption) *Replayer {
+	r := &Replayer{}
+	r.poller = NewPoller(nil, "", time.Minute, 5*time.Minute, handler, opts...)
+	r.poller.now = func() time.Time { return r.clock }
+	return r
+}
+
+// Replay processes entries in timestamp order and flushes any pending
+// multi-line entries at the end
+func (r *Replayer) Replay(entries []LogEntry) {
+	sorted := make([]LogEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	p := r.poller
+	for _, entry := range sorted {
+		r.clock = entry.Timestamp
+		if r.lastCleanup.IsZero() {
+			r.lastCleanup = r.clock
+		}
+		if r.clock.Sub(r.lastCleanup) >= 5*time.Minute {
+			p.cleanupSeenErrors()
+			r.lastCleanup = r.clock
+		}
+
+		p.flushMultiline(r.clock)
+		p.process(p.filterSeenEntries([]LogEntry{entry}))
+	}
+
+	p.flushMultiline(time.Time{})
+}
@@ -0,0 +1,295 @@
+package loki
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Languages recognised in stack traces
+const (
+	LanguageJava   = "java"
+	LanguageGo     = "go"
+	LanguagePython = "python"
+)
+
+var (
+	// javaFrameLine matches "\tat com.example.Foo.bar(Foo.java:42)"
+	javaFrameLine = regexp.MustCompile(`^\s+at\s+([^\s(]+)\(([^)]*)\)`)
+
+	// goFrameLine matches "github.com/example/pkg.(*T).Method(0xc000010000)"
+	goFrameLine = regexp.MustCompile(`^(\S.*)\(.*\)$`)
+
+	// goFileLine matches "\t/src/app/main.go:12 +0x1d"
+	goFileLine = regexp.MustCompile(`^\s+(\S+\.go):\d+`)
+
+	// pythonFrameLine matches `  File "/app/views.py", line 12, in handler`
+	pythonFrameLine = regexp.MustCompile(`^\s+File "([^"]+)", line \d+, in (\S+)`)
+
+	// pythonExceptionLine matches "ValueError: msg" and "pkg.errors.Error"
+	pythonExceptionLine = regexp.MustCompile(`^([A-Za-z_][\w.]*)(:|$)`)
+)
+
+// stackTraceKeys are the JSON/logfmt keys structured loggers put stack
+// traces under
+var stackTraceKeys = []string{"stack_trace", "stacktrace", "stack", "exception.stacktrace", "error.stack", "err.stack"}
+
+// defaultExcludedFrames are library frames skipped when picking in-app
+// frames. Go standard library frames are recognised by their import path.
+var defaultExcludedFrames = []string{
+	// Java and JVM languages
+	"java.", "javax.", "jdk.", "sun.", "com.sun.", "kotlin.", "kotlinx.", "scala.",
+	"org.springframework.", "org.apache.", "org.eclipse.jetty.", "org.hibernate.",
+	"io.netty.", "io.grpc.", "reactor.", "com.fasterxml.", "com.google.common.",
+	// Python, matched against the file path
+	"<frozen ", "/usr/lib/python", "/usr/local/lib/python",
+}
+
+// StackFrame is a single frame of a stack trace
+type StackFrame struct {
+	Function string
+	File     string
+}
+
+// StackTrace is a parsed stack trace. Frames are ordered from the most
+// recent call.
+type StackTrace struct {
+	Language      string
+	ExceptionType string
+	Frames        []StackFrame
+}
+
+// ParseStackTrace parses a Java, Go or Python stack trace. It returns nil
+// when text doesn't contain one.
+func ParseStackTrace(text string) *StackTrace {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+
+	for _, parse := range []func([]string) *StackTrace{parsePythonStack, parseJavaStack, parseGoStack} {
+		if st := parse(lines); st != nil {
+			return st
+		}
+	}
+	return nil
+}
+
+// parseJavaStack reads the outermost exception and its frames
+func parseJavaStack(lines []string) *StackTrace {
+	var st *StackTrace
+	for _, line := range lines {
+		if st == nil {
+			if javaExceptionLine.MatchString(line) {
+				st = &StackTrace{Language: LanguageJava, ExceptionType: javaExceptionType(line)}
+			}
+			continue
+		}
+
+		if m := javaFrameLine.FindStringSubmatch(line); m != nil {
+			function := m[1]
+			// Strip class loader and module prefixes, e.g. "app//" or
+			// "java.base/"
+			if i := strings.LastIndex(function, "/"); i >= 0 {
+				function = function[i+1:]
+			}
+			file, _, _ := strings.Cut(m[2], ":")
+			st.Frames = append(st.Frames, StackFrame{Function: function, File: file})
+			continue
+		}
+
+		// Frames of "Caused by:" exceptions belong to the cause
+		if !isIndented(line) {
+			break
+		}
+	}
+
+	if st == nil || len(st.Frames) == 0 {
+		return nil
+	}
+	return st
+}
+
+func javaExceptionType(line string) string {
+	if strings.HasPrefix(line, "Exception in thread ") {
+		if i := strings.Index(line[len("Exception in thread \""):], "\" "); i >= 0 {
+			line = line[len("Exception in thread \"")+i+2:]
+		}
+	}
+	typ, _, _ := strings.Cut(line, ":")
+	return strings.TrimSpace(typ)
+}
+
+// parseGoStack reads the panicking goroutine of a Go panic
+func parseGoStack(lines []string) *StackTrace {
+	var st *StackTrace
+	inGoroutine := false
+	for _, line := range lines {
+		if st == nil {
+			if goPanicLine.MatchString(line) {
+				st = &StackTrace{Language: LanguageGo, ExceptionType: goPanicType(line)}
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "goroutine ") {
+			if inGoroutine {
+				break
+			}
+			inGoroutine = true
+			continue
+		}
+		if !inGoroutine {
+			continue
+		}
+
+		if m := goFileLine.FindStringSubmatch(line); m != nil {
+			if n := len(st.Frames); n > 0 && st.Frames[n-1].File == "" {
+				st.Frames[n-1].File = m[1]
+			}
+			continue
+		}
+		if line == "" {
+			if len(st.Frames) > 0 {
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "created by ") {
+			break
+		}
+		if m := goFrameLine.FindStringSubmatch(line); m != nil {
+			st.Frames = append(st.Frames, StackFrame{Function: m[1]})
+		}
+	}
+
+	if st == nil || len(st.Frames) == 0 {
+		return nil
+	}
+	return st
+}
+
+// goPanicType classifies a panic line, e.g. "panic: runtime error: index
+// out of range" is a "runtime error" and other panics are just "panic"
+func goPanicType(line string) string {
+	if strings.HasPrefix(line, "fatal error: ") {
+		return "fatal error"
+	}
+	if strings.HasPrefix(line, "panic: runtime error: ") {
+		return "runtime error"
+	}
+	return "panic"
+}
+
+// parsePythonStack reads the last traceback, which is the exception that
+// was finally raised
+func parsePythonStack(lines []string) *StackTrace {
+	var st *StackTrace
+	var frames []StackFrame
+	inTraceback := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, pythonTraceback):
+			inTraceback = true
+			frames = nil
+		case !inTraceback:
+		case isIndented(line):
+			if m := pythonFrameLine.FindStringSubmatch(line); m != nil {
+				frames = append(frames, StackFrame{Function: m[2], File: m[1]})
+			}
+		case line != "":
+			inTraceback = false
+			if m := pythonExceptionLine.FindStringSubmatch(line); m != nil && len(frames) > 0 {
+				// Tracebacks list the most recent call last
+				for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+					frames[i], frames[j] = frames[j], frames[i]
+				}
+				st = &StackTrace{Language: LanguagePython, ExceptionType: m[1], Frames: frames}
+			}
+		}
+	}
+	return st
+}
+
+// InAppFrames returns up to n frames that aren't library code, most recent
+// first. When every frame is library code the top n frames are returned.
+func (st *StackTrace) InAppFrames(n int, exclude []string) []StackFrame {
+	var frames []StackFrame
+	for _, f := range st.Frames {
+		if len(frames) == n {
+			break
+		}
+		if !st.isLibraryFrame(f, exclude) {
+			frames = append(frames, f)
+		}
+	}
+
+	if len(frames) == 0 {
+		frames = st.Frames
+		if len(frames) > n {
+			frames = frames[:n]
+		}
+	}
+	return frames
+}
+
+func (st *StackTrace) isLibraryFrame(f StackFrame, exclude []string) bool {
+	for _, list := range [][]string{defaultExcludedFrames, exclude} {
+		for _, prefix := range list {
+			if strings.HasPrefix(f.Function, prefix) || strings.HasPrefix(f.File, prefix) {
+				return true
+			}
+		}
+	}
+
+	switch st.Language {
+	case LanguageGo:
+		return isGoStdlib(f.Function)
+	case LanguagePython:
+		return strings.Contains(f.File, "/site-packages/") || strings.Contains(f.File, "/dist-packages/")
+	}
+	return false
+}
+
+// isGoStdlib reports whether a Go function belongs to the standard
+// library, whose import paths have no dot in the first element
+func isGoStdlib(function string) bool {
+	pkg := function
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		if j := strings.Index(pkg[i:], "."); j >= 0 {
+			pkg = pkg[:i+j]
+		}
+	} else if j := strings.Index(pkg, "."); j >= 0 {
+		pkg = pkg[:j]
+	}
+
+	first, _, _ := strings.Cut(pkg, "/")
+	return pkg != "main" && !strings.Contains(first, ".")
+}
+
+// frameName identifies a frame independently of line numbers and install
+// paths, so redeploys don't change the fingerprint
+func (st *StackTrace) frameName(f StackFrame) string {
+	if st.Language == LanguagePython {
+		return path.Base(f.File) + ":" + f.Function
+	}
+	return f.Function
+}
+
+// findStackTrace looks for a stack trace in an assembled multi-line entry
+// or under one of the usual stack trace keys of a structured line
+func findStackTrace(line string, values map[string]string) *StackTrace {
+	if strings.Contains(line, "\n") {
+		if st := ParseStackTrace(line); st != nil {
+			return st
+		}
+	}
+	for _, key := range stackTraceKeys {
+		if v := values[key]; strings.Contains(v, "\n") {
+			if st := ParseStackTrace(v); st != nil {
+				return st
+			}
+		}
+	}
+	return nil
+}
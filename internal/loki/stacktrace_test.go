@@ -0,0 +1,170 @@
+package loki
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStackTrace(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want *StackTrace
+	}{
+		{
+			name: "java",
+			text: "java.lang.IllegalStateException: boom\n" +
+				"\tat app//com.example.Orders.place(Orders.java:10)\n" +
+				"\tat java.base/java.lang.Thread.run(Thread.java:833)\n" +
+				"Caused by: java.io.IOException: closed\n" +
+				"\tat com.example.Db.query(Db.java:5)",
+			want: &StackTrace{
+				Language:      LanguageJava,
+				ExceptionType: "java.lang.IllegalStateException",
+				Frames: []StackFrame{
+					{Function: "com.example.Orders.place", File: "Orders.java"},
+					{Function: "java.lang.Thread.run", File: "Thread.java"},
+				},
+			},
+		},
+		{
+			name: "java thread",
+			text: "Exception in thread \"main\" java.lang.NullPointerException\n\tat com.example.Main.main(Main.java:3)",
+			want: &StackTrace{
+				Language:      LanguageJava,
+				ExceptionType: "java.lang.NullPointerException",
+				Frames:        []StackFrame{{Function: "com.example.Main.main", File: "Main.java"}},
+			},
+		},
+		{
+			name: "go panic",
+			text: "panic: runtime error: invalid memory address or nil pointer dereference\n" +
+				"[signal SIGSEGV: segmentation violation]\n\n" +
+				"goroutine 1 [running]:\n" +
+				"github.com/example/app/orders.(*Service).Place(0x0)\n" +
+				"\t/src/orders/service.go:42 +0x1d\n" +
+				"main.main()\n" +
+				"\t/src/main.go:12 +0x25\n\n" +
+				"goroutine 7 [select]:\n" +
+				"net/http.(*conn).serve(0xc000)\n",
+			want: &StackTrace{
+				Language:      LanguageGo,
+				ExceptionType: "runtime error",
+				Frames: []StackFrame{
+					{Function: "github.com/example/app/orders.(*Service).Place", File: "/src/orders/service.go"},
+					{Function: "main.main", File: "/src/main.go"},
+				},
+			},
+		},
+		{
+			name: "python chained",
+			text: "Traceback (most recent call last):\n" +
+				"  File \"/app/db.py\", line 3, in query\n" +
+				"KeyError: 'id'\n\n" +
+				"During handling of the above exception, another exception occurred:\n\n" +
+				"Traceback (most recent call last):\n" +
+				"  File \"/app/views.py\", line 10, in handler\n" +
+				"  File \"/app/orders.py\", line 5, in place\n" +
+				"ValueError: bad order",
+			want: &StackTrace{
+				Language:      LanguagePython,
+				ExceptionType: "ValueError",
+				Frames: []StackFrame{
+					{Function: "place", File: "/app/orders.py"},
+					{Function: "handler", File: "/app/views.py"},
+				},
+			},
+		},
+		{
+			name: "no frames",
+			text: "java.lang.IllegalStateException: boom\nsomething else",
+			want: nil,
+		},
+		{
+			name: "plain text",
+			text: "connection refused\n  retrying",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseStackTrace(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseStackTrace = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInAppFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		st      StackTrace
+		n       int
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "java skips library frames",
+			st: StackTrace{Language: LanguageJava, Frames: []StackFrame{
+				{Function: "org.springframework.web.Dispatcher.run"},
+				{Function: "com.example.Orders.place"},
+				{Function: "java.lang.Thread.run"},
+				{Function: "com.example.Main.main"},
+			}},
+			n:    3,
+			want: []string{"com.example.Orders.place", "com.example.Main.main"},
+		},
+		{
+			name: "custom exclusions",
+			st: StackTrace{Language: LanguageJava, Frames: []StackFrame{
+				{Function: "com.example.lib.Retry.run"},
+				{Function: "com.example.Orders.place"},
+			}},
+			n:       3,
+			exclude: []string{"com.example.lib."},
+			want:    []string{"com.example.Orders.place"},
+		},
+		{
+			name: "go skips the standard library",
+			st: StackTrace{Language: LanguageGo, Frames: []StackFrame{
+				{Function: "runtime.panicmem"},
+				{Function: "github.com/example/app.Handler"},
+				{Function: "net/http.HandlerFunc.ServeHTTP"},
+				{Function: "main.main"},
+			}},
+			n:    2,
+			want: []string{"github.com/example/app.Handler", "main.main"},
+		},
+		{
+			name: "python keys frames by file",
+			st: StackTrace{Language: LanguagePython, Frames: []StackFrame{
+				{Function: "get", File: "/usr/lib/python3/site-packages/requests/api.py"},
+				{Function: "place", File: "/app/orders.py"},
+			}},
+			n:    3,
+			want: []string{"orders.py:place"},
+		},
+		{
+			name: "all library frames",
+			st: StackTrace{Language: LanguageJava, Frames: []StackFrame{
+				{Function: "java.lang.Thread.run"},
+				{Function: "java.util.concurrent.Executor.run"},
+			}},
+			n:    1,
+			want: []string{"java.lang.Thread.run"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range tt.st.InAppFrames(tt.n, tt.exclude) {
+				got = append(got, tt.st.frameName(f))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InAppFrames = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TailResponse represents a message pushed by the Loki tail API
+type TailResponse struct {
+	Streams        []Stream       `json:"streams"`
+	DroppedEntries []DroppedEntry `json:"dropped_entries"`
+}
+
+// DroppedEntry identifies an entry Loki could not deliver to a tail client
+type DroppedEntry struct {
+	Labels    map[string]string `json:"labels"`
+	Timestamp string            `json:"timestamp"`
+}
+
+// Tail opens a WebSocket connection to the Loki tail API starting at start
+func (c *Client) Tail(ctx context.Context, query string, start time.Time) (*websocket.Conn, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("delay_for", "0")
+
+	wsURL := c.baseURL
+	switch {
+	case strings.HasPrefix(wsURL, "https://"):
+		wsURL = "wss://" + strings.TrimPrefix(wsURL, "https://")
+	case strings.HasPrefix(wsURL, "http://"):
+		wsURL = "ws://" + strings.TrimPrefix(wsURL, "http://")
+	}
+	reqURL := fmt.Sprintf("%s/loki/api/v1/tail?%s", wsURL, params.Encode())
+
+	header := http.Header{}
+	if err := c.setAuthHeaders(header); err != nil {
+		return nil, err
+	}
+
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: c.httpClient.Timeout,
+		TLSClientConfig:  c.tlsConfig,
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, reqURL, header)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			c.breaker.abort()
+		case resp == nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			c.breaker.failure(err)
+		default:
+			c.breaker.success()
+		}
+		if resp != nil {
+			return nil, fmt.Errorf("opening tail connection (status %d): %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("opening tail connection: %w", err)
+	}
+	c.breaker.success()
+
+	return conn, nil
+}
+
+// tailMessage is a message read from a tail connection
+type tailMessage struct {
+	data []byte
+	err  error
+}
+
+// streamWatermarks tracks the newest entry received from each stream of a
+// tail connection. Streams can lag behind each other, so a reconnect has to
+// backfill from the oldest of them; entries received twice are dropped by
+// the entry hash check. A stream more than maxLag behind the newest entry
+// is taken to be quiet rather than lagging and no longer holds it back.
+type streamWatermarks struct {
+	start  time.Time // where the connection started tailing
+	maxLag time.Duration
+	latest map[string]time.Time
+	newest time.Time
+}
+
+func newStreamWatermarks(start time.Time, maxLag time.Duration) *streamWatermarks {
+	return &streamWatermarks{start: start, maxLag: maxLag, latest: make(map[string]time.Time)}
+}
+
+// observe records the entries of a tail message
+func (w *streamWatermarks) observe(entries []LogEntry) {
+	for _, entry := range entries {
+		key := streamKey(entry.Labels)
+		if entry.Timestamp.After(w.latest[key]) {
+			w.latest[key] = entry.Timestamp
+		}
+		if entry.Timestamp.After(w.newest) {
+			w.newest = entry.Timestamp
+		}
+	}
+}
+
+// watermark returns the point every active stream has been received up
+// to, or the start of the connection before any entry arrived
+func (w *streamWatermarks) watermark() time.Time {
+	if len(w.latest) == 0 {
+		return w.start
+	}
+
+	mark := w.newest
+	cutoff := w.newest.Add(-w.maxLag)
+	for key, latest := range w.latest {
+		if latest.Before(cutoff) {
+			delete(w.latest, key)
+			continue
+		}
+		if latest.Before(mark) {
+			mark = latest
+		}
+	}
+	return mark
+}
+
+// droppedSpan returns the time span of entries Loki dropped
+func droppedSpan(dropped []DroppedEntry) (first, last time.Time) {
+	for _, d := range dropped {
+		ns, err := strconv.ParseInt(d.Timestamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		ts := time.Unix(0, ns)
+		if first.IsZero() || ts.Before(first) {
+			first = ts
+		}
+		if ts.After(last) {
+			last = ts
+		}
+	}
+	return first, last
+}
+
+// Tailer streams errors from the Loki tail API, falling back to range
+// queries to fill any gap left by a disconnect
+type Tailer struct {
+	poller      *Poller
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	idleTimeout time.Duration
+
+	checkpointInterval time.Duration
+	flushInterval      time.Duration
+}
+
+// NewTailer creates a new Loki tailer. The options are shared with Poller,
+// which the tailer uses for parsing, deduplication and gap backfill.
+func NewTailer(client *Client, query string, lookback time.Duration, handler ErrorHandler, opts ...PollerOption) *Tailer {
+	return &Tailer{
+		poller:      NewPoller(client, query, lookback, lookback, handler, opts...),
+		minBackoff:  time.Second,
+		maxBackoff:  time.Minute,
+		idleTimeout: 2 * time.Minute,
+
+		checkpointInterval: 30 * time.Second,
+		flushInterval:      time.Second,
+	}
+}
+
+// Name returns the source name the tailer tags errors with
+func (t *Tailer) Name() string {
+	return t.poller.source
+}
+
+// Start connects to the tail API and keeps reconnecting until ctx is done
+func (t *Tailer) Start(ctx context.Context) error {
+	p := t.poller
+	p.logger.Info("starting loki tailer",
+		"source", p.source,
+		"query", p.query,
+		"lookback", p.lookback,
+	)
+
+	p.restoreCheckpoint()
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.cleanupSeenErrors()
+			}
+		}
+	}()
+
+	backoff := t.minBackoff
+	for {
+		// Fill the gap since the last received entry (or the lookback
+		// window on first connect) before streaming again
+		if err := p.poll(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Error("tail backfill failed", "error", err)
+		}
+
+		p.saveCheckpoint()
+
+		connectedAt := time.Now()
+		err := t.stream(ctx)
+		p.saveCheckpoint()
+		if ctx.Err() != nil {
+			p.flushMultiline(time.Time{})
+			p.logger.Info("stopping loki tailer")
+			return ctx.Err()
+		}
+
+		// A connection that stayed up for a while resets the backoff
+		if time.Since(connectedAt) > t.maxBackoff {
+			backoff = t.minBackoff
+		}
+
+		p.logger.Warn("loki tail disconnected, reconnecting", "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			p.logger.Info("stopping loki tailer")
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > t.maxBackoff {
+			backoff = t.maxBackoff
+		}
+	}
+}
+
+// stream reads tail responses until the connection fails or ctx is done
+func (t *Tailer) stream(ctx context.Context) error {
+	p := t.poller
+
+	start := p.lastPollEnd
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	conn, err := p.client.Tail(ctx, p.query, start)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock ReadMessage when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(t.idleTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(t.idleTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(5*time.Second))
+	})
+
+	// Messages are read on their own goroutine so the loop below can also
+	// flush streamed traces without racing entry processing
+	messages := make(chan tailMessage)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err == nil {
+				conn.SetReadDeadline(time.Now().Add(t.idleTimeout))
+			}
+			select {
+			case messages <- tailMessage{data: data, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Streamed traces are released once no continuation has arrived
+	// within the gap
+	flushTicker := time.NewTicker(t.flushInterval)
+	defer flushTicker.Stop()
+
+	p.logger.Debug("loki tail connected", "start", start)
+
+	marks := newStreamWatermarks(start, p.lookback)
+
+	// Entries Loki dropped are fetched with a range query over their time
+	// span on the next tick; until then the watermark stays before them so
+	// a reconnect backfills them too
+	var droppedStart, droppedEnd time.Time
+	advance := func() {
+		p.lastPollEnd = marks.watermark()
+		if !droppedStart.IsZero() && droppedStart.Before(p.lastPollEnd) {
+			p.lastPollEnd = droppedStart
+		}
+	}
+
+	lastSave := time.Now()
+	for {
+		var msg tailMessage
+		select {
+		case <-flushTicker.C:
+			p.flushMultiline(time.Now())
+			if !droppedStart.IsZero() {
+				if _, err := p.pollRange(ctx, droppedStart, droppedEnd.Add(time.Nanosecond)); err != nil {
+					p.logger.Warn("backfilling dropped tail entries failed, retrying", "error", err)
+					continue
+				}
+				droppedStart, droppedEnd = time.Time{}, time.Time{}
+				advance()
+			}
+			continue
+		case msg = <-messages:
+		}
+		if msg.err != nil {
+			return fmt.Errorf("reading tail message: %w", msg.err)
+		}
+
+		var resp TailResponse
+		if err := json.Unmarshal(msg.data, &resp); err != nil {
+			p.logger.Warn("failed to decode tail message", "error", err)
+			continue
+		}
+
+		if first, last := droppedSpan(resp.DroppedEntries); !first.IsZero() {
+			p.logger.Warn("loki dropped tail entries, backfilling them",
+				"count", len(resp.DroppedEntries),
+				"start", first,
+				"end", last,
+			)
+			if droppedStart.IsZero() || first.Before(droppedStart) {
+				droppedStart = first
+			}
+			if last.After(droppedEnd) {
+				droppedEnd = last
+			}
+			advance()
+		}
+
+		entries := parseStreams(resp.Streams)
+		if len(entries) == 0 {
+			continue
+		}
+		p.client.tagTenant(entries)
+
+		// Advance the watermark so a reconnect backfills from here
+		marks.observe(entries)
+		advance()
+
+		p.process(p.filterSeenEntries(entries))
+
+		if time.Since(lastSave) >= t.checkpointInterval {
+			p.saveCheckpoint()
+			lastSave = time.Now()
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeStreams writes a query_range response holding streams
+func writeStreams(t *testing.T, w http.ResponseWriter, streams []Stream) {
+	t.Helper()
+	result, err := json.Marshal(streams)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QueryResponse{
+		Status: "success",
+		Data:   QueryData{ResultType: ResultStreams, Result: result},
+	})
+}
+
+// TestTailerFlushesStreamedTraces runs with -race: pending traces are
+// flushed while tail messages keep arriving
+func TestTailerFlushesStreamedTraces(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	labels := map[string]string{"namespace": "shop", "pod": "checkout-0"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/loki/api/v1/query_range":
+			writeStreams(t, w, nil)
+		case "/loki/api/v1/tail":
+			conn, err := upgrader.Upgrade(w, req, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			now := time.Now()
+			for i := 0; i < 20; i++ {
+				ts := now.Add(time.Duration(i) * 100 * time.Millisecond)
+				conn.WriteJSON(TailResponse{Streams: []Stream{{
+					Stream: labels,
+					Values: [][]string{
+						{strconv.FormatInt(ts.UnixNano(), 10), "java.lang.IllegalStateException: boom " + strconv.Itoa(i)},
+						{strconv.FormatInt(ts.Add(time.Millisecond).UnixNano(), 10), "\tat com.example.Foo.bar(Foo.java:10)"},
+					},
+				}}})
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			// Keep the connection open until the client goes away
+			conn.ReadMessage()
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	c := &errorCollector{}
+	tailer := NewTailer(NewClient(srv.URL), `{namespace="shop"}`, time.Minute, c.handle,
+		WithLogger(discardLogger()),
+		WithMultiline(10*time.Millisecond, 500),
+	)
+	tailer.flushInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		tailer.Start(ctx)
+		close(stopped)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		n := len(c.errors)
+		c.mu.Unlock()
+		if n >= 19 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("flushed %d traces, want at least 19 before shutdown", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-stopped
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.errors) != 20 {
+		t.Fatalf("got %d errors, want 20", len(c.errors))
+	}
+	for _, e := range c.errors {
+		if !strings.Contains(e.Raw, "Foo.java:10") {
+			t.Errorf("Raw = %q, want the frame joined to its exception", e.Raw)
+		}
+	}
+}
+
+func TestTailerBackfill(t *testing.T) {
+	type tailEntry struct {
+		labels map[string]string
+		at     time.Duration // before the start of the test
+		line   string
+	}
+	app := map[string]string{"namespace": "shop", "pod": "checkout-0"}
+	worker := map[string]string{"namespace": "shop", "pod": "worker-0"}
+
+	tests := []struct {
+		name string
+		// streamed over the first tail connection
+		streamed []tailEntry
+		dropped  []tailEntry
+		// only available to range queries once the tail connected
+		late []tailEntry
+		// close the first connection once everything was sent
+		disconnect bool
+	}{
+		{
+			name: "lagging stream after a reconnect",
+			streamed: []tailEntry{
+				{app, time.Second, "error: app failed"},
+				{worker, 5 * time.Second, "error: worker failed 1"},
+			},
+			late:       []tailEntry{{worker, 4 * time.Second, "error: worker failed 2"}},
+			disconnect: true,
+		},
+		{
+			name:     "dropped entries",
+			streamed: []tailEntry{{app, time.Second, "error: app failed"}},
+			dropped:  []tailEntry{{worker, 3 * time.Second, "error: worker failed"}},
+			late:     []tailEntry{{worker, 3 * time.Second, "error: worker failed"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := time.Now()
+			entry := func(e tailEntry) LogEntry {
+				return LogEntry{Timestamp: base.Add(-e.at), Labels: e.labels, Line: e.line}
+			}
+
+			stub := &lokiStub{}
+			upgrader := websocket.Upgrader{}
+			connections := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/loki/api/v1/tail" {
+					stub.handler(t).ServeHTTP(w, req)
+					return
+				}
+				conn, err := upgrader.Upgrade(w, req, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				stub.mu.Lock()
+				connections++
+				first := connections == 1
+				stub.mu.Unlock()
+
+				if first {
+					var resp TailResponse
+					for _, e := range tt.streamed {
+						resp.Streams = append(resp.Streams, Stream{
+							Stream: e.labels,
+							Values: [][]string{{strconv.FormatInt(base.Add(-e.at).UnixNano(), 10), e.line}},
+						})
+					}
+					for _, e := range tt.dropped {
+						resp.DroppedEntries = append(resp.DroppedEntries, DroppedEntry{
+							Labels:    e.labels,
+							Timestamp: strconv.FormatInt(base.Add(-e.at).UnixNano(), 10),
+						})
+					}
+					for _, e := range tt.late {
+						stub.add(entry(e))
+					}
+					conn.WriteJSON(resp)
+					if tt.disconnect {
+						return
+					}
+				}
+
+				// Keep the connection open until the client goes away
+				conn.ReadMessage()
+			}))
+			defer srv.Close()
+
+			c := &errorCollector{}
+			tailer := NewTailer(NewClient(srv.URL), `{namespace="shop"}`, time.Minute, c.handle,
+				WithLogger(discardLogger()),
+			)
+			tailer.minBackoff = time.Millisecond
+			tailer.flushInterval = time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				tailer.Start(ctx)
+				close(stopped)
+			}()
+
+			want := len(tt.streamed) + len(tt.late)
+			if len(tt.dropped) > 0 {
+				want = len(tt.streamed) + len(tt.dropped)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				c.mu.Lock()
+				n := len(c.errors)
+				c.mu.Unlock()
+				if n >= want {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("handled %d errors, want %d", n, want)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			cancel()
+			<-stopped
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			lines := make(map[string]int)
+			for _, e := range c.errors {
+				lines[e.Raw]++
+			}
+			for _, e := range append(tt.streamed, tt.late...) {
+				if lines[e.line] != 1 {
+					t.Errorf("%q handled %d times, want 1", e.line, lines[e.line])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package loki
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Wildcard marks the variable positions of a learned template
+const Wildcard = "<*>"
+
+// TemplateMinerConfig sizes the template miner
+type TemplateMinerConfig struct {
+	// Similarity is the fraction of tokens a message must share with a
+	// template to be folded into it
+	Similarity float64
+
+	// Depth is the depth of the routing tree: the root, the token count
+	// level, one level per leading token and the leaves. Messages sharing
+	// their first Depth-3 tokens are compared against the same templates.
+	Depth int
+
+	// MaxChildren caps the children per routing node; further tokens
+	// share a wildcard branch
+	MaxChildren int
+
+	// MaxTemplates caps the number of templates kept. The least recently
+	// seen template is forgotten when it is exceeded.
+	MaxTemplates int
+
+	// ParamSamples is the number of distinct values kept per wildcard
+	ParamSamples int
+}
+
+// DefaultTemplateMinerConfig returns the settings recommended by the Drain paper
+func DefaultTemplateMinerConfig() TemplateMinerConfig {
+	return TemplateMinerConfig{
+		Similarity:   0.4,
+		Depth:        4,
+		MaxChildren:  100,
+		MaxTemplates: 5000,
+		ParamSamples: 10,
+	}
+}
+
+// Template is a learned message template with its parameter samples
+type Template struct {
+	ID        string
+	Template  string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// Params holds sample values for each wildcard, in order
+	Params [][]string
+}
+
+// TemplateMiner learns message templates online using the Drain algorithm.
+// Messages are routed through a fixed-depth tree by token count and their
+// leading tokens, then folded into the most similar template in the leaf,
+// with differing tokens replaced by wildcards. A template keeps the ID it
+// was created with as it generalizes, so it can serve as a stable
+// fingerprint basis. It is safe for concurrent use.
+type TemplateMiner struct {
+	cfg TemplateMinerConfig
+
+	mu       sync.Mutex
+	root     *drainNode
+	clusters map[string]*cluster
+	lru      *list.List // of *cluster, most recently seen first
+}
+
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*cluster
+}
+
+type cluster struct {
+	id        string
+	tokens    []string
+	params    map[int][]string // token position -> samples
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+	leaf      *drainNode
+	elem      *list.Element
+}
+
+// NewTemplateMiner creates a template miner, filling unset values from
+// DefaultTemplateMinerConfig
+func NewTemplateMiner(cfg TemplateMinerConfig) *TemplateMiner {
+	def := DefaultTemplateMinerConfig()
+	if cfg.Similarity <= 0 {
+		cfg.Similarity = def.Similarity
+	}
+	if cfg.Depth < 3 {
+		cfg.Depth = def.Depth
+	}
+	if cfg.MaxChildren < 1 {
+		cfg.MaxChildren = def.MaxChildren
+	}
+	if cfg.MaxTemplates < 1 {
+		cfg.MaxTemplates = def.MaxTemplates
+	}
+	if cfg.ParamSamples < 0 {
+		cfg.ParamSamples = 0
+	}
+
+	return &TemplateMiner{
+		cfg:      cfg,
+		root:     newDrainNode(),
+		clusters: make(map[string]*cluster),
+		lru:      list.New(),
+	}
+}
+
+func newDrainNode() *drainNode {
+	return &drainNode{children: make(map[string]*drainNode)}
+}
+
+// Add learns from a message and returns the ID and current text of the
+// template it belongs to
+func (m *TemplateMiner) Add(message string, seenAt time.Time) (id, template string) {
+	tokens := strings.Fields(message)
+	if len(tokens) == 0 {
+		return "", ""
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	leaf := m.route(tokens)
+
+	c := m.bestMatch(leaf, tokens)
+	if c == nil {
+		c = m.newCluster(leaf, tokens, seenAt)
+	} else {
+		c.merge(tokens, m.cfg.ParamSamples)
+		m.lru.MoveToFront(c.elem)
+	}
+
+	c.count++
+	if seenAt.After(c.lastSeen) {
+		c.lastSeen = seenAt
+	}
+	if seenAt.Before(c.firstSeen) {
+		c.firstSeen = seenAt
+	}
+
+	templatesLearned.Set(float64(len(m.clusters)))
+	return c.id, strings.Join(c.tokens, " ")
+}
+
+// Templates returns the learned templates, most frequent first
+func (m *TemplateMiner) Templates() []Template {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Template, 0, len(m.clusters))
+	for _, c := range m.clusters {
+		result = append(result, c.template())
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Template returns a single template by ID
+func (m *TemplateMiner) Template(id string) (Template, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.clusters[id]
+	if !ok {
+		return Template{}, false
+	}
+	return c.template(), true
+}
+
+// route walks the tree by token count and leading tokens, creating nodes
+// as needed, and returns the leaf holding the candidate templates
+func (m *TemplateMiner) route(tokens []string) *drainNode {
+	node := m.child(m.root, lengthKey(len(tokens)))
+
+	for i := 0; i < m.cfg.Depth-3 && i < len(tokens); i++ {
+		key := tokens[i]
+		if hasDigit(key) {
+			key = Wildcard
+		}
+
+		if next, ok := node.children[key]; ok {
+			node = next
+			continue
+		}
+		if len(node.children) >= m.cfg.MaxChildren {
+			key = Wildcard
+		}
+		node = m.child(node, key)
+	}
+	return node
+}
+
+func (m *TemplateMiner) child(node *drainNode, key string) *drainNode {
+	next, ok := node.children[key]
+	if !ok {
+		next = newDrainNode()
+		node.children[key] = next
+	}
+	return next
+}
+
+// bestMatch returns the most similar template in leaf, or nil if none
+// reaches the similarity threshold
+func (m *TemplateMiner) bestMatch(leaf *drainNode, tokens []string) *cluster {
+	var best *cluster
+	bestSim, bestWildcards := -1.0, -1
+
+	for _, c := range leaf.clusters {
+		sim, wildcards := similarity(c.tokens, tokens)
+		if sim > bestSim || (sim == bestSim && wildcards > bestWildcards) {
+			best, bestSim, bestWildcards = c, sim, wildcards
+		}
+	}
+
+	if best == nil || bestSim < m.cfg.Similarity {
+		return nil
+	}
+	return best
+}
+
+func (m *TemplateMiner) newCluster(leaf *drainNode, tokens []string, seenAt time.Time) *cluster {
+	h := sha256.Sum256([]byte(strings.Join(tokens, " ")))
+	c := &cluster{
+		id:        hex.EncodeToString(h[:6]),
+		tokens:    append([]string(nil), tokens...),
+		params:    make(map[int][]string),
+		firstSeen: seenAt,
+		lastSeen:  seenAt,
+		leaf:      leaf,
+	}
+
+	// The same first message after a restart yields the same ID; a
+	// collision with a live template just joins it
+	if existing, ok := m.clusters[c.id]; ok {
+		return existing
+	}
+
+	leaf.clusters = append(leaf.clusters, c)
+	m.clusters[c.id] = c
+	c.elem = m.lru.PushFront(c)
+
+	for len(m.clusters) > m.cfg.MaxTemplates {
+		m.evict(m.lru.Back().Value.(*cluster))
+	}
+	return c
+}
+
+// evict forgets a template
+func (m *TemplateMiner) evict(c *cluster) {
+	m.lru.Remove(c.elem)
+	delete(m.clusters, c.id)
+
+	kept := c.leaf.clusters[:0]
+	for _, other := range c.leaf.clusters {
+		if other != c {
+			kept = append(kept, other)
+		}
+	}
+	c.leaf.clusters = kept
+}
+
+// template returns a copy of the cluster's state
+func (c *cluster) template() Template {
+	t := Template{
+		ID:        c.id,
+		Template:  strings.Join(c.tokens, " "),
+		Count:     c.count,
+		FirstSeen: c.firstSeen,
+		LastSeen:  c.lastSeen,
+	}
+	for i, tok := range c.tokens {
+		if tok == Wildcard {
+			t.Params = append(t.Params, append([]string(nil), c.params[i]...))
+		}
+	}
+	return t
+}
+
+// merge folds tokens into the template, turning differing positions into
+// wildcards and recording their values as parameter samples
+func (c *cluster) merge(tokens []string, maxSamples int) {
+	for i, tok := range tokens {
+		if c.tokens[i] != tok && c.tokens[i] != Wildcard {
+			c.addSample(i, c.tokens[i], maxSamples)
+			c.tokens[i] = Wildcard
+		}
+		if c.tokens[i] == Wildcard {
+			c.addSample(i, tok, maxSamples)
+		}
+	}
+}
+
+func (c *cluster) addSample(pos int, value string, max int) {
+	samples := c.params[pos]
+	if len(samples) >= max {
+		return
+	}
+	for _, s := range samples {
+		if s == value {
+			return
+		}
+	}
+	c.params[pos] = append(samples, value)
+}
+
+// similarity returns the fraction of positions where the template equals
+// tokens, and the number of wildcards in the template
+func similarity(template, tokens []string) (float64, int) {
+	same, wildcards := 0, 0
+	for i, tok := range template {
+		if tok == Wildcard {
+			wildcards++
+			continue
+		}
+		if tok == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template)), wildcards
+}
+
+// lengthKey is the first routing level; it cannot clash with a token
+// because tokens never contain spaces
+func lengthKey(n int) string {
+	return "len " + strconv.Itoa(n)
+}
+
+func hasDigit(s string) bool {
+	return strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
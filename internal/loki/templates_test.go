@@ -0,0 +1,118 @@
+package loki
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTemplateMiner(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      TemplateMinerConfig
+		messages []string
+		want     []string // templates, most frequent first
+	}{
+		{
+			name:     "parameters become wildcards",
+			messages: []string{"user alice logged in", "user bob logged in", "user carol logged in"},
+			want:     []string{"user <*> logged in"},
+		},
+		{
+			name:     "different lengths stay apart",
+			messages: []string{"disk full", "disk full on node-1"},
+			want:     []string{"disk full", "disk full on node-1"},
+		},
+		{
+			name:     "leading tokens with digits share a branch",
+			messages: []string{"10.0.0.1 connection refused", "10.0.0.2 connection refused"},
+			want:     []string{"<*> connection refused"},
+		},
+		{
+			name:     "dissimilar messages stay apart",
+			messages: []string{"payment failed for order", "payment queue is empty", "payment failed for order"},
+			want:     []string{"payment failed for order", "payment queue is empty"},
+		},
+		{
+			name:     "least recently seen template is evicted",
+			cfg:      TemplateMinerConfig{MaxTemplates: 2},
+			messages: []string{"first message here", "second different line", "third unrelated text"},
+			want:     []string{"second different line", "third unrelated text"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewTemplateMiner(tt.cfg)
+			now := time.Unix(1700000000, 0)
+			for i, msg := range tt.messages {
+				m.Add(msg, now.Add(time.Duration(i)*time.Second))
+			}
+
+			var got []string
+			for _, tmpl := range m.Templates() {
+				got = append(got, tmpl.Template)
+			}
+			// Equal counts are ordered by ID, so compare as sets
+			if !sameElements(got, tt.want) {
+				t.Errorf("templates = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateMinerStableID(t *testing.T) {
+	m := NewTemplateMiner(TemplateMinerConfig{ParamSamples: 2})
+	start := time.Unix(1700000000, 0)
+
+	id, template := m.Add("timeout calling inventory after 3 retries", start)
+	if template != "timeout calling inventory after 3 retries" {
+		t.Fatalf("first template = %q", template)
+	}
+
+	for i, svc := range []string{"payments", "shipping", "payments"} {
+		gotID, _ := m.Add("timeout calling "+svc+" after 3 retries", start.Add(time.Duration(i+1)*time.Second))
+		if gotID != id {
+			t.Fatalf("template ID changed from %s to %s as it generalized", id, gotID)
+		}
+	}
+
+	tmpl, ok := m.Template(id)
+	if !ok {
+		t.Fatal("template not found by ID")
+	}
+	if tmpl.Template != "timeout calling <*> after 3 retries" || tmpl.Count != 4 {
+		t.Errorf("got %q seen %d times, want the service wildcarded and 4", tmpl.Template, tmpl.Count)
+	}
+	if want := [][]string{{"inventory", "payments"}}; !reflect.DeepEqual(tmpl.Params, want) {
+		t.Errorf("Params = %q, want %q capped at 2 samples", tmpl.Params, want)
+	}
+	if !tmpl.FirstSeen.Equal(start) || !tmpl.LastSeen.Equal(start.Add(3*time.Second)) {
+		t.Errorf("seen %v..%v, want %v..%v", tmpl.FirstSeen, tmpl.LastSeen, start, start.Add(3*time.Second))
+	}
+
+	// The same first message after a restart yields the same ID
+	restarted := NewTemplateMiner(TemplateMinerConfig{})
+	if again, _ := restarted.Add("timeout calling inventory after 3 retries", start); again != id {
+		t.Errorf("ID after restart = %s, want %s", again, id)
+	}
+}
+
+func sameElements(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int)
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+	}
+	for _, n := range counts {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package loki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig holds the certificates used to connect to Loki over HTTPS
+type TLSConfig struct {
+	CAFile             string // PEM bundle trusted in addition to the system roots
+	CertFile           string // client certificate for mTLS
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// NewTLSConfig builds a tls.Config from cfg. The client certificate is
+// re-read on every handshake so rotated certificates are picked up
+// without a restart; it is loaded once here to fail early.
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile); err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsCfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+
+	return tlsCfg, nil
+}
+
+// tokenFile reads a bearer token from a file, re-reading it whenever the
+// file changes so projected service account tokens keep working after
+// rotation
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// Token returns the current token, falling back to the last one read if
+// the file is briefly unavailable during rotation
+func (f *tokenFile) Token() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if f.token != "" {
+			return f.token, nil
+		}
+		return "", fmt.Errorf("reading bearer token file: %w", err)
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) {
+		return f.token, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if f.token != "" {
+			return f.token, nil
+		}
+		return "", fmt.Errorf("reading bearer token file: %w", err)
+	}
+
+	f.token = strings.TrimSpace(string(data))
+	f.modTime = info.ModTime()
+	return f.token, nil
+}
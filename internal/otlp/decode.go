@@ -0,0 +1,367 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// resourceLogs is the decoded form of an OTLP ResourceLogs message,
+// flattened across instrumentation scopes
+type resourceLogs struct {
+	Attributes map[string]string
+	Records    []logRecord
+}
+
+// logRecord is the decoded form of an OTLP LogRecord
+type logRecord struct {
+	Timestamp      time.Time
+	SeverityNumber int32
+	SeverityText   string
+	Body           string
+	Attributes     map[string]string
+	TraceID        string
+	SpanID         string
+}
+
+// field is a single protobuf field; Bytes is set for length-delimited
+// fields and Value for varint and fixed-width fields
+type field struct {
+	Num   protowire.Number
+	Type  protowire.Type
+	Value uint64
+	Bytes []byte
+}
+
+// walk calls fn for every field in a protobuf message
+func walk(data []byte, fn func(f field) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		f := field{Num: num, Type: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.Value, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			f.Value, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			f.Value = uint64(v)
+		case protowire.BytesType:
+			f.Bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeProto decodes a protobuf ExportLogsServiceRequest
+func decodeProto(data []byte) ([]resourceLogs, error) {
+	var result []resourceLogs
+	err := walk(data, func(f field) error {
+		// ExportLogsServiceRequest.resource_logs = 1
+		if f.Num != 1 || f.Type != protowire.BytesType {
+			return nil
+		}
+		rl, err := decodeProtoResourceLogs(f.Bytes)
+		if err != nil {
+			return err
+		}
+		result = append(result, rl)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decoding protobuf: %w", err)
+	}
+	return result, nil
+}
+
+func decodeProtoResourceLogs(data []byte) (resourceLogs, error) {
+	rl := resourceLogs{Attributes: make(map[string]string)}
+	err := walk(data, func(f field) error {
+		if f.Type != protowire.BytesType {
+			return nil
+		}
+		switch f.Num {
+		case 1: // resource
+			return walk(f.Bytes, func(f field) error {
+				// Resource.attributes = 1
+				if f.Num == 1 && f.Type == protowire.BytesType {
+					return decodeProtoKeyValue(f.Bytes, rl.Attributes)
+				}
+				return nil
+			})
+		case 2, 1000: // scope_logs, or the deprecated instrumentation_library_logs
+			return walk(f.Bytes, func(f field) error {
+				// ScopeLogs.log_records = 2
+				if f.Num != 2 || f.Type != protowire.BytesType {
+					return nil
+				}
+				record, err := decodeProtoLogRecord(f.Bytes)
+				if err != nil {
+					return err
+				}
+				rl.Records = append(rl.Records, record)
+				return nil
+			})
+		}
+		return nil
+	})
+	return rl, err
+}
+
+func decodeProtoLogRecord(data []byte) (logRecord, error) {
+	record := logRecord{Attributes: make(map[string]string)}
+	var observed uint64
+	err := walk(data, func(f field) error {
+		switch f.Num {
+		case 1: // time_unix_nano
+			if f.Value > 0 {
+				record.Timestamp = time.Unix(0, int64(f.Value))
+			}
+		case 11: // observed_time_unix_nano
+			observed = f.Value
+		case 2: // severity_number
+			record.SeverityNumber = int32(f.Value)
+		case 3: // severity_text
+			record.SeverityText = string(f.Bytes)
+		case 5: // body
+			body, err := decodeProtoAnyValue(f.Bytes)
+			if err != nil {
+				return err
+			}
+			record.Body = body
+		case 6: // attributes
+			return decodeProtoKeyValue(f.Bytes, record.Attributes)
+		case 9: // trace_id
+			if len(f.Bytes) > 0 {
+				record.TraceID = hex.EncodeToString(f.Bytes)
+			}
+		case 10: // span_id
+			if len(f.Bytes) > 0 {
+				record.SpanID = hex.EncodeToString(f.Bytes)
+			}
+		}
+		return nil
+	})
+	if record.Timestamp.IsZero() && observed > 0 {
+		record.Timestamp = time.Unix(0, int64(observed))
+	}
+	return record, err
+}
+
+// decodeProtoKeyValue decodes a KeyValue message into attrs
+func decodeProtoKeyValue(data []byte, attrs map[string]string) error {
+	var key, value string
+	err := walk(data, func(f field) error {
+		switch f.Num {
+		case 1:
+			key = string(f.Bytes)
+		case 2:
+			v, err := decodeProtoAnyValue(f.Bytes)
+			if err != nil {
+				return err
+			}
+			value = v
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		attrs[key] = value
+	}
+	return nil
+}
+
+// decodeProtoAnyValue renders an AnyValue as a string. Arrays and
+// key-value lists are rendered as JSON.
+func decodeProtoAnyValue(data []byte) (string, error) {
+	var result string
+	err := walk(data, func(f field) error {
+		switch f.Num {
+		case 1: // string_value
+			result = string(f.Bytes)
+		case 2: // bool_value
+			result = strconv.FormatBool(f.Value != 0)
+		case 3: // int_value
+			result = strconv.FormatInt(int64(f.Value), 10)
+		case 4: // double_value
+			result = strconv.FormatFloat(math.Float64frombits(f.Value), 'g', -1, 64)
+		case 5: // array_value
+			var values []string
+			if err := walk(f.Bytes, func(f field) error {
+				if f.Num != 1 {
+					return nil
+				}
+				v, err := decodeProtoAnyValue(f.Bytes)
+				values = append(values, v)
+				return err
+			}); err != nil {
+				return err
+			}
+			encoded, _ := json.Marshal(values)
+			result = string(encoded)
+		case 6: // kvlist_value
+			kv := make(map[string]string)
+			if err := walk(f.Bytes, func(f field) error {
+				if f.Num != 1 {
+					return nil
+				}
+				return decodeProtoKeyValue(f.Bytes, kv)
+			}); err != nil {
+				return err
+			}
+			encoded, _ := json.Marshal(kv)
+			result = string(encoded)
+		case 7: // bytes_value
+			result = base64.StdEncoding.EncodeToString(f.Bytes)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// JSON encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+type jsonRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []jsonKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			LogRecords []jsonLogRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type jsonLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int32          `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 jsonAnyValue   `json:"body"`
+	Attributes           []jsonKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"`
+	SpanID               string         `json:"spanId"`
+}
+
+type jsonKeyValue struct {
+	Key   string       `json:"key"`
+	Value jsonAnyValue `json:"value"`
+}
+
+type jsonAnyValue struct {
+	StringValue *string          `json:"stringValue"`
+	BoolValue   *bool            `json:"boolValue"`
+	IntValue    *json.Number     `json:"intValue"` // int64 is encoded as a string
+	DoubleValue *json.Number     `json:"doubleValue"`
+	BytesValue  *string          `json:"bytesValue"`
+	ArrayValue  *jsonArrayValue  `json:"arrayValue"`
+	KvlistValue *jsonKvlistValue `json:"kvlistValue"`
+}
+
+type jsonArrayValue struct {
+	Values []jsonAnyValue `json:"values"`
+}
+
+type jsonKvlistValue struct {
+	Values []jsonKeyValue `json:"values"`
+}
+
+func (v jsonAnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return v.IntValue.String()
+	case v.DoubleValue != nil:
+		return v.DoubleValue.String()
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	case v.ArrayValue != nil:
+		values := make([]string, len(v.ArrayValue.Values))
+		for i, item := range v.ArrayValue.Values {
+			values[i] = item.String()
+		}
+		encoded, _ := json.Marshal(values)
+		return string(encoded)
+	case v.KvlistValue != nil:
+		encoded, _ := json.Marshal(jsonAttributes(v.KvlistValue.Values))
+		return string(encoded)
+	default:
+		return ""
+	}
+}
+
+func jsonAttributes(kvs []jsonKeyValue) map[string]string {
+	attrs := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		attrs[kv.Key] = kv.Value.String()
+	}
+	return attrs
+}
+
+// decodeJSON decodes a JSON ExportLogsServiceRequest
+func decodeJSON(data []byte) ([]resourceLogs, error) {
+	var req jsonRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	}
+
+	result := make([]resourceLogs, 0, len(req.ResourceLogs))
+	for _, jrl := range req.ResourceLogs {
+		rl := resourceLogs{Attributes: jsonAttributes(jrl.Resource.Attributes)}
+		for _, sl := range jrl.ScopeLogs {
+			for _, jr := range sl.LogRecords {
+				record := logRecord{
+					SeverityNumber: jr.SeverityNumber,
+					SeverityText:   jr.SeverityText,
+					Body:           jr.Body.String(),
+					Attributes:     jsonAttributes(jr.Attributes),
+					TraceID:        jr.TraceID,
+					SpanID:         jr.SpanID,
+				}
+				ts := jr.TimeUnixNano
+				if ts == "" || ts == "0" {
+					ts = jr.ObservedTimeUnixNano
+				}
+				if ts != "" {
+					ns, err := strconv.ParseInt(ts, 10, 64)
+					if err != nil {
+						return nil, fmt.Errorf("parsing timestamp %q: %w", ts, err)
+					}
+					if ns > 0 {
+						record.Timestamp = time.Unix(0, ns)
+					}
+				}
+				rl.Records = append(rl.Records, record)
+			}
+		}
+		result = append(result, rl)
+	}
+	return result, nil
+}
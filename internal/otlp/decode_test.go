@@ -0,0 +1,132 @@
+package otlp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// goldenLogs are the records encoded in testdata/logs.json and
+// testdata/logs.pb
+var goldenLogs = []resourceLogs{
+	{
+		Attributes: map[string]string{
+			"k8s.namespace.name": "shop",
+			"k8s.pod.name":       "checkout-7d9f8-abcde",
+			"service.name":       "checkout",
+		},
+		Records: []logRecord{
+			{
+				Timestamp:      time.Unix(0, 1700000000000000500),
+				SeverityNumber: 17,
+				SeverityText:   "ERROR",
+				Body:           "payment failed for order 42",
+				Attributes: map[string]string{
+					"k8s.container.name": "app",
+					"retries":            "3",
+					"cached":             "true",
+					"ratio":              "1.5",
+					"tags":               `["a","b"]`,
+					"raw":                "aGk=",
+				},
+				TraceID: "5b8efff798038103d269b633813fc60c",
+				SpanID:  "eee19b7ec3c1b174",
+			},
+			{
+				Timestamp:      time.Unix(0, 1700000001000000000),
+				SeverityNumber: 9,
+				Body:           "cache warmed",
+				Attributes:     map[string]string{},
+			},
+			{
+				Timestamp:      time.Unix(0, 1700000002000000000),
+				SeverityNumber: 21,
+				Body:           `{"msg":"disk full"}`,
+				Attributes:     map[string]string{},
+			},
+		},
+	},
+	{
+		Attributes: map[string]string{"k8s.namespace.name": "auth"},
+		Records: []logRecord{
+			{
+				Timestamp:  time.Unix(0, 1700000003000000000),
+				Body:       "token expired",
+				Attributes: map[string]string{},
+			},
+		},
+	},
+}
+
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		decode func([]byte) ([]resourceLogs, error)
+	}{
+		{"json", "logs.json", decodeJSON},
+		{"protobuf", "logs.pb", decodeProto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, err := tt.decode(readGolden(t, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logs) != len(goldenLogs) {
+				t.Fatalf("decoded %d resource logs, want %d", len(logs), len(goldenLogs))
+			}
+			for i, want := range goldenLogs {
+				got := logs[i]
+				if !reflect.DeepEqual(got.Attributes, want.Attributes) {
+					t.Errorf("resource %d attributes = %v, want %v", i, got.Attributes, want.Attributes)
+				}
+				if len(got.Records) != len(want.Records) {
+					t.Fatalf("resource %d has %d records, want %d", i, len(got.Records), len(want.Records))
+				}
+				for j, wantRecord := range want.Records {
+					gotRecord := got.Records[j]
+					if !gotRecord.Timestamp.Equal(wantRecord.Timestamp) {
+						t.Errorf("record %d/%d timestamp = %v, want %v", i, j, gotRecord.Timestamp, wantRecord.Timestamp)
+					}
+					gotRecord.Timestamp = wantRecord.Timestamp
+					if !reflect.DeepEqual(gotRecord, wantRecord) {
+						t.Errorf("record %d/%d = %+v, want %+v", i, j, gotRecord, wantRecord)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		decode func([]byte) ([]resourceLogs, error)
+	}{
+		{"json syntax", []byte(`{"resourceLogs":[`), decodeJSON},
+		{"json bad timestamp", []byte(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"timeUnixNano":"soon"}]}]}]}`), decodeJSON},
+		{"truncated protobuf", readGolden(t, "logs.pb")[:40], decodeProto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.decode(tt.body); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+// Severity numbers from the OpenTelemetry logs data model
+const (
+	SeverityTrace = 1
+	SeverityDebug = 5
+	SeverityInfo  = 9
+	SeverityWarn  = 13
+	SeverityError = 17
+	SeverityFatal = 21
+)
+
+// ParseSeverity converts a severity name such as "warn" or "error" into
+// the lowest severity number of that range
+func ParseSeverity(s string) (int32, error) {
+	switch strings.ToLower(s) {
+	case "trace":
+		return SeverityTrace, nil
+	case "debug":
+		return SeverityDebug, nil
+	case "info":
+		return SeverityInfo, nil
+	case "warn", "warning":
+		return SeverityWarn, nil
+	case "error":
+		return SeverityError, nil
+	case "fatal":
+		return SeverityFatal, nil
+	default:
+		return 0, fmt.Errorf("unknown severity: %s", s)
+	}
+}
+
+// Receiver implements the OTLP/HTTP logs endpoint (/v1/logs)
+type Receiver struct {
+	source      string
+	handler     loki.ErrorHandler
+	logger      *slog.Logger
+	minSeverity int32
+	maxBody     int64
+	auth        *loki.ReceiverAuth
+	fields      loki.FieldMapping
+	fingerprint loki.FingerprintConfig
+
+	// Deduplication
+	seen       loki.Dedup
+	windowSize time.Duration
+}
+
+// ReceiverOption configures a Receiver
+type ReceiverOption func(*Receiver)
+
+// WithSource sets the source name used to tag errors
+func WithSource(name string) ReceiverOption {
+	return func(r *Receiver) {
+		r.source = name
+	}
+}
+
+// WithLogger sets the logger for the receiver
+func WithLogger(logger *slog.Logger) ReceiverOption {
+	return func(r *Receiver) {
+		r.logger = logger
+	}
+}
+
+// WithMinSeverity drops records below the given severity number. Records
+// without a severity are always kept and left to the rules to classify.
+func WithMinSeverity(severity int32) ReceiverOption {
+	return func(r *Receiver) {
+		r.minSeverity = severity
+	}
+}
+
+// WithMaxBodySize limits the decompressed size of a request
+func WithMaxBodySize(n int64) ReceiverOption {
+	return func(r *Receiver) {
+		r.maxBody = n
+	}
+}
+
+// WithAuth requires requests to pass auth
+func WithAuth(auth *loki.ReceiverAuth) ReceiverOption {
+	return func(r *Receiver) {
+		r.auth = auth
+	}
+}
+
+// WithFieldMapping sets the body and attribute keys structured fields are
+// read from
+func WithFieldMapping(m loki.FieldMapping) ReceiverOption {
+	return func(r *Receiver) {
+		r.fields = m
+	}
+}
+
+// WithFingerprint sets how errors are grouped into fingerprints
+func WithFingerprint(cfg loki.FingerprintConfig) ReceiverOption {
+	return func(r *Receiver) {
+		r.fingerprint = cfg
+	}
+}
+
+// NewReceiver creates a new OTLP logs receiver
+func NewReceiver(handler loki.ErrorHandler, opts ...ReceiverOption) *Receiver {
+	r := &Receiver{
+		source:      "otlp",
+		handler:     handler,
+		logger:      slog.Default(),
+		minSeverity: SeverityError,
+		maxBody:     10 << 20,
+		fields:      loki.DefaultFieldMapping(),
+		fingerprint: loki.DefaultFingerprintConfig(),
+		windowSize:  30 * time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Name returns the source name the receiver tags errors with
+func (r *Receiver) Name() string {
+	return r.source
+}
+
+// Start runs periodic dedup cleanup until ctx is cancelled. Records arrive
+// through ServeHTTP.
+func (r *Receiver) Start(ctx context.Context) error {
+	r.logger.Info("starting otlp logs receiver", "source", r.source)
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("stopping otlp logs receiver", "source", r.source)
+			return ctx.Err()
+		case <-ticker.C:
+			r.cleanupSeenErrors()
+		}
+	}
+}
+
+// ServeHTTP handles POST /v1/logs
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.auth.Check(req); err != nil {
+		r.logger.Warn("rejected otlp request", "source", r.source, "remote", req.RemoteAddr, "error", err)
+		r.auth.Reject(w, err)
+		return
+	}
+
+	body, err := loki.ReadBody(w, req, r.maxBody)
+	if err != nil {
+		r.logger.Warn("failed to read otlp request", "source", r.source, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	var logs []resourceLogs
+	switch contentType {
+	case "application/x-protobuf":
+		logs, err = decodeProto(body)
+	case "application/json":
+		logs, err = decodeJSON(body)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		r.logger.Warn("failed to decode otlp request", "source", r.source, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.process(logs)
+
+	// An empty ExportLogsServiceResponse signals full success
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if contentType == "application/json" {
+		w.Write([]byte("{}"))
+	}
+}
+
+// process converts records into parsed errors, marking fingerprints seen
+// within the dedup window as repeats, and hands them to the handler
+func (r *Receiver) process(logs []resourceLogs) {
+	var parsedErrors []loki.ParsedError
+	for _, rl := range logs {
+		for _, record := range rl.Records {
+			if record.SeverityNumber != 0 && record.SeverityNumber < r.minSeverity {
+				continue
+			}
+			parsedErrors = append(parsedErrors, *r.parseRecord(rl.Attributes, record))
+		}
+	}
+
+	if len(parsedErrors) > 0 {
+		newCount := r.seen.Mark(parsedErrors, time.Now())
+		if newCount > 0 {
+			r.logger.Info("found new errors", "source", r.source, "count", newCount, "repeats", len(parsedErrors)-newCount)
+		}
+		r.handler(parsedErrors)
+	}
+}
+
+// parseRecord maps an OTLP record onto a ParsedError. Kubernetes resource
+// attributes become namespace/pod/container, falling back to record
+// attributes for SDKs that set them per record.
+func (r *Receiver) parseRecord(resource map[string]string, record logRecord) *loki.ParsedError {
+	labels := make(map[string]string, len(resource)+3)
+	for k, v := range resource {
+		labels[k] = v
+	}
+
+	attr := func(key string) string {
+		if v := resource[key]; v != "" {
+			return v
+		}
+		return record.Attributes[key]
+	}
+	if v := attr("k8s.namespace.name"); v != "" {
+		labels["namespace"] = v
+	}
+	if v := attr("k8s.pod.name"); v != "" {
+		labels["pod"] = v
+	}
+	if v := attr("k8s.container.name"); v != "" {
+		labels["container"] = v
+	}
+
+	ts := record.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	// Record attributes are mapped like the keys of a structured body
+	parsed := loki.ParseEntry(r.source, loki.LogEntry{
+		Timestamp:  ts,
+		Labels:     labels,
+		Line:       record.Body,
+		Attributes: record.Attributes,
+	}, r.fields, r.fingerprint)
+
+	// Fields from the record itself take precedence
+	if parsed.Fields == nil {
+		parsed.Fields = make(map[string]string)
+	}
+	if level := severityLevel(record); level != "" {
+		parsed.Fields["level"] = level
+	}
+	if record.TraceID != "" {
+		parsed.Fields["trace_id"] = record.TraceID
+	}
+	if record.SpanID != "" {
+		parsed.Fields["span_id"] = record.SpanID
+	}
+	if service := attr("service.name"); service != "" {
+		parsed.Fields["service"] = service
+	}
+
+	return parsed
+}
+
+// severityLevel returns a lowercase level name for a record
+func severityLevel(record logRecord) string {
+	if record.SeverityText != "" {
+		return strings.ToLower(record.SeverityText)
+	}
+
+	switch n := record.SeverityNumber; {
+	case n >= SeverityFatal:
+		return "fatal"
+	case n >= SeverityError:
+		return "error"
+	case n >= SeverityWarn:
+		return "warn"
+	case n >= SeverityInfo:
+		return "info"
+	case n >= SeverityDebug:
+		return "debug"
+	case n >= SeverityTrace:
+		return "trace"
+	default:
+		return ""
+	}
+}
+
+func (r *Receiver) cleanupSeenErrors() {
+	remaining := r.seen.Cleanup(time.Now().Add(-r.windowSize))
+	r.logger.Debug("cleaned up seen errors", "source", r.source, "remaining", remaining)
+}
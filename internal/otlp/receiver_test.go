@@ -0,0 +1,197 @@
+package otlp
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+// errorCollector records every error handed to it
+type errorCollector struct {
+	errors []loki.ParsedError
+}
+
+func (c *errorCollector) handle(errors []loki.ParsedError) {
+	c.errors = append(c.errors, errors...)
+}
+
+func newTestReceiver(opts ...ReceiverOption) (*Receiver, *errorCollector) {
+	c := &errorCollector{}
+	opts = append([]ReceiverOption{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)
+	return NewReceiver(c.handle, opts...), c
+}
+
+func TestReceiverServeHTTP(t *testing.T) {
+	jsonBody := readGolden(t, "logs.json")
+
+	tests := []struct {
+		name        string
+		opts        []ReceiverOption
+		contentType string
+		auth        string
+		body        []byte
+		wantStatus  int
+		wantErrors  int
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        jsonBody,
+			wantStatus:  http.StatusOK,
+			wantErrors:  3,
+		},
+		{
+			name:        "protobuf",
+			contentType: "application/x-protobuf",
+			body:        readGolden(t, "logs.pb"),
+			wantStatus:  http.StatusOK,
+			wantErrors:  3,
+		},
+		{
+			name:        "lower min severity",
+			opts:        []ReceiverOption{WithMinSeverity(SeverityInfo)},
+			contentType: "application/json",
+			body:        jsonBody,
+			wantStatus:  http.StatusOK,
+			wantErrors:  4,
+		},
+		{
+			name:        "missing token",
+			opts:        []ReceiverOption{WithAuth(loki.NewReceiverAuth("s3cret", ""))},
+			contentType: "application/json",
+			body:        jsonBody,
+			wantStatus:  http.StatusUnauthorized,
+		},
+		{
+			name:        "wrong token",
+			opts:        []ReceiverOption{WithAuth(loki.NewReceiverAuth("s3cret", ""))},
+			contentType: "application/json",
+			auth:        "Bearer guess",
+			body:        jsonBody,
+			wantStatus:  http.StatusUnauthorized,
+		},
+		{
+			name:        "token",
+			opts:        []ReceiverOption{WithAuth(loki.NewReceiverAuth("s3cret", ""))},
+			contentType: "application/json",
+			auth:        "Bearer s3cret",
+			body:        jsonBody,
+			wantStatus:  http.StatusOK,
+			wantErrors:  3,
+		},
+		{
+			name:        "body too large",
+			opts:        []ReceiverOption{WithMaxBodySize(64)},
+			contentType: "application/json",
+			body:        jsonBody,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        []byte("error"),
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, c := newTestReceiver(tt.opts...)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", rec.Code, strings.TrimSpace(rec.Body.String()), tt.wantStatus)
+			}
+			if len(c.errors) != tt.wantErrors {
+				t.Errorf("handled %d errors, want %d", len(c.errors), tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestReceiverParseRecord(t *testing.T) {
+	r, c := newTestReceiver()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(readGolden(t, "logs.pb")))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(c.errors) != 3 {
+		t.Fatalf("handled %d errors, want 3", len(c.errors))
+	}
+
+	tests := []struct {
+		namespace string
+		pod       string
+		container string
+		fields    map[string]string
+	}{
+		{
+			namespace: "shop",
+			pod:       "checkout-7d9f8-abcde",
+			container: "app",
+			fields: map[string]string{
+				"level":    "error",
+				"trace_id": "5b8efff798038103d269b633813fc60c",
+				"span_id":  "eee19b7ec3c1b174",
+				"service":  "checkout",
+			},
+		},
+		{
+			namespace: "shop",
+			pod:       "checkout-7d9f8-abcde",
+			fields:    map[string]string{"level": "fatal", "service": "checkout"},
+		},
+		{
+			namespace: "auth",
+			fields:    map[string]string{},
+		},
+	}
+
+	for i, tt := range tests {
+		got := c.errors[i]
+		if got.Namespace != tt.namespace || got.Pod != tt.pod || got.Container != tt.container {
+			t.Errorf("error %d = %s/%s/%s, want %s/%s/%s", i, got.Namespace, got.Pod, got.Container, tt.namespace, tt.pod, tt.container)
+		}
+		for k, want := range tt.fields {
+			if got.Fields[k] != want {
+				t.Errorf("error %d field %s = %q, want %q", i, k, got.Fields[k], want)
+			}
+		}
+		if got.Source != "otlp" {
+			t.Errorf("error %d source = %q, want otlp", i, got.Source)
+		}
+	}
+}
+
+func TestReceiverRepeats(t *testing.T) {
+	r, c := newTestReceiver()
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(readGolden(t, "logs.json")))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(c.errors) != 6 {
+		t.Fatalf("handled %d errors, want 6", len(c.errors))
+	}
+	for i, e := range c.errors {
+		if want := i >= 3; e.Repeat != want {
+			t.Errorf("error %d (%q) Repeat = %v, want %v", i, e.Message, e.Repeat, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_sentinel_pipeline_queue_depth",
+		Help: "Number of items waiting in a pipeline stage queue.",
+	}, []string{"stage"})
+
+	queueCapacity = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_sentinel_pipeline_queue_capacity",
+		Help: "Maximum number of items a pipeline stage queue can hold.",
+	}, []string{"stage"})
+
+	itemsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_pipeline_dropped_total",
+		Help: "Number of items dropped because a pipeline stage queue was full.",
+	}, []string{"stage"})
+
+	itemsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_sentinel_pipeline_processed_total",
+		Help: "Number of items processed by a pipeline stage.",
+	}, []string{"stage"})
+
+	stageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_sentinel_pipeline_stage_duration_seconds",
+		Help:    "Time spent processing a single item in a pipeline stage.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"stage"})
+)
@@ -0,0 +1,425 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	"github.com/kube-sentinel/kube-sentinel/internal/remediation"
+	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+	"github.com/kube-sentinel/kube-sentinel/internal/store"
+)
+
+// fingerprintPruneInterval is how often source fingerprints of errors no
+// longer stored are forgotten
+const fingerprintPruneInterval = 10 * time.Minute
+
+// Stage names used in metrics and stats
+const (
+	StageMatch     = "match"
+	StageRemediate = "remediate"
+	StageNotify    = "notify"
+)
+
+// Notifier receives updates for connected dashboard clients. Calls are made
+// from a single goroutine.
+type Notifier interface {
+	BroadcastError(err *store.Error)
+	BroadcastRemediation(log *store.RemediationLog)
+	BroadcastStats()
+}
+
+// StageConfig sizes a stage's queue and worker pool
+type StageConfig struct {
+	QueueSize int
+	Workers   int
+	Overflow  OverflowPolicy
+}
+
+// Config configures the pipeline stages. The notify stage always has a
+// single worker so WebSocket writes stay single-threaded.
+type Config struct {
+	Match     StageConfig
+	Remediate StageConfig
+	Notify    StageConfig
+}
+
+// StageStats reports the state of a stage
+type StageStats struct {
+	Name      string
+	Workers   int
+	Policy    OverflowPolicy
+	Depth     int
+	Capacity  int
+	Dropped   uint64
+	Processed uint64
+}
+
+// job is an item moving through the pipeline; which fields are set
+// depends on the stage
+type job struct {
+	parsed  loki.ParsedError
+	matched *rules.MatchedError
+	err     *store.Error
+	repeat  bool
+	log     *store.RemediationLog
+}
+
+// Pipeline decouples log sources from rule matching, storage, remediation
+// and dashboard updates using bounded queues between worker pools:
+//
+//	sources -> match/store -> remediate -> notify
+//
+// Match workers are sharded by fingerprint so occurrences of the same
+// error are stored in order.
+type Pipeline struct {
+	ruleEngine *rules.Engine
+	remEngine  *remediation.Engine
+	store      store.Store
+	notifier   Notifier
+	logger     *slog.Logger
+
+	match     *stage
+	remediate *stage
+	notify    *stage
+
+	// fingerprints maps source fingerprints to the one their error is
+	// stored under, where it differs, see rememberFingerprint
+	fingerprintsMu sync.Mutex
+	fingerprints   map[string]string
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// New creates a new pipeline. notifier may be nil.
+func New(ruleEngine *rules.Engine, remEngine *remediation.Engine, dataStore store.Store, notifier Notifier, cfg Config, logger *slog.Logger) *Pipeline {
+	return &Pipeline{
+		ruleEngine:   ruleEngine,
+		remEngine:    remEngine,
+		store:        dataStore,
+		notifier:     notifier,
+		logger:       logger,
+		match:        newStage(StageMatch, cfg.Match.QueueSize, cfg.Match.Workers, true, cfg.Match.Overflow),
+		remediate:    newStage(StageRemediate, cfg.Remediate.QueueSize, cfg.Remediate.Workers, false, cfg.Remediate.Overflow),
+		notify:       newStage(StageNotify, cfg.Notify.QueueSize, 1, false, cfg.Notify.Overflow),
+		fingerprints: make(map[string]string),
+		done:         make(chan struct{}),
+	}
+}
+
+// Submit enqueues parsed errors for matching. It has the signature of
+// loki.ErrorHandler so it can be handed to every source. Depending on the
+// match stage overflow policy it blocks the source or drops errors when
+// the queue is full.
+func (p *Pipeline) Submit(errors []loki.ParsedError) {
+	for _, e := range errors {
+		if !p.match.push(e.Fingerprint, job{parsed: e}, p.done) {
+			p.logger.Debug("dropped error, match queue full", "source", e.Source, "fingerprint", e.Fingerprint)
+		}
+	}
+}
+
+// Run starts the worker pools and blocks until ctx is cancelled. Errors
+// still queued then are matched, remediated and broadcast before it
+// returns, so sources should be stopped first. The context passed to
+// workers is never cancelled, letting remediations finish while draining.
+func (p *Pipeline) Run(ctx context.Context) error {
+	p.logger.Info("starting pipeline",
+		"match_workers", p.match.workers,
+		"remediate_workers", p.remediate.workers,
+	)
+
+	// Each stage drains once the stage before it is done, so items it
+	// passes on while draining are still handled
+	workCtx := context.WithoutCancel(ctx)
+	run := func(s *stage, stop <-chan struct{}, fn func(context.Context, job)) *sync.WaitGroup {
+		var wg sync.WaitGroup
+		for i := 0; i < s.workers; i++ {
+			wg.Add(1)
+			go func(q chan job) {
+				defer wg.Done()
+				p.work(workCtx, stop, s, q, fn)
+			}(s.queueFor(i))
+		}
+		return &wg
+	}
+	stopRemediate := make(chan struct{})
+	stopNotify := make(chan struct{})
+	matchWg := run(p.match, ctx.Done(), p.processMatch)
+	remediateWg := run(p.remediate, stopRemediate, p.processRemediate)
+
+	notifyDone := make(chan struct{})
+	go func() {
+		defer close(notifyDone)
+		p.notifyLoop(stopNotify)
+	}()
+
+	pruneDone := make(chan struct{})
+	go func() {
+		defer close(pruneDone)
+		ticker := time.NewTicker(fingerprintPruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.pruneFingerprints()
+			}
+		}
+	}()
+
+	<-ctx.Done()
+	p.logger.Info("draining pipeline", "match_queued", p.match.depth(), "remediate_queued", p.remediate.depth())
+	matchWg.Wait()
+	close(stopRemediate)
+	remediateWg.Wait()
+	close(stopNotify)
+	<-notifyDone
+	<-pruneDone
+	p.doneOnce.Do(func() { close(p.done) })
+
+	p.logger.Info("stopped pipeline")
+	return ctx.Err()
+}
+
+// Stats returns the current state of each stage
+func (p *Pipeline) Stats() []StageStats {
+	return []StageStats{p.match.stats(), p.remediate.stats(), p.notify.stats()}
+}
+
+// work handles items from q until stop is closed, then handles the items
+// left in q and returns
+func (p *Pipeline) work(ctx context.Context, stop <-chan struct{}, s *stage, q chan job, fn func(context.Context, job)) {
+	handle := func(j job) {
+		start := time.Now()
+		fn(ctx, j)
+		stageDuration.WithLabelValues(s.name).Observe(time.Since(start).Seconds())
+		s.done()
+	}
+
+	for {
+		select {
+		case <-stop:
+			for {
+				select {
+				case j := <-q:
+					handle(j)
+				default:
+					return
+				}
+			}
+		case j := <-q:
+			handle(j)
+		}
+	}
+}
+
+// processMatch matches an error against the rules and stores it
+func (p *Pipeline) processMatch(ctx context.Context, j job) {
+	e := j.parsed
+
+	// Repeats were already matched, stored and remediated when the source
+	// first reported them, so they skip rule stats and thresholds
+	if e.Repeat {
+		p.processRepeat(e)
+		return
+	}
+
+	matched := p.ruleEngine.Match(e)
+	if matched == nil {
+		return
+	}
+
+	storeErr := p.save(matched)
+	if storeErr == nil {
+		return
+	}
+	p.rememberFingerprint(e.Fingerprint, storeErr.Fingerprint)
+
+	p.publish(job{err: storeErr})
+
+	if p.remEngine != nil && p.remEngine.IsEnabled() {
+		if !p.remediate.push("", job{matched: matched, err: storeErr}, p.done) {
+			p.logger.Warn("dropped remediation, queue full", "rule", matched.RuleName, "error_id", matched.ID)
+		}
+	}
+}
+
+// processRepeat counts another occurrence of a stored error. A repeat
+// whose stored error is gone, e.g. after a restart with an in-memory store
+// and a restored checkpoint, is stored again but not remediated.
+func (p *Pipeline) processRepeat(e loki.ParsedError) {
+	if storeErr, err := p.store.RecordOccurrence(p.storedFingerprint(e.Fingerprint), e.Timestamp, max(e.Occurrences, 1)); err == nil {
+		p.publish(job{err: storeErr, repeat: true})
+		return
+	}
+	p.forgetFingerprint(e.Fingerprint)
+
+	matched := p.ruleEngine.MatchRepeat(e)
+	if matched == nil {
+		return
+	}
+	storeErr := p.save(matched)
+	if storeErr == nil {
+		return
+	}
+	p.rememberFingerprint(e.Fingerprint, storeErr.Fingerprint)
+	p.publish(job{err: storeErr})
+}
+
+// save stores a matched error. A known fingerprint is folded into the
+// existing error, which is returned instead, and matched refers to it.
+func (p *Pipeline) save(matched *rules.MatchedError) *store.Error {
+	storeErr := &store.Error{
+		ID:           matched.ID,
+		Fingerprint:  matched.Fingerprint,
+		Timestamp:    matched.Timestamp,
+		Source:       matched.Source,
+		Tenant:       matched.Tenant,
+		Namespace:    matched.Namespace,
+		Pod:          matched.Pod,
+		Container:    matched.Container,
+		Message:      matched.Message,
+		Priority:     matched.Priority,
+		Count:        matched.Count,
+		FirstSeen:    matched.FirstSeen,
+		LastSeen:     matched.LastSeen,
+		RuleMatched:  matched.RuleName,
+		RulesMatched: matched.Rules,
+		Labels:       matched.Labels,
+		Fields:       matched.Fields,
+		TemplateID:   matched.TemplateID,
+		Template:     matched.Template,
+	}
+
+	if err := p.store.SaveError(storeErr); err != nil {
+		p.logger.Error("failed to save error", "error", err)
+		return nil
+	}
+
+	if stored, err := p.store.GetErrorByFingerprint(storeErr.Fingerprint); err == nil {
+		storeErr = stored
+		matched.ID = stored.ID
+	}
+	return storeErr
+}
+
+// rememberFingerprint records the fingerprint an error is stored under
+// when a rule's group_by replaced the source fingerprint, so repeats find
+// the stored error without matching the rules again
+func (p *Pipeline) rememberFingerprint(source, stored string) {
+	p.fingerprintsMu.Lock()
+	defer p.fingerprintsMu.Unlock()
+	if source == stored {
+		delete(p.fingerprints, source)
+		return
+	}
+	p.fingerprints[source] = stored
+}
+
+// storedFingerprint returns the fingerprint the error of a source
+// fingerprint is stored under
+func (p *Pipeline) storedFingerprint(source string) string {
+	p.fingerprintsMu.Lock()
+	defer p.fingerprintsMu.Unlock()
+	if stored, ok := p.fingerprints[source]; ok {
+		return stored
+	}
+	return source
+}
+
+func (p *Pipeline) forgetFingerprint(source string) {
+	p.fingerprintsMu.Lock()
+	defer p.fingerprintsMu.Unlock()
+	delete(p.fingerprints, source)
+}
+
+// pruneFingerprints forgets source fingerprints whose stored error was
+// cleaned up
+func (p *Pipeline) pruneFingerprints() {
+	p.fingerprintsMu.Lock()
+	defer p.fingerprintsMu.Unlock()
+	for source, stored := range p.fingerprints {
+		if _, err := p.store.GetErrorByFingerprint(stored); err != nil {
+			delete(p.fingerprints, source)
+		}
+	}
+}
+
+// processRemediate runs the remediations for a matched error
+func (p *Pipeline) processRemediate(ctx context.Context, j job) {
+	logs, err := p.remEngine.ProcessError(ctx, j.matched, p.ruleEngine)
+	if err != nil {
+		p.logger.Error("remediation failed", "error", err)
+	}
+
+	// Mark error as remediated if any action succeeded
+	if slices.ContainsFunc(logs, func(l *store.RemediationLog) bool { return l.Status == "success" }) {
+		if err := p.store.MarkRemediated(j.err.ID, time.Now()); err != nil {
+			p.logger.Warn("failed to mark error remediated", "error", err, "error_id", j.err.ID)
+		}
+	}
+
+	for _, log := range logs {
+		p.publish(job{log: log})
+	}
+}
+
+// publish hands an update to the notify stage
+func (p *Pipeline) publish(j job) {
+	if p.notifier == nil {
+		return
+	}
+	p.notify.push("", j, p.done)
+}
+
+// notifyLoop broadcasts updates from a single goroutine until stop is
+// closed and the queue is empty. Repeats and stats are coalesced until the
+// queue drains so a burst of occurrences doesn't flood clients.
+func (p *Pipeline) notifyLoop(stop <-chan struct{}) {
+	q := p.notify.queueFor(0)
+	repeats := make(map[string]*store.Error)
+
+	handle := func(j job) {
+		start := time.Now()
+		switch {
+		case j.log != nil:
+			p.notifier.BroadcastRemediation(j.log)
+		case j.repeat:
+			repeats[j.err.Fingerprint] = j.err
+		default:
+			p.notifier.BroadcastError(j.err)
+		}
+
+		if len(q) == 0 {
+			for fp, e := range repeats {
+				p.notifier.BroadcastError(e)
+				delete(repeats, fp)
+			}
+			p.notifier.BroadcastStats()
+		}
+		stageDuration.WithLabelValues(StageNotify).Observe(time.Since(start).Seconds())
+		p.notify.done()
+	}
+
+	for {
+		select {
+		case <-stop:
+			for {
+				select {
+				case j := <-q:
+					handle(j)
+				default:
+					return
+				}
+			}
+		case j := <-q:
+			handle(j)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	"github.com/kube-sentinel/kube-sentinel/internal/remediation"
+	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+	"github.com/kube-sentinel/kube-sentinel/internal/store"
+)
+
+func newTestPipeline(t *testing.T, ruleList []rules.Rule) (*Pipeline, *store.MemoryStore) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ruleEngine, err := rules.NewEngine(ruleList, logger)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	dataStore := store.NewMemoryStore()
+	remEngine := remediation.NewEngine(nil, dataStore, remediation.EngineConfig{
+		Enabled:           true,
+		DryRun:            true,
+		MaxActionsPerHour: 100,
+	}, logger)
+
+	p := New(ruleEngine, remEngine, dataStore, nil, Config{
+		Match:     StageConfig{QueueSize: 100, Workers: 1},
+		Remediate: StageConfig{QueueSize: 100, Workers: 1},
+		Notify:    StageConfig{QueueSize: 100},
+	}, logger)
+	return p, dataStore
+}
+
+// process runs errors through the match stage and every remediation it
+// queued, synchronously
+func (p *Pipeline) process(errors ...loki.ParsedError) {
+	ctx := context.Background()
+	for _, e := range errors {
+		p.processMatch(ctx, job{parsed: e})
+		q := p.remediate.queueFor(0)
+		for len(q) > 0 {
+			p.processRemediate(ctx, <-q)
+		}
+	}
+}
+
+func TestProcessMatchRepeats(t *testing.T) {
+	crashloop := rules.Rule{
+		Name:     "crashloop",
+		Match:    rules.Match{Pattern: "CrashLoopBackOff"},
+		Priority: rules.PriorityHigh,
+		Remediation: &rules.Remediation{
+			Action: rules.ActionNone,
+		},
+		Enabled: true,
+	}
+	grouped := crashloop
+	grouped.GroupBy = []string{rules.GroupByNamespace, rules.GroupByWorkload, rules.GroupByRule}
+
+	tests := []struct {
+		name string
+		rule rules.Rule
+	}{
+		{"source fingerprint", crashloop},
+		{"grouped fingerprint", grouped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, dataStore := newTestPipeline(t, []rules.Rule{tt.rule})
+
+			first := loki.ParsedError{
+				ID:          "e1",
+				Fingerprint: "source-fp",
+				Timestamp:   time.Now(),
+				Namespace:   "shop",
+				Pod:         "checkout-7d9f8-abcde",
+				Workload:    "checkout",
+				Message:     "Back-off: CrashLoopBackOff",
+			}
+			repeat := first
+			repeat.ID = "e2"
+			repeat.Repeat = true
+			repeat.Timestamp = first.Timestamp.Add(time.Second)
+
+			p.process(first, repeat, repeat)
+
+			errors, total, _ := dataStore.ListErrors(store.ErrorFilter{}, store.PaginationOptions{})
+			if total != 1 {
+				t.Fatalf("stored %d errors, want 1", total)
+			}
+			if errors[0].Count != 3 {
+				t.Errorf("Count = %d, want 3", errors[0].Count)
+			}
+
+			logs, _, _ := dataStore.ListRemediationLogs(store.PaginationOptions{})
+			if len(logs) != 1 {
+				t.Errorf("got %d remediation logs, want 1: repeats must not be remediated again", len(logs))
+			}
+		})
+	}
+}
+
+func TestProcessMatchRepeatsSkipRules(t *testing.T) {
+	p, dataStore := newTestPipeline(t, []rules.Rule{
+		{
+			Name:      "burst",
+			Match:     rules.Match{Keywords: []string{"refused"}},
+			Priority:  rules.PriorityCritical,
+			Threshold: &rules.Threshold{Count: 3, Window: time.Minute},
+			Enabled:   true,
+		},
+		{
+			Name:     "refused",
+			Match:    rules.Match{Keywords: []string{"refused"}},
+			Priority: rules.PriorityMedium,
+			Enabled:  true,
+		},
+	})
+
+	base := loki.ParsedError{Fingerprint: "fp", Timestamp: time.Now(), Message: "connection refused"}
+	var errors []loki.ParsedError
+	for i := 0; i < 4; i++ {
+		e := base
+		e.ID = string(rune('a' + i))
+		e.Repeat = i > 0
+		e.Timestamp = base.Timestamp.Add(time.Duration(i) * time.Second)
+		errors = append(errors, e)
+	}
+	p.process(errors...)
+
+	stored, err := dataStore.GetErrorByFingerprint("fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RuleMatched != "refused" {
+		t.Errorf("matched %s, want refused: repeats must not reach the threshold", stored.RuleMatched)
+	}
+	if stored.Count != 4 || !stored.LastSeen.Equal(errors[3].Timestamp) {
+		t.Errorf("Count = %d, last seen %v; want 4, %v", stored.Count, stored.LastSeen, errors[3].Timestamp)
+	}
+	for _, s := range p.ruleEngine.Stats() {
+		if s.Matches > 1 {
+			t.Errorf("rule %s matched %d times, want repeats not counted", s.Name, s.Matches)
+		}
+	}
+}
+
+func TestProcessMatchRepeatWithoutRecord(t *testing.T) {
+	p, dataStore := newTestPipeline(t, []rules.Rule{{
+		Name:        "crashloop",
+		Match:       rules.Match{Pattern: "CrashLoopBackOff"},
+		Priority:    rules.PriorityHigh,
+		GroupBy:     []string{rules.GroupByNamespace, rules.GroupByRule},
+		Remediation: &rules.Remediation{Action: rules.ActionNone},
+		Enabled:     true,
+	}})
+
+	// After a restart the restored dedup state marks the first occurrence
+	// as a repeat, but the in-memory store is empty
+	repeat := loki.ParsedError{
+		ID:          "e1",
+		Fingerprint: "source-fp",
+		Timestamp:   time.Now(),
+		Namespace:   "shop",
+		Message:     "Back-off: CrashLoopBackOff",
+		Repeat:      true,
+	}
+	p.process(repeat, repeat)
+
+	errors, total, _ := dataStore.ListErrors(store.ErrorFilter{}, store.PaginationOptions{})
+	if total != 1 {
+		t.Fatalf("stored %d errors, want 1", total)
+	}
+	if errors[0].RuleMatched != "crashloop" || errors[0].Count != 2 {
+		t.Errorf("got %s seen %d times, want crashloop seen 2 times", errors[0].RuleMatched, errors[0].Count)
+	}
+
+	logs, _, _ := dataStore.ListRemediationLogs(store.PaginationOptions{})
+	if len(logs) != 0 {
+		t.Errorf("got %d remediation logs, want none for a repeat", len(logs))
+	}
+}
+
+func TestProcessMatchOccurrences(t *testing.T) {
+	p, dataStore := newTestPipeline(t, nil)
+
+	// An event first seen with count 2 whose count then jumps to 7
+	first := loki.ParsedError{ID: "e1", Fingerprint: "fp", Timestamp: time.Now(), Message: "Back-off restarting failed container", Occurrences: 2}
+	repeat := first
+	repeat.ID = "e2"
+	repeat.Repeat = true
+	repeat.Occurrences = 5
+	p.process(first, repeat)
+
+	stored, err := dataStore.GetErrorByFingerprint("fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Count != 7 {
+		t.Errorf("Count = %d, want 7", stored.Count)
+	}
+}
+
+// successAction is a remediation that always succeeds
+type successAction struct{}
+
+func (successAction) Name() string { return "noop" }
+func (successAction) Execute(context.Context, remediation.Target, map[string]string) error {
+	return nil
+}
+func (successAction) Validate(map[string]string) error { return nil }
+
+// recordingNotifier reads every broadcast error like the dashboard does
+type recordingNotifier struct {
+	seen int
+}
+
+func (n *recordingNotifier) BroadcastError(err *store.Error) {
+	if err.Count > 0 && !err.LastSeen.IsZero() && err.Labels["app"] != "" {
+		n.seen++
+	}
+}
+func (n *recordingNotifier) BroadcastRemediation(*store.RemediationLog) {}
+func (n *recordingNotifier) BroadcastStats()                            {}
+
+// TestPipelineConcurrentShards runs with -race: shards store, count and
+// mark errors remediated while the notifier reads them
+func TestPipelineConcurrentShards(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ruleEngine, err := rules.NewEngine([]rules.Rule{{
+		Name:        "timeout",
+		Match:       rules.Match{Pattern: "timeout"},
+		Priority:    rules.PriorityHigh,
+		Remediation: &rules.Remediation{Action: "noop"},
+		Enabled:     true,
+	}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataStore := store.NewMemoryStore()
+	remEngine := remediation.NewEngine(nil, dataStore, remediation.EngineConfig{
+		Enabled: true, DryRun: true, MaxActionsPerHour: 10000,
+	}, logger)
+	remEngine.RegisterAction(successAction{})
+
+	p := New(ruleEngine, remEngine, dataStore, &recordingNotifier{}, Config{
+		Match:     StageConfig{QueueSize: 1000, Workers: 4, Overflow: OverflowBlock},
+		Remediate: StageConfig{QueueSize: 1000, Workers: 4, Overflow: OverflowBlock},
+		Notify:    StageConfig{QueueSize: 1000, Overflow: OverflowBlock},
+	}, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(stopped)
+	}()
+
+	// The dashboard lists errors while the pipeline updates them
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for ctx.Err() == nil {
+			errors, _, _ := dataStore.ListErrors(store.ErrorFilter{}, store.PaginationOptions{})
+			for _, e := range errors {
+				_ = e.Count + len(e.Labels)
+				_ = e.Remediated && e.RemediatedAt != nil
+			}
+		}
+	}()
+
+	const fingerprints, occurrences = 8, 50
+	now := time.Now()
+	for i := 0; i < occurrences; i++ {
+		var batch []loki.ParsedError
+		for f := 0; f < fingerprints; f++ {
+			batch = append(batch, loki.ParsedError{
+				ID:          string(rune('a'+f)) + time.Duration(i).String(),
+				Fingerprint: string(rune('a' + f)),
+				Timestamp:   now.Add(time.Duration(i) * time.Millisecond),
+				Message:     "upstream timeout",
+				Labels:      map[string]string{"app": "web"},
+				Repeat:      i%2 == 1,
+			})
+		}
+		p.Submit(batch)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		stats, _ := dataStore.GetStats()
+		if stats.TotalOccurrences == fingerprints*occurrences {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("counted %d occurrences, want %d", stats.TotalOccurrences, fingerprints*occurrences)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-stopped
+	<-readerDone
+}
+
+func TestPipelineDrainsOnShutdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ruleEngine, err := rules.NewEngine([]rules.Rule{{
+		Name:        "timeout",
+		Match:       rules.Match{Pattern: "timeout"},
+		Priority:    rules.PriorityHigh,
+		Remediation: &rules.Remediation{Action: "noop"},
+		Enabled:     true,
+	}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataStore := store.NewMemoryStore()
+	remEngine := remediation.NewEngine(nil, dataStore, remediation.EngineConfig{
+		Enabled: true, DryRun: true, MaxActionsPerHour: 100,
+	}, logger)
+	remEngine.RegisterAction(successAction{})
+
+	notifier := &recordingNotifier{}
+	p := New(ruleEngine, remEngine, dataStore, notifier, Config{
+		Match:     StageConfig{QueueSize: 100, Workers: 2, Overflow: OverflowBlock},
+		Remediate: StageConfig{QueueSize: 100, Workers: 2, Overflow: OverflowBlock},
+		Notify:    StageConfig{QueueSize: 100, Overflow: OverflowBlock},
+	}, logger)
+
+	// Errors submitted by sources that already stopped are still queued
+	// when the pipeline is shut down
+	const errors = 20
+	now := time.Now()
+	for i := 0; i < errors; i++ {
+		p.Submit([]loki.ParsedError{{
+			ID:          "e" + strconv.Itoa(i),
+			Fingerprint: "fp" + strconv.Itoa(i),
+			Timestamp:   now,
+			Message:     "upstream timeout",
+			Labels:      map[string]string{"app": "web"},
+		}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx)
+
+	stats, _ := dataStore.GetStats()
+	if stats.TotalErrors != errors {
+		t.Errorf("stored %d errors, want %d", stats.TotalErrors, errors)
+	}
+	logs, _, _ := dataStore.ListRemediationLogs(store.PaginationOptions{Limit: 100})
+	if len(logs) != errors {
+		t.Errorf("got %d remediation logs, want %d", len(logs), errors)
+	}
+	if notifier.seen != errors {
+		t.Errorf("broadcast %d errors, want %d", notifier.seen, errors)
+	}
+}
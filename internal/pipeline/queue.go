@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens when a stage queue is full
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits for room, pushing back on the previous stage
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropNewest discards the item being enqueued
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowDropOldest discards the oldest queued item to make room
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+)
+
+// stage is a set of bounded queues feeding a worker pool. A sharded stage
+// has one queue per worker so items with the same key are handled in order
+// by a single worker; otherwise all workers share one queue.
+type stage struct {
+	name    string
+	queues  []chan job
+	workers int
+	policy  OverflowPolicy
+
+	dropped   atomic.Uint64
+	processed atomic.Uint64
+}
+
+func newStage(name string, size, workers int, sharded bool, policy OverflowPolicy) *stage {
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	s := &stage{name: name, workers: workers, policy: policy}
+	if sharded {
+		perShard := size / workers
+		if perShard < 1 {
+			perShard = 1
+		}
+		for i := 0; i < workers; i++ {
+			s.queues = append(s.queues, make(chan job, perShard))
+		}
+	} else {
+		s.queues = []chan job{make(chan job, size)}
+	}
+
+	queueCapacity.WithLabelValues(name).Set(float64(s.capacity()))
+	return s
+}
+
+// queueFor returns the queue worker i reads from
+func (s *stage) queueFor(i int) chan job {
+	return s.queues[i%len(s.queues)]
+}
+
+// shard picks the queue for a key
+func (s *stage) shard(key string) chan job {
+	if len(s.queues) == 1 {
+		return s.queues[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return s.queues[h.Sum32()%uint32(len(s.queues))]
+}
+
+// push enqueues j on the queue for key according to the overflow policy.
+// It returns false if the item was dropped or done was closed while blocked.
+func (s *stage) push(key string, j job, done <-chan struct{}) bool {
+	q := s.shard(key)
+	defer s.updateDepth()
+
+	switch s.policy {
+	case OverflowDropNewest:
+		select {
+		case q <- j:
+			return true
+		default:
+			s.drop()
+			return false
+		}
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case q <- j:
+				return true
+			default:
+			}
+			select {
+			case <-q:
+				s.drop()
+			default:
+			}
+		}
+
+	default:
+		select {
+		case q <- j:
+			return true
+		case <-done:
+			return false
+		}
+	}
+}
+
+// done records that a worker finished an item
+func (s *stage) done() {
+	s.processed.Add(1)
+	itemsProcessed.WithLabelValues(s.name).Inc()
+	s.updateDepth()
+}
+
+func (s *stage) drop() {
+	s.dropped.Add(1)
+	itemsDropped.WithLabelValues(s.name).Inc()
+}
+
+func (s *stage) depth() int {
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+func (s *stage) capacity() int {
+	n := 0
+	for _, q := range s.queues {
+		n += cap(q)
+	}
+	return n
+}
+
+func (s *stage) updateDepth() {
+	queueDepth.WithLabelValues(s.name).Set(float64(s.depth()))
+}
+
+func (s *stage) stats() StageStats {
+	return StageStats{
+		Name:      s.name,
+		Workers:   s.workers,
+		Policy:    s.policy,
+		Depth:     s.depth(),
+		Capacity:  s.capacity(),
+		Dropped:   s.dropped.Load(),
+		Processed: s.processed.Load(),
+	}
+}
@@ -27,14 +27,15 @@ type Target struct {
 	Container  string
 }
 
-// String returns a string representation of the target
+// String returns a string representation of the target. A deployment
+// selected by the params takes precedence over the pod of the error.
 func (t Target) String() string {
-	if t.Pod != "" {
-		return fmt.Sprintf("%s/%s", t.Namespace, t.Pod)
-	}
 	if t.Deployment != "" {
 		return fmt.Sprintf("%s/deployment/%s", t.Namespace, t.Deployment)
 	}
+	if t.Pod != "" {
+		return fmt.Sprintf("%s/%s", t.Namespace, t.Pod)
+	}
 	return t.Namespace
 }
 
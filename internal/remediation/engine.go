@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
@@ -23,10 +25,13 @@ type Engine struct {
 	dryRun             bool
 	maxActionsPerHour  int
 	excludedNamespaces map[string]bool
+	tenants            map[string]TenantPolicy
 
 	actions   map[string]Action
 	cooldowns map[string]time.Time // key: rule+target, value: cooldown expires at
 	hourlyLog []time.Time          // timestamps of actions in the last hour
+	inFlight  map[string]bool      // key: rule+target, actions currently executing
+	now       func() time.Time
 
 	store  store.Store
 	logger *slog.Logger
@@ -38,6 +43,21 @@ type EngineConfig struct {
 	DryRun             bool
 	MaxActionsPerHour  int
 	ExcludedNamespaces []string
+
+	// Tenants restricts remediation of errors from individual Loki tenants
+	Tenants map[string]TenantPolicy
+
+	// Now is the clock for cooldowns, the hourly limit and log timestamps.
+	// Defaults to time.Now; replays use the time of the replayed error.
+	Now func() time.Time
+}
+
+// TenantPolicy restricts remediation for errors from one tenant. It can
+// only narrow the engine-wide settings, never widen them.
+type TenantPolicy struct {
+	Disabled           bool     // skip every action
+	DryRun             bool     // log actions without executing them
+	ExcludedNamespaces []string // in addition to the engine-wide exclusions
 }
 
 // NewEngine creates a new remediation engine
@@ -47,14 +67,22 @@ func NewEngine(client kubernetes.Interface, store store.Store, cfg EngineConfig,
 		excluded[ns] = true
 	}
 
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+
 	e := &Engine{
 		enabled:            cfg.Enabled,
 		dryRun:             cfg.DryRun,
 		maxActionsPerHour:  cfg.MaxActionsPerHour,
 		excludedNamespaces: excluded,
+		tenants:            cfg.Tenants,
 		actions:            make(map[string]Action),
 		cooldowns:          make(map[string]time.Time),
+		inFlight:           make(map[string]bool),
 		hourlyLog:          []time.Time{},
+		now:                now,
 		store:              store,
 		logger:             logger,
 	}
@@ -94,16 +122,44 @@ func (e *Engine) GetAction(name string) (Action, bool) {
 	return action, ok
 }
 
-// Execute runs a remediation action for a matched error
+// pendingAction is an action reserved by prepare, to be run without the
+// engine lock
+type pendingAction struct {
+	action Action
+	target Target
+	params map[string]string
+	key    string // cooldown key, marked in flight until finish
+}
+
+// Execute runs a remediation action for a matched error. The engine lock is
+// released while the action runs so a slow API call doesn't block other
+// targets; the rule+target pair and an hourly slot are reserved meanwhile.
 func (e *Engine) Execute(ctx context.Context, err *rules.MatchedError, rule *rules.Rule) (*store.RemediationLog, error) {
+	logEntry, pending, prepErr := e.prepare(err, rule)
+	if pending == nil {
+		return logEntry, prepErr
+	}
+
+	execErr := pending.action.Execute(ctx, pending.target, pending.params)
+	return e.finish(logEntry, rule, pending, execErr)
+}
+
+// prepare runs the safety checks and renders the params. It returns a
+// pending action to run, or nil when the action was skipped, failed or
+// only dry run, in which case the log entry is already saved.
+func (e *Engine) prepare(err *rules.MatchedError, rule *rules.Rule) (*store.RemediationLog, *pendingAction, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	policy := e.tenants[err.Tenant]
+	dryRun := e.dryRun || policy.DryRun
+
 	logEntry := &store.RemediationLog{
 		ID:        generateLogID(),
 		ErrorID:   err.ID,
-		Timestamp: time.Now(),
-		DryRun:    e.dryRun,
+		Rule:      rule.Name,
+		Timestamp: e.now(),
+		DryRun:    dryRun,
 	}
 
 	target := Target{
@@ -119,7 +175,7 @@ func (e *Engine) Execute(ctx context.Context, err *rules.MatchedError, rule *rul
 		logEntry.Status = "skipped"
 		logEntry.Message = "remediation disabled"
 		e.saveLog(logEntry)
-		return logEntry, nil
+		return logEntry, nil, nil
 	}
 
 	// Check if action is "none"
@@ -128,7 +184,7 @@ func (e *Engine) Execute(ctx context.Context, err *rules.MatchedError, rule *rul
 		logEntry.Status = "skipped"
 		logEntry.Message = "no remediation action configured"
 		e.saveLog(logEntry)
-		return logEntry, nil
+		return logEntry, nil, nil
 	}
 
 	logEntry.Action = string(rule.Remediation.Action)
@@ -138,25 +194,62 @@ func (e *Engine) Execute(ctx context.Context, err *rules.MatchedError, rule *rul
 		logEntry.Status = "skipped"
 		logEntry.Message = fmt.Sprintf("namespace %s is excluded", err.Namespace)
 		e.saveLog(logEntry)
-		return logEntry, nil
+		return logEntry, nil, nil
+	}
+
+	// Check tenant scoping
+	if policy.Disabled {
+		logEntry.Status = "skipped"
+		logEntry.Message = fmt.Sprintf("remediation disabled for tenant %s", err.Tenant)
+		e.saveLog(logEntry)
+		return logEntry, nil, nil
+	}
+	if slices.Contains(policy.ExcludedNamespaces, err.Namespace) {
+		logEntry.Status = "skipped"
+		logEntry.Message = fmt.Sprintf("namespace %s is excluded for tenant %s", err.Namespace, err.Tenant)
+		e.saveLog(logEntry)
+		return logEntry, nil, nil
+	}
+
+	// A deployment param names the target deployment, e.g. one captured
+	// from the log line, so it is rendered before the cooldown checks
+	paramData := newParamData(err, rule)
+	if _, ok := rule.Remediation.Params["deployment"]; ok {
+		deployment, renderErr := renderParam(rule.Remediation, "deployment", paramData)
+		if renderErr != nil {
+			logEntry.Status = "failed"
+			logEntry.Message = fmt.Sprintf("rendering params: %v", renderErr)
+			e.saveLog(logEntry)
+			return logEntry, nil, renderErr
+		}
+		target.Deployment = deployment
+		logEntry.Target = target.String()
 	}
 
 	// Check cooldown
-	cooldownKey := fmt.Sprintf("%s:%s", rule.Name, target.String())
-	if expiresAt, ok := e.cooldowns[cooldownKey]; ok && time.Now().Before(expiresAt) {
+	cooldownKey := cooldownKey(rule.Name, target)
+	if expiresAt, ok := e.cooldowns[cooldownKey]; ok && e.now().Before(expiresAt) {
 		logEntry.Status = "skipped"
 		logEntry.Message = fmt.Sprintf("cooldown active until %s", expiresAt.Format(time.RFC3339))
 		e.saveLog(logEntry)
-		return logEntry, nil
+		return logEntry, nil, nil
 	}
 
-	// Check hourly rate limit
+	// Check for the same action already running against the target
+	if e.inFlight[cooldownKey] {
+		logEntry.Status = "skipped"
+		logEntry.Message = "action already in progress"
+		e.saveLog(logEntry)
+		return logEntry, nil, nil
+	}
+
+	// Check hourly rate limit, counting actions still in flight
 	e.cleanupHourlyLog()
-	if len(e.hourlyLog) >= e.maxActionsPerHour {
+	if len(e.hourlyLog)+len(e.inFlight) >= e.maxActionsPerHour {
 		logEntry.Status = "skipped"
 		logEntry.Message = fmt.Sprintf("hourly limit reached (%d actions)", e.maxActionsPerHour)
 		e.saveLog(logEntry)
-		return logEntry, nil
+		return logEntry, nil, nil
 	}
 
 	// Get the action
@@ -165,19 +258,28 @@ func (e *Engine) Execute(ctx context.Context, err *rules.MatchedError, rule *rul
 		logEntry.Status = "failed"
 		logEntry.Message = fmt.Sprintf("unknown action: %s", rule.Remediation.Action)
 		e.saveLog(logEntry)
-		return logEntry, fmt.Errorf("unknown action: %s", rule.Remediation.Action)
+		return logEntry, nil, fmt.Errorf("unknown action: %s", rule.Remediation.Action)
+	}
+
+	// Render templated params
+	params, renderErr := renderParams(rule.Remediation, paramData)
+	if renderErr != nil {
+		logEntry.Status = "failed"
+		logEntry.Message = fmt.Sprintf("rendering params: %v", renderErr)
+		e.saveLog(logEntry)
+		return logEntry, nil, renderErr
 	}
 
 	// Validate params
-	if err := action.Validate(rule.Remediation.Params); err != nil {
+	if err := action.Validate(params); err != nil {
 		logEntry.Status = "failed"
 		logEntry.Message = fmt.Sprintf("invalid params: %v", err)
 		e.saveLog(logEntry)
-		return logEntry, err
+		return logEntry, nil, err
 	}
 
-	// Execute (or dry run)
-	if e.dryRun {
+	// Dry run, or reserve the target for the action
+	if dryRun {
 		logEntry.Status = "success"
 		logEntry.Message = "dry run - would execute action"
 		e.logger.Info("dry run remediation",
@@ -185,34 +287,49 @@ func (e *Engine) Execute(ctx context.Context, err *rules.MatchedError, rule *rul
 			"target", target.String(),
 			"rule", rule.Name,
 		)
-	} else {
-		e.logger.Info("executing remediation",
-			"action", rule.Remediation.Action,
-			"target", target.String(),
-			"rule", rule.Name,
-		)
+		e.record(logEntry, rule, cooldownKey)
+		return logEntry, nil, nil
+	}
 
-		if execErr := action.Execute(ctx, target, rule.Remediation.Params); execErr != nil {
-			logEntry.Status = "failed"
-			logEntry.Message = execErr.Error()
-			e.saveLog(logEntry)
-			return logEntry, execErr
-		}
+	e.logger.Info("executing remediation",
+		"action", rule.Remediation.Action,
+		"target", target.String(),
+		"rule", rule.Name,
+	)
+	e.inFlight[cooldownKey] = true
 
-		logEntry.Status = "success"
-		logEntry.Message = "action executed successfully"
-	}
+	return logEntry, &pendingAction{action: action, target: target, params: params, key: cooldownKey}, nil
+}
 
-	// Set cooldown
-	e.cooldowns[cooldownKey] = time.Now().Add(rule.Remediation.Cooldown)
+// finish releases the target reserved by prepare and records the outcome
+// of the action
+func (e *Engine) finish(logEntry *store.RemediationLog, rule *rules.Rule, pending *pendingAction, execErr error) (*store.RemediationLog, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-	// Record in hourly log
-	e.hourlyLog = append(e.hourlyLog, time.Now())
+	delete(e.inFlight, pending.key)
 
-	e.saveLog(logEntry)
+	if execErr != nil {
+		logEntry.Status = "failed"
+		logEntry.Message = execErr.Error()
+		e.saveLog(logEntry)
+		return logEntry, execErr
+	}
+
+	logEntry.Status = "success"
+	logEntry.Message = "action executed successfully"
+	e.record(logEntry, rule, pending.key)
 	return logEntry, nil
 }
 
+// record starts the cooldown, counts the action against the hourly limit
+// and saves its log entry
+func (e *Engine) record(logEntry *store.RemediationLog, rule *rules.Rule, cooldownKey string) {
+	e.cooldowns[cooldownKey] = e.now().Add(rule.Remediation.Cooldown)
+	e.hourlyLog = append(e.hourlyLog, e.now())
+	e.saveLog(logEntry)
+}
+
 // SetEnabled enables or disables remediation
 func (e *Engine) SetEnabled(enabled bool) {
 	e.mu.Lock()
@@ -250,21 +367,21 @@ func (e *Engine) GetActionsThisHour() int {
 }
 
 // ClearCooldown removes the cooldown for a specific rule and target
-func (e *Engine) ClearCooldown(ruleName, target string) {
+func (e *Engine) ClearCooldown(ruleName string, target Target) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	delete(e.cooldowns, fmt.Sprintf("%s:%s", ruleName, target))
+	delete(e.cooldowns, cooldownKey(ruleName, target))
 }
 
-// ClearAllCooldowns removes all cooldowns
-func (e *Engine) ClearAllCooldowns() {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	e.cooldowns = make(map[string]time.Time)
+// cooldownKey identifies a rule and the workload it acts on. A deployment,
+// e.g. one rendered from the log line, takes precedence over the pod the
+// error came from, so all its pods share one cooldown.
+func cooldownKey(ruleName string, target Target) string {
+	return fmt.Sprintf("%s:%s", ruleName, target.String())
 }
 
 func (e *Engine) cleanupHourlyLog() {
-	cutoff := time.Now().Add(-time.Hour)
+	cutoff := e.now().Add(-time.Hour)
 	var kept []time.Time
 	for _, t := range e.hourlyLog {
 		if t.After(cutoff) {
@@ -288,16 +405,36 @@ func generateLogID() string {
 	return hex.EncodeToString(hash[:8])
 }
 
-// ProcessError handles an error by matching rules and executing remediation
-func (e *Engine) ProcessError(ctx context.Context, err *rules.MatchedError, ruleEngine *rules.Engine) (*store.RemediationLog, error) {
-	rule := ruleEngine.GetRuleByName(err.RuleName)
-	if rule == nil {
-		return nil, fmt.Errorf("rule not found: %s", err.RuleName)
+// ProcessError executes the remediations of every rule the error matched,
+// in rule evaluation order. A failing remediation doesn't stop the
+// following ones; their errors are joined.
+func (e *Engine) ProcessError(ctx context.Context, err *rules.MatchedError, ruleEngine *rules.Engine) ([]*store.RemediationLog, error) {
+	names := err.Rules
+	if len(names) == 0 {
+		names = []string{err.RuleName}
 	}
 
-	if rule.Remediation == nil {
-		return nil, nil
+	var logs []*store.RemediationLog
+	var errs []error
+	for _, name := range names {
+		rule := ruleEngine.GetRuleByName(name)
+		if rule == nil {
+			errs = append(errs, fmt.Errorf("rule not found: %s", name))
+			continue
+		}
+
+		if rule.Remediation == nil {
+			continue
+		}
+
+		log, execErr := e.Execute(ctx, err, rule)
+		if log != nil {
+			logs = append(logs, log)
+		}
+		if execErr != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", name, execErr))
+		}
 	}
 
-	return e.Execute(ctx, err, rule)
+	return logs, errors.Join(errs...)
 }
@@ -0,0 +1,280 @@
+package remediation
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+	"github.com/kube-sentinel/kube-sentinel/internal/store"
+)
+
+// recordingAction records the targets and params it is executed with
+type recordingAction struct {
+	targets []Target
+	params  []map[string]string
+}
+
+func (a *recordingAction) Name() string { return "record" }
+func (a *recordingAction) Execute(_ context.Context, target Target, params map[string]string) error {
+	a.targets = append(a.targets, target)
+	a.params = append(a.params, params)
+	return nil
+}
+func (a *recordingAction) Validate(map[string]string) error { return nil }
+
+func newTestEngine(t *testing.T, cfg EngineConfig) (*Engine, *recordingAction) {
+	t.Helper()
+
+	cfg.Enabled = true
+	if cfg.MaxActionsPerHour == 0 {
+		cfg.MaxActionsPerHour = 100
+	}
+	e := NewEngine(nil, store.NewMemoryStore(), cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	action := &recordingAction{}
+	e.RegisterAction(action)
+	return e, action
+}
+
+func scaleRule(params map[string]string) *rules.Rule {
+	return &rules.Rule{
+		Name: "worker-saturated",
+		Remediation: &rules.Remediation{
+			Action:   "record",
+			Params:   params,
+			Cooldown: 10 * time.Minute,
+		},
+	}
+}
+
+func capturedError(namespace, pod, deployment string) *rules.MatchedError {
+	e := &rules.MatchedError{
+		ID:        "e-" + deployment,
+		Namespace: namespace,
+		Pod:       pod,
+		Message:   "queue full deployment=" + deployment,
+		Labels:    map[string]string{"app": "worker"},
+		Fields:    map[string]string{"queue": "jobs"},
+	}
+	if deployment != "" {
+		e.Captures = map[string]string{"deployment": deployment}
+	}
+	return e
+}
+
+func TestExecuteParams(t *testing.T) {
+	tests := []struct {
+		name              string
+		params            map[string]string
+		templateNamespace bool
+		err               *rules.MatchedError
+		wantStatus        string
+		wantMessage       string
+		wantTarget        string
+		wantParams        map[string]string
+	}{
+		{
+			name:       "static params",
+			params:     map[string]string{"replicas": "+1"},
+			err:        capturedError("shop", "dispatcher-0", "checkout"),
+			wantStatus: "success",
+			wantTarget: "shop/dispatcher-0",
+			wantParams: map[string]string{"replicas": "+1"},
+		},
+		{
+			name:       "rendered deployment",
+			params:     map[string]string{"deployment": "{{.Captures.deployment}}", "replicas": "+1"},
+			err:        capturedError("shop", "dispatcher-0", "checkout"),
+			wantStatus: "success",
+			wantTarget: "shop/deployment/checkout",
+			wantParams: map[string]string{"deployment": "checkout", "replicas": "+1"},
+		},
+		{
+			name:              "rendered namespace with template_namespace",
+			params:            map[string]string{"namespace": "{{index .Labels \"app\"}}-jobs"},
+			templateNamespace: true,
+			err:               capturedError("shop", "dispatcher-0", "checkout"),
+			wantStatus:        "success",
+			wantTarget:        "shop/dispatcher-0",
+			wantParams:        map[string]string{"namespace": "worker-jobs"},
+		},
+		{
+			name:        "namespace without template_namespace",
+			params:      map[string]string{"namespace": "{{.Captures.deployment}}"},
+			err:         capturedError("shop", "dispatcher-0", "checkout"),
+			wantStatus:  "failed",
+			wantMessage: "rendering params: param namespace: templates are not allowed",
+			wantTarget:  "shop/dispatcher-0",
+		},
+		{
+			name:        "other params are not rendered",
+			params:      map[string]string{"script": "echo {{.Message}}"},
+			err:         capturedError("shop", "dispatcher-0", "checkout"),
+			wantStatus:  "failed",
+			wantMessage: "rendering params: param script: templates are not allowed",
+			wantTarget:  "shop/dispatcher-0",
+		},
+		{
+			name:        "rendered deployment must be a name",
+			params:      map[string]string{"deployment": "{{.Captures.deployment}}"},
+			err:         capturedError("shop", "dispatcher-0", "checkout; rm -rf /"),
+			wantStatus:  "failed",
+			wantMessage: "rendering params: param deployment: \"checkout; rm -rf /\"",
+			wantTarget:  "shop/dispatcher-0",
+		},
+		{
+			name:              "rendered namespace must be a label",
+			params:            map[string]string{"namespace": "{{.Captures.deployment}}"},
+			templateNamespace: true,
+			err:               capturedError("shop", "dispatcher-0", "jobs.argo"),
+			wantStatus:        "failed",
+			wantMessage:       "rendering params: param namespace: \"jobs.argo\"",
+			wantTarget:        "shop/dispatcher-0",
+		},
+		{
+			name:        "missing capture",
+			params:      map[string]string{"deployment": "{{.Captures.deployment}}"},
+			err:         capturedError("shop", "dispatcher-0", ""),
+			wantStatus:  "failed",
+			wantMessage: "rendering params: param deployment",
+			wantTarget:  "shop/dispatcher-0",
+		},
+		{
+			name:        "excluded namespace is skipped before rendering",
+			params:      map[string]string{"deployment": "{{.Captures.deployment}}"},
+			err:         capturedError("kube-system", "dispatcher-0", ""),
+			wantStatus:  "skipped",
+			wantMessage: "namespace kube-system is excluded",
+			wantTarget:  "kube-system/dispatcher-0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, action := newTestEngine(t, EngineConfig{ExcludedNamespaces: []string{"kube-system"}})
+			rule := scaleRule(tt.params)
+			rule.Remediation.TemplateNamespace = tt.templateNamespace
+
+			log, _ := e.Execute(context.Background(), tt.err, rule)
+
+			if log.Status != tt.wantStatus {
+				t.Fatalf("status = %s (%s), want %s", log.Status, log.Message, tt.wantStatus)
+			}
+			if !strings.Contains(log.Message, tt.wantMessage) {
+				t.Errorf("message = %q, want it to contain %q", log.Message, tt.wantMessage)
+			}
+			if log.Target != tt.wantTarget {
+				t.Errorf("target = %q, want %q", log.Target, tt.wantTarget)
+			}
+			if log.Rule != "worker-saturated" {
+				t.Errorf("rule = %q, want worker-saturated", log.Rule)
+			}
+
+			if tt.wantParams == nil {
+				if len(action.params) != 0 {
+					t.Errorf("action ran with %v", action.params)
+				}
+				return
+			}
+			if len(action.params) != 1 {
+				t.Fatalf("action ran %d times, want 1", len(action.params))
+			}
+			for k, want := range tt.wantParams {
+				if got := action.params[0][k]; got != want {
+					t.Errorf("param %s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteCooldownPerRenderedTarget(t *testing.T) {
+	e, action := newTestEngine(t, EngineConfig{})
+	rule := scaleRule(map[string]string{"deployment": "{{.Captures.deployment}}", "replicas": "+1"})
+
+	tests := []struct {
+		pod        string
+		deployment string
+		wantStatus string
+	}{
+		{"dispatcher-0", "checkout", "success"},
+		// Another deployment reported by the same pod
+		{"dispatcher-0", "payments", "success"},
+		// The same deployment reported by another pod
+		{"dispatcher-1", "checkout", "skipped"},
+		{"dispatcher-1", "payments", "skipped"},
+	}
+
+	for _, tt := range tests {
+		log, err := e.Execute(context.Background(), capturedError("shop", tt.pod, tt.deployment), rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if log.Status != tt.wantStatus {
+			t.Errorf("%s from %s: status = %s (%s), want %s", tt.deployment, tt.pod, log.Status, log.Message, tt.wantStatus)
+		}
+	}
+
+	if len(action.targets) != 2 {
+		t.Fatalf("action ran %d times, want 2", len(action.targets))
+	}
+	if action.targets[0].Deployment != "checkout" || action.targets[1].Deployment != "payments" {
+		t.Errorf("targets = %v", action.targets)
+	}
+}
+
+func TestExecuteCooldownSkipsRendering(t *testing.T) {
+	e, _ := newTestEngine(t, EngineConfig{})
+
+	// The first error starts the cooldown; the second has no value for a
+	// param, which doesn't matter while the action is cooling down
+	rule := scaleRule(map[string]string{"deployment": "{{.Captures.deployment}}", "namespace": "{{.Labels.app}}"})
+	rule.Remediation.TemplateNamespace = true
+	if log, _ := e.Execute(context.Background(), capturedError("shop", "dispatcher-0", "checkout"), rule); log.Status != "success" {
+		t.Fatalf("first status = %s (%s), want success", log.Status, log.Message)
+	}
+
+	second := capturedError("shop", "dispatcher-0", "checkout")
+	second.Labels = nil
+	log, err := e.Execute(context.Background(), second, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Status != "skipped" || !strings.Contains(log.Message, "cooldown") {
+		t.Errorf("status = %s (%s), want skipped for the cooldown", log.Status, log.Message)
+	}
+}
+
+// panickingAction panics when executed
+type panickingAction struct{}
+
+func (panickingAction) Name() string                                             { return "panic" }
+func (panickingAction) Execute(context.Context, Target, map[string]string) error { panic("boom") }
+func (panickingAction) Validate(map[string]string) error                         { return nil }
+
+func TestExecuteActionPanicReleasesLock(t *testing.T) {
+	e, action := newTestEngine(t, EngineConfig{})
+	e.RegisterAction(panickingAction{})
+
+	rule := scaleRule(nil)
+	rule.Remediation.Action = "panic"
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("recovered %v, want the action's panic", r)
+			}
+		}()
+		e.Execute(context.Background(), capturedError("shop", "dispatcher-0", ""), rule)
+	}()
+
+	// The engine lock is free again for other targets
+	if log, _ := e.Execute(context.Background(), capturedError("shop", "dispatcher-1", ""), scaleRule(nil)); log.Status != "success" {
+		t.Errorf("status = %s (%s), want success", log.Status, log.Message)
+	}
+	if len(action.targets) != 1 {
+		t.Errorf("action ran %d times, want 1", len(action.targets))
+	}
+}
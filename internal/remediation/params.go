@@ -0,0 +1,96 @@
+package remediation
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ParamData is available to the params selecting the target, which are
+// rendered as Go templates when the action runs, e.g.
+// "{{.Captures.deployment}}" or "{{index .Labels \"app\"}}". Referring to a
+// missing key is an error, and so is a rendered value that isn't a valid
+// name. See rules.Remediation.Templated for the params that can be rendered.
+type ParamData struct {
+	Rule      string
+	Source    string
+	Tenant    string
+	Namespace string
+	Pod       string
+	Container string
+	Message   string
+	Labels    map[string]string
+	Fields    map[string]string // structured log fields
+	Captures  map[string]string // named groups of the rule patterns
+}
+
+// newParamData collects the values params are rendered with
+func newParamData(err *rules.MatchedError, rule *rules.Rule) ParamData {
+	return ParamData{
+		Rule:      rule.Name,
+		Source:    err.Source,
+		Tenant:    err.Tenant,
+		Namespace: err.Namespace,
+		Pod:       err.Pod,
+		Container: err.Container,
+		Message:   err.Message,
+		Labels:    err.Labels,
+		Fields:    err.Fields,
+		Captures:  err.Captures,
+	}
+}
+
+// paramValidators check rendered values against what the param selects
+var paramValidators = map[string]func(string) []string{
+	"deployment": validation.IsDNS1123Subdomain,
+	"namespace":  validation.IsDNS1123Label,
+}
+
+// renderParams renders the templates in the remediation params. Values
+// without template actions are passed through as they are.
+func renderParams(r *rules.Remediation, data ParamData) (map[string]string, error) {
+	if len(r.Params) == 0 {
+		return r.Params, nil
+	}
+
+	rendered := make(map[string]string, len(r.Params))
+	for key := range r.Params {
+		v, err := renderParam(r, key, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered[key] = v
+	}
+	return rendered, nil
+}
+
+// renderParam renders a single param. Rules are validated when loaded, so
+// a template in a param that can't be rendered is only rejected here for
+// rules built in code.
+func renderParam(r *rules.Remediation, key string, data ParamData) (string, error) {
+	value := r.Params[key]
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	if !r.Templated(key) {
+		return "", fmt.Errorf("param %s: templates are not allowed", key)
+	}
+
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("param %s: %w", key, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("param %s: %w", key, err)
+	}
+	if validate, ok := paramValidators[key]; ok {
+		if errs := validate(b.String()); len(errs) > 0 {
+			return "", fmt.Errorf("param %s: %q: %s", key, b.String(), strings.Join(errs, "; "))
+		}
+	}
+	return b.String(), nil
+}
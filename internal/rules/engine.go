@@ -1,7 +1,11 @@
 package rules
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log/slog"
+	"maps"
 	"regexp"
 	"strings"
 	"sync"
@@ -15,50 +19,102 @@ type Engine struct {
 	rules  []Rule
 	logger *slog.Logger
 
-	// Compiled regex patterns
-	patterns map[string]*regexp.Regexp
+	// Compiled match conditions by rule name
+	matchers map[string]*compiledMatch
+
+	// Sliding windows of threshold rules by rule name
+	windows map[string]*slidingWindow
+
+	// Match and expression counters by rule name
+	stats map[string]*ruleStats
+
+	// occurrences returns how often a fingerprint was stored, for the
+	// count variable of expressions
+	occurrences func(fingerprint string) int
 }
 
 // NewEngine creates a new rule engine
 func NewEngine(rules []Rule, logger *slog.Logger) (*Engine, error) {
-	e := &Engine{
+	matchers, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{
 		rules:    rules,
 		logger:   logger,
-		patterns: make(map[string]*regexp.Regexp),
-	}
+		matchers: matchers,
+		windows:  thresholdWindows(rules, nil),
+		stats:    ruleCounters(rules, nil),
+	}, nil
+}
 
-	// Pre-compile regex patterns
+// ruleCounters creates the stats of every rule, keeping the counts of
+// rules that already existed
+func ruleCounters(rules []Rule, current map[string]*ruleStats) map[string]*ruleStats {
+	stats := make(map[string]*ruleStats, len(rules))
 	for _, rule := range rules {
-		if rule.Match.Pattern != "" {
-			re, err := regexp.Compile(rule.Match.Pattern)
-			if err != nil {
-				return nil, err
-			}
-			e.patterns[rule.Name] = re
+		if s, ok := current[rule.Name]; ok {
+			stats[rule.Name] = s
+			continue
 		}
+		stats[rule.Name] = &ruleStats{}
 	}
-
-	return e, nil
+	return stats
 }
 
-// UpdateRules replaces the current rules with new ones
-func (e *Engine) UpdateRules(rules []Rule) error {
+// SetOccurrenceCounter sets the lookup of stored occurrences behind the
+// count variable of expressions. Without it count is always 1.
+func (e *Engine) SetOccurrenceCounter(occurrences func(fingerprint string) int) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.occurrences = occurrences
+}
 
-	patterns := make(map[string]*regexp.Regexp)
+// thresholdWindows creates the windows of threshold rules, keeping the
+// counts of rules whose threshold is unchanged
+func thresholdWindows(rules []Rule, current map[string]*slidingWindow) map[string]*slidingWindow {
+	windows := make(map[string]*slidingWindow)
 	for _, rule := range rules {
-		if rule.Match.Pattern != "" {
-			re, err := regexp.Compile(rule.Match.Pattern)
-			if err != nil {
-				return err
-			}
-			patterns[rule.Name] = re
+		if rule.Threshold == nil {
+			continue
 		}
+		if w, ok := current[rule.Name]; ok && w.threshold.String() == rule.Threshold.String() {
+			windows[rule.Name] = w
+			continue
+		}
+		windows[rule.Name] = newSlidingWindow(*rule.Threshold)
+	}
+	return windows
+}
+
+// compileRules compiles the match conditions of every rule
+func compileRules(rules []Rule) (map[string]*compiledMatch, error) {
+	matchers := make(map[string]*compiledMatch, len(rules))
+	for _, rule := range rules {
+		m, err := compileMatch(rule.Match, "match")
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		matchers[rule.Name] = m
 	}
+	return matchers, nil
+}
+
+// UpdateRules replaces the current rules with new ones
+func (e *Engine) UpdateRules(rules []Rule) error {
+	matchers, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
 	e.rules = rules
-	e.patterns = patterns
+	e.matchers = matchers
+	e.windows = thresholdWindows(rules, e.windows)
+	e.stats = ruleCounters(rules, e.stats)
 	return nil
 }
 
@@ -73,54 +129,196 @@ func (e *Engine) GetRules() []Rule {
 }
 
 // Match attempts to match a parsed error against all rules
-// Returns the matched error with priority, or nil if no rules matched
+// Returns the matched error with priority, or nil if no rules matched.
+// Evaluation stops at the first matching rule unless it has Continue set;
+// the last matching rule decides priority and grouping, and Rules lists
+// every matching rule in order. A threshold rule counts every error it
+// matches, but only applies once its count is reached; until then the
+// following rules are tried.
 func (e *Engine) Match(err loki.ParsedError) *MatchedError {
+	return e.match(err, true)
+}
+
+// MatchRepeat matches a repeat whose stored error is gone, e.g. after a
+// restart with an in-memory store, so it can be stored again. It doesn't
+// count towards rule stats or thresholds, and rules with a threshold are
+// skipped.
+func (e *Engine) MatchRepeat(err loki.ParsedError) *MatchedError {
+	return e.match(err, false)
+}
+
+// match evaluates the rules; count records the error in rule stats and
+// threshold windows
+func (e *Engine) match(err loki.ParsedError, count bool) *MatchedError {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	// Try rules in order (first match wins)
-	for _, rule := range e.rules {
+	var decided *Rule
+	var matchedRules []string
+	var captures map[string]string
+	var windowCount int
+	var reached bool
+
+	// Stored counts are looked up when an expression needs them
+	ec := &evalContext{occurrences: e.occurrences}
+
+	for i := range e.rules {
+		rule := &e.rules[i]
 		if !rule.Enabled {
 			continue
 		}
 
-		if e.matchRule(rule, err) {
-			return &MatchedError{
-				ID:          err.ID,
-				Fingerprint: err.Fingerprint,
-				Timestamp:   err.Timestamp,
-				Namespace:   err.Namespace,
-				Pod:         err.Pod,
-				Container:   err.Container,
-				Message:     err.Message,
-				Labels:      err.Labels,
-				Raw:         err.Raw,
-				Priority:    rule.Priority,
-				RuleName:    rule.Name,
-				Count:       1,
-				FirstSeen:   err.Timestamp,
-				LastSeen:    err.Timestamp,
+		ec.rule = rule
+		ec.stats = nil
+		if count {
+			ec.stats = e.stats[rule.Name]
+		}
+		if !e.matchers[rule.Name].match(&err, ec) {
+			continue
+		}
+
+		if w := e.windows[rule.Name]; w != nil {
+			if !count {
+				continue
+			}
+			n, first := w.record(thresholdKey(*rule, err), err.Timestamp)
+			if n < rule.Threshold.Count {
+				continue
+			}
+			windowCount = n
+			reached = reached || first
+		}
+
+		// Captures and tags become labels, visible to the following rules.
+		// A capture never replaces a label the error already has, such as
+		// a stream label; it is still available under Captures.
+		ruleCaptures := e.matchers[rule.Name].captures(&err, ec)
+		if len(ruleCaptures) > 0 || len(rule.Labels) > 0 {
+			labels := maps.Clone(err.Labels)
+			if labels == nil {
+				labels = make(map[string]string, len(ruleCaptures)+len(rule.Labels))
+			}
+			for name, value := range ruleCaptures {
+				if _, exists := labels[name]; !exists {
+					labels[name] = value
+				}
+			}
+			maps.Copy(labels, rule.Labels)
+			err.Labels = labels
+		}
+		if len(ruleCaptures) > 0 {
+			if captures == nil {
+				captures = make(map[string]string, len(ruleCaptures))
 			}
+			maps.Copy(captures, ruleCaptures)
+		}
+
+		decided = rule
+		matchedRules = append(matchedRules, rule.Name)
+		if ec.stats != nil {
+			ec.stats.matches.Add(1)
+		}
+		if !rule.Continue {
+			break
 		}
 	}
 
-	// No rule matched - assign default low priority
-	return &MatchedError{
+	matched := &MatchedError{
 		ID:          err.ID,
 		Fingerprint: err.Fingerprint,
 		Timestamp:   err.Timestamp,
+		Source:      err.Source,
+		Tenant:      err.Tenant,
 		Namespace:   err.Namespace,
 		Pod:         err.Pod,
 		Container:   err.Container,
 		Message:     err.Message,
 		Labels:      err.Labels,
+		Fields:      err.Fields,
 		Raw:         err.Raw,
-		Priority:    PriorityLow,
-		RuleName:    "default",
-		Count:       1,
+		TemplateID:  err.TemplateID,
+		Template:    err.Template,
+		Count:       max(err.Occurrences, 1),
 		FirstSeen:   err.Timestamp,
 		LastSeen:    err.Timestamp,
 	}
+
+	// No rule matched - assign default low priority
+	if decided == nil {
+		matched.Priority = PriorityLow
+		matched.RuleName = "default"
+		return matched
+	}
+
+	if len(decided.GroupBy) > 0 {
+		matched.Fingerprint = groupFingerprint(*decided, err)
+	}
+	matched.Priority = decided.Priority
+	matched.RuleName = decided.Name
+	matched.Rules = matchedRules
+	matched.Captures = captures
+	matched.WindowCount = windowCount
+	matched.ThresholdReached = reached
+	return matched
+}
+
+// groupFingerprint builds a fingerprint from the rule's grouping keys
+func groupFingerprint(rule Rule, err loki.ParsedError) string {
+	var b strings.Builder
+	for _, key := range rule.GroupBy {
+		fmt.Fprintf(&b, "%s=%q|", key, groupValue(key, rule, err))
+	}
+
+	hash := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(hash[:8])
+}
+
+// groupValue returns the value of a grouping key for an error
+func groupValue(key string, rule Rule, err loki.ParsedError) string {
+	switch key {
+	case GroupBySource:
+		return err.Source
+	case GroupByTenant:
+		return err.Tenant
+	case GroupByNamespace:
+		return err.Namespace
+	case GroupByWorkload, GroupByDeployment:
+		return err.Workload
+	case GroupByPod:
+		return err.Pod
+	case GroupByContainer:
+		return err.Container
+	case GroupByRule:
+		return rule.Name
+	case GroupByFingerprint:
+		return err.Fingerprint
+	}
+	if name, ok := strings.CutPrefix(key, "labels."); ok {
+		return err.Labels[name]
+	}
+	if name, ok := strings.CutPrefix(key, "fields."); ok {
+		return err.Fields[name]
+	}
+	return ""
+}
+
+// Stats returns the counters of every rule in evaluation order
+func (e *Engine) Stats() []RuleStats {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	result := make([]RuleStats, 0, len(e.rules))
+	for _, rule := range e.rules {
+		s := e.stats[rule.Name]
+		result = append(result, RuleStats{
+			Name:            rule.Name,
+			Matches:         s.matches.Load(),
+			ExprEvaluations: s.exprEvals.Load(),
+			ExprErrors:      s.exprErrors.Load(),
+			ExprCost:        s.exprCost.Load(),
+		})
+	}
+	return result
 }
 
 // MatchBatch matches multiple errors and returns all matched errors
@@ -147,110 +345,6 @@ func (e *Engine) GetRuleByName(name string) *Rule {
 	return nil
 }
 
-func (e *Engine) matchRule(rule Rule, err loki.ParsedError) bool {
-	// Check namespace filter
-	if len(rule.Match.Namespaces) > 0 {
-		if !e.matchNamespace(rule.Match.Namespaces, err.Namespace) {
-			return false
-		}
-	}
-
-	// Check label matchers
-	if len(rule.Match.Labels) > 0 {
-		if !e.matchLabels(rule.Match.Labels, err.Labels) {
-			return false
-		}
-	}
-
-	// Check pattern
-	if rule.Match.Pattern != "" {
-		re := e.patterns[rule.Name]
-		if re != nil {
-			// Match against both message and raw log line
-			if !re.MatchString(err.Message) && !re.MatchString(err.Raw) {
-				return false
-			}
-		}
-	}
-
-	// Check keywords
-	if len(rule.Match.Keywords) > 0 {
-		if !e.matchKeywords(rule.Match.Keywords, err.Message, err.Raw) {
-			return false
-		}
-	}
-
-	return true
-}
-
-func (e *Engine) matchNamespace(allowed []string, namespace string) bool {
-	for _, ns := range allowed {
-		// Support negation with !
-		if strings.HasPrefix(ns, "!") {
-			if namespace == ns[1:] {
-				return false
-			}
-		} else if namespace == ns {
-			return true
-		}
-	}
-
-	// If all rules are negations, and none matched, allow
-	allNegations := true
-	for _, ns := range allowed {
-		if !strings.HasPrefix(ns, "!") {
-			allNegations = false
-			break
-		}
-	}
-	return allNegations
-}
-
-func (e *Engine) matchLabels(matchers map[string]string, labels map[string]string) bool {
-	for key, expected := range matchers {
-		actual, exists := labels[key]
-
-		// Support negation with !
-		if strings.HasPrefix(expected, "!") {
-			if actual == expected[1:] {
-				return false
-			}
-			continue
-		}
-
-		if !exists {
-			return false
-		}
-
-		// Support regex matching with ~
-		if strings.HasPrefix(expected, "~") {
-			re, err := regexp.Compile(expected[1:])
-			if err != nil {
-				return false
-			}
-			if !re.MatchString(actual) {
-				return false
-			}
-			continue
-		}
-
-		if actual != expected {
-			return false
-		}
-	}
-	return true
-}
-
-func (e *Engine) matchKeywords(keywords []string, message, raw string) bool {
-	combined := strings.ToLower(message + " " + raw)
-	for _, kw := range keywords {
-		if strings.Contains(combined, strings.ToLower(kw)) {
-			return true
-		}
-	}
-	return false
-}
-
 // TestPattern tests if a pattern matches sample text
 func (e *Engine) TestPattern(pattern, sample string) (bool, error) {
 	re, err := regexp.Compile(pattern)
@@ -0,0 +1,240 @@
+package rules
+
+import (
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+func newTestEngine(t *testing.T, yaml string) *Engine {
+	t.Helper()
+
+	rules, err := ParseRules([]byte(yaml))
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+	e, err := NewEngine(rules, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return e
+}
+
+func TestMatchCaptures(t *testing.T) {
+	e := newTestEngine(t, `
+rules:
+  - name: worker-saturated
+    match:
+      pattern: 'queue full.*deployment=(?P<deployment>[a-z0-9-]+) namespace=(?P<namespace>[a-z-]+)'
+    priority: P2
+    labels:
+      team: platform
+    continue: true
+    enabled: true
+  - name: tagged
+    match:
+      keywords: [queue full]
+      labels:
+        deployment: checkout
+    priority: P3
+    enabled: true
+`)
+
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		wantLabels   map[string]string
+		wantCaptures map[string]string
+		wantRules    []string
+	}{
+		{
+			name:         "captures become labels",
+			labels:       map[string]string{"app": "worker"},
+			wantLabels:   map[string]string{"app": "worker", "deployment": "checkout", "namespace": "other", "team": "platform"},
+			wantCaptures: map[string]string{"deployment": "checkout", "namespace": "other"},
+			wantRules:    []string{"worker-saturated", "tagged"},
+		},
+		{
+			name:         "stream labels are kept",
+			labels:       map[string]string{"app": "worker", "namespace": "shop", "deployment": "worker"},
+			wantLabels:   map[string]string{"app": "worker", "namespace": "shop", "deployment": "worker", "team": "platform"},
+			wantCaptures: map[string]string{"deployment": "checkout", "namespace": "other"},
+			wantRules:    []string{"worker-saturated"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := maps.Clone(tt.labels)
+			matched := e.Match(loki.ParsedError{
+				Fingerprint: "fp",
+				Namespace:   "shop",
+				Message:     "queue full, deployment=checkout namespace=other",
+				Labels:      labels,
+			})
+			if matched == nil {
+				t.Fatal("no match")
+			}
+
+			if !maps.Equal(matched.Labels, tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", matched.Labels, tt.wantLabels)
+			}
+			if !maps.Equal(matched.Captures, tt.wantCaptures) {
+				t.Errorf("captures = %v, want %v", matched.Captures, tt.wantCaptures)
+			}
+			if !maps.Equal(labels, tt.labels) {
+				t.Errorf("the parsed error's labels were modified: %v", labels)
+			}
+			if !slices.Equal(matched.Rules, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", matched.Rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestRemediationParamTemplates(t *testing.T) {
+	tests := []struct {
+		name              string
+		param             string
+		value             string
+		templateNamespace bool
+		wantErr           string
+	}{
+		{name: "deployment", param: "deployment", value: "{{.Captures.deployment}}"},
+		{name: "static script", param: "script", value: "kubectl get pods"},
+		{name: "namespace with template_namespace", param: "namespace", value: "{{.Namespace}}-jobs", templateNamespace: true},
+		{name: "namespace", param: "namespace", value: "{{.Captures.ns}}", wantErr: "remediation.params.namespace: only deployment"},
+		{name: "script", param: "script", value: "echo {{.Message}}", wantErr: "remediation.params.script: only deployment"},
+		{name: "syntax", param: "deployment", value: "{{.Captures.deployment", wantErr: "remediation.params.deployment: template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(`
+rules:
+  - name: r
+    match:
+      keywords: [error]
+    priority: P2
+    remediation:
+      action: scale-up
+      params:
+        ` + tt.param + `: '` + tt.value + `'
+      template_namespace: ` + strconv.FormatBool(tt.templateNamespace) + `
+    enabled: true
+`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchContinue(t *testing.T) {
+	e := newTestEngine(t, `
+rules:
+  - name: audit
+    match:
+      keywords: [error]
+    priority: P4
+    labels:
+      audited: "yes"
+    continue: true
+    enabled: true
+  - name: paused
+    match:
+      keywords: [timeout]
+    priority: P1
+  - name: timeout
+    match:
+      keywords: [timeout]
+      labels:
+        audited: "yes"
+    priority: P2
+    group_by: [namespace, rule]
+    enabled: true
+  - name: after-timeout
+    match:
+      keywords: [timeout]
+    priority: P1
+    enabled: true
+  - name: catch-all
+    match:
+      keywords: [error]
+    priority: P3
+    enabled: true
+`)
+
+	// Disabled rules are skipped
+	rules := e.GetRules()
+	rules[1].Enabled = false
+	if err := e.UpdateRules(rules); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		message      string
+		wantRule     string
+		wantPriority Priority
+		wantRules    []string
+		wantGrouped  bool
+	}{
+		{
+			name:         "continue reaches the deciding rule",
+			message:      "error: upstream timeout",
+			wantRule:     "timeout",
+			wantPriority: PriorityHigh,
+			wantRules:    []string{"audit", "timeout"},
+			wantGrouped:  true,
+		},
+		{
+			name:         "later rules decide",
+			message:      "error: disk full",
+			wantRule:     "catch-all",
+			wantPriority: PriorityMedium,
+			wantRules:    []string{"audit", "catch-all"},
+		},
+		{
+			name:         "tags need the tagging rule to match",
+			message:      "timeout",
+			wantRule:     "after-timeout",
+			wantPriority: PriorityCritical,
+			wantRules:    []string{"after-timeout"},
+		},
+		{
+			name:         "no match",
+			message:      "warning: slow query",
+			wantRule:     "default",
+			wantPriority: PriorityLow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched := e.Match(loki.ParsedError{Fingerprint: "fp", Namespace: "shop", Message: tt.message})
+
+			if matched.RuleName != tt.wantRule || matched.Priority != tt.wantPriority {
+				t.Errorf("got %s/%s, want %s/%s", matched.RuleName, matched.Priority, tt.wantRule, tt.wantPriority)
+			}
+			if !slices.Equal(matched.Rules, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", matched.Rules, tt.wantRules)
+			}
+			if grouped := matched.Fingerprint != "fp"; grouped != tt.wantGrouped {
+				t.Errorf("grouped fingerprint = %v, want %v: the deciding rule's group_by applies", grouped, tt.wantGrouped)
+			}
+		})
+	}
+}
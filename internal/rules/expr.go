@@ -0,0 +1,149 @@
+package rules
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+// exprEnv declares the variables available to match expressions. The
+// namespace is ns because namespace is a reserved word in CEL.
+var exprEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("message", cel.StringType),
+		cel.Variable("raw", cel.StringType),
+		cel.Variable("ns", cel.StringType),
+		cel.Variable("pod", cel.StringType),
+		cel.Variable("container", cel.StringType),
+		cel.Variable("labels", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("fields", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("count", cel.IntType),
+	)
+})
+
+// compileExpr type-checks a match expression, which must evaluate to bool
+func compileExpr(expr string) (cel.Program, error) {
+	env, err := exprEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("must evaluate to bool, not %s", ast.OutputType())
+	}
+
+	return env.Program(ast, cel.EvalOptions(cel.OptTrackCost))
+}
+
+// evalContext carries what expressions need beyond the error itself
+type evalContext struct {
+	rule  *Rule
+	stats *ruleStats
+
+	// occurrences looks up stored occurrences by fingerprint; counts
+	// caches them for the error being matched
+	occurrences func(fingerprint string) int
+	counts      map[string]int64
+}
+
+// count returns the occurrences of err so far, including this one. They
+// are counted under the fingerprint the current rule would store err by,
+// its group fingerprint when it has group_by.
+func (ec *evalContext) count(err *loki.ParsedError) int64 {
+	if ec == nil || ec.occurrences == nil {
+		return 1
+	}
+
+	fingerprint := err.Fingerprint
+	if ec.rule != nil && len(ec.rule.GroupBy) > 0 {
+		fingerprint = groupFingerprint(*ec.rule, *err)
+	}
+
+	n, ok := ec.counts[fingerprint]
+	if !ok {
+		n = int64(ec.occurrences(fingerprint)) + 1
+		if ec.counts == nil {
+			ec.counts = make(map[string]int64)
+		}
+		ec.counts[fingerprint] = n
+	}
+	return n
+}
+
+// evalExpr evaluates a compiled expression against err. Evaluation errors,
+// e.g. from a missing map key, count as no match.
+func (c *compiledMatch) evalExpr(err *loki.ParsedError, ec *evalContext) bool {
+	vars := map[string]any{
+		"message":   err.Message,
+		"raw":       err.Raw,
+		"ns":        err.Namespace,
+		"pod":       err.Pod,
+		"container": err.Container,
+		"labels":    nonNil(err.Labels),
+		"fields":    nonNil(err.Fields),
+		"count": func() ref.Val {
+			return types.Int(ec.count(err))
+		},
+	}
+
+	out, details, evalErr := c.expr.Eval(vars)
+
+	if ec != nil && ec.stats != nil {
+		ec.stats.exprEvals.Add(1)
+		if details != nil && details.ActualCost() != nil {
+			ec.stats.exprCost.Add(*details.ActualCost())
+		}
+		if evalErr != nil {
+			ec.stats.exprErrors.Add(1)
+		}
+	}
+
+	if evalErr != nil {
+		return false
+	}
+	matched, _ := out.Value().(bool)
+	return matched
+}
+
+func nonNil(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// ruleStats counts a rule's matches and the cost of its expressions
+type ruleStats struct {
+	matches    atomic.Uint64
+	exprEvals  atomic.Uint64
+	exprErrors atomic.Uint64
+	exprCost   atomic.Uint64
+}
+
+// RuleStats reports how often a rule matched and what evaluating its
+// expressions cost, in CEL cost units
+type RuleStats struct {
+	Name            string `json:"name"`
+	Matches         uint64 `json:"matches"`
+	ExprEvaluations uint64 `json:"expr_evaluations,omitempty"`
+	ExprErrors      uint64 `json:"expr_errors,omitempty"`
+	ExprCost        uint64 `json:"expr_cost,omitempty"`
+}
+
+// AvgExprCost returns the average cost of one expression evaluation
+func (s RuleStats) AvgExprCost() float64 {
+	if s.ExprEvaluations == 0 {
+		return 0
+	}
+	return float64(s.ExprCost) / float64(s.ExprEvaluations)
+}
@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+func TestExprValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "bool", expr: `message.contains("timeout") && count > 1`},
+		{name: "map access", expr: `labels.app == "web" && int(fields.status) >= 500`},
+		{name: "syntax", expr: `message.contains(`, wantErr: "Syntax error"},
+		{name: "unknown variable", expr: `severity == "high"`, wantErr: "undeclared reference"},
+		{name: "not bool", expr: `count + 1`, wantErr: "must evaluate to bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(`
+rules:
+  - name: r
+    match:
+      expr: '` + tt.expr + `'
+    priority: P2
+    enabled: true
+`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExprMatch(t *testing.T) {
+	base := loki.ParsedError{
+		Fingerprint: "fp",
+		Namespace:   "shop",
+		Pod:         "checkout-7d9f8-abcde",
+		Container:   "app",
+		Message:     "request failed after 7200ms",
+		Raw:         `level=error msg="request failed after 7200ms" duration_ms=7200`,
+		Labels:      map[string]string{"app": "checkout"},
+		Fields:      map[string]string{"duration_ms": "7200"},
+	}
+
+	tests := []struct {
+		name       string
+		expr       string
+		wantMatch  bool
+		wantErrors uint64
+	}{
+		{name: "message", expr: `message.startsWith("request failed")`, wantMatch: true},
+		{name: "raw", expr: `raw.contains("level=error")`, wantMatch: true},
+		{name: "kubernetes", expr: `ns == "shop" && pod.startsWith("checkout") && container == "app"`, wantMatch: true},
+		{name: "readme example", expr: `ns.startsWith("shop") && "duration_ms" in fields && int(fields.duration_ms) > 5000 && count >= 1`, wantMatch: true},
+		{name: "labels", expr: `labels.app == "checkout"`, wantMatch: true},
+		{name: "fields", expr: `int(fields.duration_ms) > 5000`, wantMatch: true},
+		{name: "no match", expr: `int(fields.duration_ms) > 10000`},
+		{name: "missing key", expr: `labels.team == "payments"`, wantErrors: 1},
+		{name: "guarded missing key", expr: `"team" in labels && labels.team == "payments"`},
+		{name: "count without a store", expr: `count == 1`, wantMatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, `
+rules:
+  - name: r
+    match:
+      expr: '`+tt.expr+`'
+    priority: P2
+    enabled: true
+`)
+			matched := e.Match(base)
+			if got := matched.RuleName == "r"; got != tt.wantMatch {
+				t.Errorf("matched = %v, want %v", got, tt.wantMatch)
+			}
+
+			stats := e.Stats()[0]
+			if stats.ExprEvaluations != 1 || stats.ExprErrors != tt.wantErrors {
+				t.Errorf("evaluations = %d, errors = %d; want 1, %d", stats.ExprEvaluations, stats.ExprErrors, tt.wantErrors)
+			}
+			if stats.ExprCost == 0 {
+				t.Error("expression cost not tracked")
+			}
+		})
+	}
+}
+
+func TestExprCountFingerprint(t *testing.T) {
+	err := loki.ParsedError{Fingerprint: "source-fp", Namespace: "shop", Pod: "web-1", Message: "boom"}
+
+	tests := []struct {
+		name        string
+		groupBy     []string
+		storedUnder string // source or group
+		wantMatch   bool
+	}{
+		{name: "per source", storedUnder: "source", wantMatch: true},
+		{name: "per source ignores groups", storedUnder: "group"},
+		{name: "per group", groupBy: []string{GroupByNamespace, GroupByRule}, storedUnder: "group", wantMatch: true},
+		{name: "per group ignores the source", groupBy: []string{GroupByNamespace, GroupByRule}, storedUnder: "source"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{
+				Name:     "frequent",
+				Match:    Match{Expr: "count >= 3"},
+				Priority: PriorityMedium,
+				GroupBy:  tt.groupBy,
+				Enabled:  true,
+			}
+			e, newErr := NewEngine([]Rule{rule}, nil)
+			if newErr != nil {
+				t.Fatal(newErr)
+			}
+
+			// Two earlier occurrences, stored under one of the fingerprints
+			fingerprint := err.Fingerprint
+			if tt.storedUnder == "group" {
+				grouped := rule
+				grouped.GroupBy = []string{GroupByNamespace, GroupByRule}
+				fingerprint = groupFingerprint(grouped, err)
+			}
+			e.SetOccurrenceCounter(func(fp string) int {
+				if fp == fingerprint {
+					return 2
+				}
+				return 0
+			})
+
+			matched := e.Match(err)
+			if got := matched.RuleName == "frequent"; got != tt.wantMatch {
+				t.Fatalf("matched = %v, want %v", got, tt.wantMatch)
+			}
+			if tt.wantMatch && matched.Fingerprint != fingerprint {
+				t.Errorf("stored under %s, but count was looked up under %s", matched.Fingerprint, fingerprint)
+			}
+		})
+	}
+}
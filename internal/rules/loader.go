@@ -104,6 +104,18 @@ func DefaultRules() []Rule {
 			},
 			Enabled: true,
 		},
+		{
+			Name: "container-config-error",
+			Match: Match{
+				Pattern: `CreateContainerConfigError|CreateContainerError|RunContainerError|InvalidImageName`,
+			},
+			Priority: PriorityHigh,
+			Remediation: &Remediation{
+				Action:   ActionNone, // Needs a config or secret fix
+				Cooldown: 5 * time.Minute,
+			},
+			Enabled: true,
+		},
 		{
 			Name: "readiness-probe-failed",
 			Match: Match{
@@ -0,0 +1,380 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+// compiledMatch is a Match with its regular expressions compiled. The flat
+// conditions and the all/any/not children of a node are ANDed together.
+type compiledMatch struct {
+	pattern    *regexp.Regexp
+	keywords   []string // lower case
+	labels     []valueMatcher
+	fields     []valueMatcher
+	namespaces []string
+	sources    []string
+	tenants    []string
+	expr       cel.Program
+
+	all []*compiledMatch
+	any []*compiledMatch
+	not *compiledMatch
+
+	// named is set when the node or its all/any children have patterns
+	// with named capture groups
+	named bool
+}
+
+// valueMatcher matches one label or field value: "value" for equality,
+// "~regex" for a regex and "!value" for inequality
+type valueMatcher struct {
+	key    string
+	value  string
+	re     *regexp.Regexp
+	negate bool
+}
+
+// compileMatch validates and compiles a condition tree. path names the
+// node in error messages, e.g. "match.all[1].not".
+func compileMatch(m Match, path string) (*compiledMatch, error) {
+	if m.empty() {
+		return nil, fmt.Errorf("%s: condition is empty", path)
+	}
+
+	c := &compiledMatch{
+		namespaces: m.Namespaces,
+		sources:    m.Sources,
+		tenants:    m.Tenants,
+	}
+
+	if m.Pattern != "" {
+		re, err := regexp.Compile(m.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s.pattern: %w", path, err)
+		}
+		c.pattern = re
+		c.named = slices.ContainsFunc(re.SubexpNames(), func(name string) bool { return name != "" })
+	}
+
+	for _, kw := range m.Keywords {
+		c.keywords = append(c.keywords, strings.ToLower(kw))
+	}
+
+	if m.Expr != "" {
+		prg, err := compileExpr(m.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s.expr: %w", path, err)
+		}
+		c.expr = prg
+	}
+
+	var err error
+	if c.labels, err = compileValueMatchers(m.Labels, path+".labels"); err != nil {
+		return nil, err
+	}
+	if c.fields, err = compileValueMatchers(m.Fields, path+".fields"); err != nil {
+		return nil, err
+	}
+
+	for i, child := range m.All {
+		cc, err := compileMatch(child, fmt.Sprintf("%s.all[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		c.all = append(c.all, cc)
+		c.named = c.named || cc.named
+	}
+	for i, child := range m.Any {
+		cc, err := compileMatch(child, fmt.Sprintf("%s.any[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		c.any = append(c.any, cc)
+		c.named = c.named || cc.named
+	}
+	if m.Not != nil {
+		if c.not, err = compileMatch(*m.Not, path+".not"); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func compileValueMatchers(matchers map[string]string, path string) ([]valueMatcher, error) {
+	compiled := make([]valueMatcher, 0, len(matchers))
+	for key, expected := range matchers {
+		vm := valueMatcher{key: key}
+		switch {
+		case strings.HasPrefix(expected, "!"):
+			vm.negate = true
+			vm.value = expected[1:]
+		case strings.HasPrefix(expected, "~"):
+			re, err := regexp.Compile(expected[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", path, key, err)
+			}
+			vm.re = re
+		default:
+			vm.value = expected
+		}
+		compiled = append(compiled, vm)
+	}
+	return compiled, nil
+}
+
+// match reports whether err satisfies every condition of the node. ec may
+// be nil when the tree has no expressions.
+func (c *compiledMatch) match(err *loki.ParsedError, ec *evalContext) bool {
+	if len(c.namespaces) > 0 && !matchAllowList(c.namespaces, err.Namespace) {
+		return false
+	}
+	if len(c.sources) > 0 && !matchAllowList(c.sources, err.Source) {
+		return false
+	}
+	if len(c.tenants) > 0 && !matchAllowList(c.tenants, err.Tenant) {
+		return false
+	}
+	if !matchValues(c.labels, err.Labels) || !matchValues(c.fields, err.Fields) {
+		return false
+	}
+
+	// Match against both message and raw log line
+	if c.pattern != nil && !c.pattern.MatchString(err.Message) && !c.pattern.MatchString(err.Raw) {
+		return false
+	}
+
+	if len(c.keywords) > 0 && !matchKeywords(c.keywords, err.Message, err.Raw) {
+		return false
+	}
+
+	// Expressions are the most expensive condition, so they go last
+	if c.expr != nil && !c.evalExpr(err, ec) {
+		return false
+	}
+
+	for _, child := range c.all {
+		if !child.match(err, ec) {
+			return false
+		}
+	}
+
+	if len(c.any) > 0 {
+		matched := false
+		for _, child := range c.any {
+			if child.match(err, ec) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if c.not != nil && c.not.match(err, ec) {
+		return false
+	}
+
+	return true
+}
+
+// captures returns the named groups of the node's patterns, taken from the
+// message or else the raw line. Only call it on a matching node; of the any
+// children only those that match contribute.
+func (c *compiledMatch) captures(err *loki.ParsedError, ec *evalContext) map[string]string {
+	if !c.named {
+		return nil
+	}
+	into := make(map[string]string)
+	c.addCaptures(err, ec, into)
+	return into
+}
+
+func (c *compiledMatch) addCaptures(err *loki.ParsedError, ec *evalContext, into map[string]string) {
+	if !c.named {
+		return
+	}
+
+	if c.pattern != nil {
+		sub := c.pattern.FindStringSubmatch(err.Message)
+		if sub == nil {
+			sub = c.pattern.FindStringSubmatch(err.Raw)
+		}
+		for i, name := range c.pattern.SubexpNames() {
+			if name != "" && i < len(sub) && sub[i] != "" {
+				into[name] = sub[i]
+			}
+		}
+	}
+
+	for _, child := range c.all {
+		child.addCaptures(err, ec, into)
+	}
+	for _, child := range c.any {
+		if child.named && child.match(err, ec) {
+			child.addCaptures(err, ec, into)
+		}
+	}
+}
+
+// matchAllowList checks value against a list of names, where entries
+// prefixed with ! exclude a name
+func matchAllowList(allowed []string, value string) bool {
+	for _, name := range allowed {
+		// Support negation with !
+		if strings.HasPrefix(name, "!") {
+			if value == name[1:] {
+				return false
+			}
+		} else if value == name {
+			return true
+		}
+	}
+
+	// If all rules are negations, and none matched, allow
+	allNegations := true
+	for _, name := range allowed {
+		if !strings.HasPrefix(name, "!") {
+			allNegations = false
+			break
+		}
+	}
+	return allNegations
+}
+
+func matchValues(matchers []valueMatcher, values map[string]string) bool {
+	for _, vm := range matchers {
+		actual, exists := values[vm.key]
+
+		if vm.negate {
+			if actual == vm.value {
+				return false
+			}
+			continue
+		}
+
+		if !exists {
+			return false
+		}
+
+		if vm.re != nil {
+			if !vm.re.MatchString(actual) {
+				return false
+			}
+			continue
+		}
+
+		if actual != vm.value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchKeywords reports whether any of the lower case keywords occurs in
+// the message or raw line
+func matchKeywords(keywords []string, message, raw string) bool {
+	combined := strings.ToLower(message + " " + raw)
+	for _, kw := range keywords {
+		if strings.Contains(combined, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// empty reports whether the node has no conditions at all
+func (m Match) empty() bool {
+	return m.Pattern == "" && m.Expr == "" && len(m.Keywords) == 0 && len(m.Labels) == 0 &&
+		len(m.Fields) == 0 && len(m.Namespaces) == 0 && len(m.Sources) == 0 &&
+		len(m.Tenants) == 0 && len(m.All) == 0 && len(m.Any) == 0 && m.Not == nil
+}
+
+// hasContent reports whether the tree matches on the error itself (its
+// pattern, keywords, fields or an expression) somewhere, not only on where
+// it came from
+func (m Match) hasContent() bool {
+	if m.Pattern != "" || m.Expr != "" || len(m.Keywords) > 0 || len(m.Fields) > 0 {
+		return true
+	}
+	for _, child := range m.All {
+		if child.hasContent() {
+			return true
+		}
+	}
+	for _, child := range m.Any {
+		if child.hasContent() {
+			return true
+		}
+	}
+	return m.Not != nil && m.Not.hasContent()
+}
+
+// Nested reports whether the match uses all, any, not or an expression,
+// which the rules page shows as a condition string
+func (m Match) Nested() bool {
+	return len(m.All) > 0 || len(m.Any) > 0 || m.Not != nil || m.Expr != ""
+}
+
+// String renders the condition tree, e.g.
+// pattern /timeout/ and not (namespace in [dev])
+func (m Match) String() string {
+	var parts []string
+	if m.Pattern != "" {
+		parts = append(parts, fmt.Sprintf("pattern /%s/", m.Pattern))
+	}
+	if len(m.Keywords) > 0 {
+		parts = append(parts, fmt.Sprintf("keywords %v", m.Keywords))
+	}
+	parts = append(parts, valueConditions("labels", m.Labels)...)
+	parts = append(parts, valueConditions("fields", m.Fields)...)
+	if len(m.Namespaces) > 0 {
+		parts = append(parts, fmt.Sprintf("namespace in %v", m.Namespaces))
+	}
+	if len(m.Sources) > 0 {
+		parts = append(parts, fmt.Sprintf("source in %v", m.Sources))
+	}
+	if len(m.Tenants) > 0 {
+		parts = append(parts, fmt.Sprintf("tenant in %v", m.Tenants))
+	}
+	if m.Expr != "" {
+		parts = append(parts, "expr `"+m.Expr+"`")
+	}
+	for _, child := range m.All {
+		parts = append(parts, "("+child.String()+")")
+	}
+	if len(m.Any) > 0 {
+		alternatives := make([]string, len(m.Any))
+		for i, child := range m.Any {
+			alternatives[i] = child.String()
+		}
+		parts = append(parts, "("+strings.Join(alternatives, " or ")+")")
+	}
+	if m.Not != nil {
+		parts = append(parts, "not ("+m.Not.String()+")")
+	}
+	return strings.Join(parts, " and ")
+}
+
+func valueConditions(kind string, matchers map[string]string) []string {
+	keys := make([]string, 0, len(matchers))
+	for k := range matchers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	conditions := make([]string, len(keys))
+	for i, k := range keys {
+		conditions[i] = fmt.Sprintf("%s.%s=%s", kind, k, matchers[k])
+	}
+	return conditions
+}
@@ -0,0 +1,115 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+// Threshold makes a rule apply only once it matched Count times within
+// Window. Occurrences are counted separately per group key built from
+// GroupBy, which takes the same keys as Rule.GroupBy; without GroupBy the
+// rule has a single window.
+type Threshold struct {
+	Count   int           `yaml:"count"`
+	Window  time.Duration `yaml:"window"`
+	GroupBy []string      `yaml:"group_by,omitempty"`
+}
+
+// String returns the threshold as e.g. "20 in 5m0s per namespace"
+func (t Threshold) String() string {
+	s := fmt.Sprintf("%d in %s", t.Count, t.Window)
+	if len(t.GroupBy) > 0 {
+		s += " per " + strings.Join(t.GroupBy, ", ")
+	}
+	return s
+}
+
+func (t Threshold) validate() error {
+	if t.Count < 1 {
+		return fmt.Errorf("threshold.count must be >= 1")
+	}
+	if t.Window <= 0 {
+		return fmt.Errorf("threshold.window must be > 0")
+	}
+	for _, key := range t.GroupBy {
+		if !validGroupKey(key) {
+			return fmt.Errorf("unknown threshold.group_by key %q", key)
+		}
+	}
+	return nil
+}
+
+// slidingWindow counts a rule's recent matches per group key. Only the
+// newest Count timestamps of a key are kept, which is enough to tell
+// whether the threshold is reached.
+type slidingWindow struct {
+	threshold Threshold
+
+	mu        sync.Mutex
+	groups    map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newSlidingWindow(t Threshold) *slidingWindow {
+	return &slidingWindow{
+		threshold: t,
+		groups:    make(map[string][]time.Time),
+	}
+}
+
+// record adds an occurrence at ts and returns the number of occurrences
+// within the window ending at ts, and whether this one reached the count
+func (w *slidingWindow) record(key string, ts time.Time) (count int, reached bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cutoff := ts.Add(-w.threshold.Window)
+	times := prune(w.groups[key], cutoff)
+	before := len(times)
+
+	// Keep timestamps ordered; sources deliver them mostly in order
+	i := sort.Search(len(times), func(i int) bool { return times[i].After(ts) })
+	times = append(times, time.Time{})
+	copy(times[i+1:], times[i:])
+	times[i] = ts
+	if len(times) > w.threshold.Count {
+		times = times[len(times)-w.threshold.Count:]
+	}
+	w.groups[key] = times
+
+	// Forget groups that went quiet
+	if ts.Sub(w.lastSweep) > w.threshold.Window {
+		for k, t := range w.groups {
+			if len(t) == 0 || t[len(t)-1].Before(cutoff) {
+				delete(w.groups, k)
+			}
+		}
+		w.lastSweep = ts
+	}
+
+	count = len(times)
+	return count, before < w.threshold.Count && count >= w.threshold.Count
+}
+
+// prune drops timestamps before cutoff
+func prune(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// thresholdKey builds the window group key of an error
+func thresholdKey(rule Rule, err loki.ParsedError) string {
+	var b strings.Builder
+	for _, key := range rule.Threshold.GroupBy {
+		fmt.Fprintf(&b, "%s=%q|", key, groupValue(key, rule, err))
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+)
+
+func TestMatchThreshold(t *testing.T) {
+	const rules = `
+rules:
+  - name: refused-burst
+    match:
+      keywords: [connection refused]
+    priority: P1
+    threshold:
+      count: 3
+      window: 1m
+      group_by: [namespace]
+    enabled: true
+  - name: refused
+    match:
+      keywords: [connection refused]
+    priority: P3
+    enabled: true
+`
+
+	type occurrence struct {
+		at        time.Duration
+		namespace string
+	}
+	tests := []struct {
+		name        string
+		occurrences []occurrence
+		wantRules   []string
+		wantCounts  []int
+		wantReached []bool
+	}{
+		{
+			name:        "reached on the third occurrence",
+			occurrences: []occurrence{{0, "shop"}, {10 * time.Second, "shop"}, {20 * time.Second, "shop"}, {30 * time.Second, "shop"}},
+			wantRules:   []string{"refused", "refused", "refused-burst", "refused-burst"},
+			wantCounts:  []int{0, 0, 3, 3},
+			wantReached: []bool{false, false, true, false},
+		},
+		{
+			name:        "occurrences outside the window expire",
+			occurrences: []occurrence{{0, "shop"}, {10 * time.Second, "shop"}, {90 * time.Second, "shop"}, {100 * time.Second, "shop"}},
+			wantRules:   []string{"refused", "refused", "refused", "refused"},
+			wantCounts:  []int{0, 0, 0, 0},
+			wantReached: []bool{false, false, false, false},
+		},
+		{
+			name:        "groups are counted separately",
+			occurrences: []occurrence{{0, "shop"}, {time.Second, "auth"}, {2 * time.Second, "shop"}, {3 * time.Second, "auth"}, {4 * time.Second, "shop"}},
+			wantRules:   []string{"refused", "refused", "refused", "refused", "refused-burst"},
+			wantCounts:  []int{0, 0, 0, 0, 3},
+			wantReached: []bool{false, false, false, false, true},
+		},
+		{
+			name:        "late occurrences count within their window",
+			occurrences: []occurrence{{30 * time.Second, "shop"}, {0, "shop"}, {40 * time.Second, "shop"}},
+			wantRules:   []string{"refused", "refused", "refused-burst"},
+			wantCounts:  []int{0, 0, 3},
+			wantReached: []bool{false, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, rules)
+			base := time.Unix(1700000000, 0)
+			for i, o := range tt.occurrences {
+				matched := e.Match(loki.ParsedError{
+					Fingerprint: "fp",
+					Timestamp:   base.Add(o.at),
+					Namespace:   o.namespace,
+					Message:     "dial tcp: connection refused",
+				})
+				if matched.RuleName != tt.wantRules[i] || matched.WindowCount != tt.wantCounts[i] || matched.ThresholdReached != tt.wantReached[i] {
+					t.Errorf("occurrence %d: got %s count %d reached %v, want %s count %d reached %v", i,
+						matched.RuleName, matched.WindowCount, matched.ThresholdReached,
+						tt.wantRules[i], tt.wantCounts[i], tt.wantReached[i])
+				}
+			}
+		})
+	}
+}
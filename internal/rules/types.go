@@ -2,6 +2,8 @@ package rules
 
 import (
 	"fmt"
+	"strings"
+	"text/template"
 	"time"
 )
 
@@ -105,21 +107,80 @@ type Rule struct {
 	Priority    Priority     `yaml:"priority"`
 	Remediation *Remediation `yaml:"remediation,omitempty"`
 	Enabled     bool         `yaml:"enabled"`
+
+	// GroupBy replaces the error's fingerprint with one built from these
+	// keys, so e.g. every crash of a workload becomes a single error
+	GroupBy []string `yaml:"group_by,omitempty"`
+
+	// Threshold makes the rule apply only once it matched often enough
+	// within a sliding window
+	Threshold *Threshold `yaml:"threshold,omitempty"`
+
+	// Continue keeps evaluating the following rules after this one
+	// matched, e.g. for rules that only tag errors with Labels
+	Continue bool `yaml:"continue,omitempty"`
+
+	// Labels are added to the error when the rule matches, before the
+	// following rules are evaluated
+	Labels map[string]string `yaml:"labels,omitempty"`
 }
 
-// Match defines the conditions for matching an error
+// Grouping keys for Rule.GroupBy. Labels and fields are grouped by with
+// "labels.<name>" and "fields.<name>".
+const (
+	GroupBySource      = "source"
+	GroupByTenant      = "tenant"
+	GroupByNamespace   = "namespace"
+	GroupByWorkload    = "workload"
+	GroupByDeployment  = "deployment" // alias of workload
+	GroupByPod         = "pod"
+	GroupByContainer   = "container"
+	GroupByRule        = "rule"
+	GroupByFingerprint = "fingerprint" // the error's own fingerprint
+)
+
+// Match defines the conditions for matching an error. All conditions must
+// hold; keywords match when any of them occurs. All, Any and Not nest
+// further matches: every one of All, at least one of Any and not Not.
 type Match struct {
 	Pattern    string            `yaml:"pattern"`              // Regex pattern
 	Keywords   []string          `yaml:"keywords,omitempty"`   // Simple keyword match
 	Labels     map[string]string `yaml:"labels,omitempty"`     // Label matchers
+	Fields     map[string]string `yaml:"fields,omitempty"`     // Structured field matchers, same syntax as labels
 	Namespaces []string          `yaml:"namespaces,omitempty"` // Namespace whitelist
+	Sources    []string          `yaml:"sources,omitempty"`    // Source name whitelist
+	Tenants    []string          `yaml:"tenants,omitempty"`    // Loki tenant whitelist
+	Expr       string            `yaml:"expr,omitempty"`       // CEL expression, see exprEnv
+
+	All []Match `yaml:"all,omitempty"`
+	Any []Match `yaml:"any,omitempty"`
+	Not *Match  `yaml:"not,omitempty"`
 }
 
-// Remediation defines the action to take when a rule matches
+// Remediation defines the action to take when a rule matches. Params that
+// select the target are Go templates rendered when the action runs, see
+// remediation.ParamData.
 type Remediation struct {
 	Action   ActionType        `yaml:"action"`
 	Params   map[string]string `yaml:"params,omitempty"`
 	Cooldown time.Duration     `yaml:"cooldown"`
+
+	// TemplateNamespace allows the namespace param to be rendered from the
+	// error; otherwise it can only be a fixed value
+	TemplateNamespace bool `yaml:"template_namespace,omitempty"`
+}
+
+// Templated reports whether a param may be rendered from the error. Only
+// params selecting the target can be, so log lines can't inject scripts,
+// images or arguments into actions.
+func (r *Remediation) Templated(key string) bool {
+	switch key {
+	case "deployment":
+		return true
+	case "namespace":
+		return r.TemplateNamespace
+	}
+	return false
 }
 
 // RulesConfig represents the top-level rules configuration file
@@ -133,32 +194,89 @@ func (r *Rule) Validate() error {
 		return fmt.Errorf("rule name is required")
 	}
 
-	if r.Match.Pattern == "" && len(r.Match.Keywords) == 0 {
-		return fmt.Errorf("rule %s: either pattern or keywords is required", r.Name)
+	if !r.Match.hasContent() {
+		return fmt.Errorf("rule %s: either pattern, keywords, fields or expr is required", r.Name)
+	}
+
+	if _, err := compileMatch(r.Match, "match"); err != nil {
+		return fmt.Errorf("rule %s: %w", r.Name, err)
 	}
 
 	if _, err := ParsePriority(string(r.Priority)); err != nil {
 		return fmt.Errorf("rule %s: %w", r.Name, err)
 	}
 
+	for _, key := range r.GroupBy {
+		if !validGroupKey(key) {
+			return fmt.Errorf("rule %s: unknown group_by key %q", r.Name, key)
+		}
+	}
+
+	if r.Threshold != nil {
+		if err := r.Threshold.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+
+	if r.Remediation != nil {
+		for key, value := range r.Remediation.Params {
+			if !strings.Contains(value, "{{") {
+				continue
+			}
+			if !r.Remediation.Templated(key) {
+				return fmt.Errorf("rule %s: remediation.params.%s: only deployment and, with template_namespace, namespace can be templates", r.Name, key)
+			}
+			if _, err := template.New(key).Parse(value); err != nil {
+				return fmt.Errorf("rule %s: remediation.params.%s: %w", r.Name, key, err)
+			}
+		}
+	}
+
 	return nil
 }
 
+func validGroupKey(key string) bool {
+	switch key {
+	case GroupBySource, GroupByTenant, GroupByNamespace, GroupByWorkload, GroupByDeployment,
+		GroupByPod, GroupByContainer, GroupByRule, GroupByFingerprint:
+		return true
+	}
+	for _, prefix := range []string{"labels.", "fields."} {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // MatchedError represents an error that matched a rule
 type MatchedError struct {
 	ID          string
 	Fingerprint string
 	Timestamp   time.Time
+	Source      string
+	Tenant      string
 	Namespace   string
 	Pod         string
 	Container   string
 	Message     string
 	Labels      map[string]string
+	Fields      map[string]string
 	Raw         string
+	TemplateID  string
+	Template    string
 	Priority    Priority
 	RuleName    string
+	Rules       []string          // every matching rule in evaluation order, ending with RuleName
+	Captures    map[string]string // named groups of the matching rules' patterns, also in Labels unless the label exists
 	Count       int
 	FirstSeen   time.Time
 	LastSeen    time.Time
 	Remediated  bool
+
+	// WindowCount is the number of occurrences in the threshold window of
+	// the last matched threshold rule; ThresholdReached is set on the
+	// occurrence that reached the threshold of any matched rule
+	WindowCount      int
+	ThresholdReached bool
 }
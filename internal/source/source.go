@@ -0,0 +1,15 @@
+package source
+
+import (
+	"context"
+)
+
+// LogSource produces parsed errors and delivers them to the
+// loki.ErrorHandler it was constructed with
+type LogSource interface {
+	// Name identifies the source in logs, metrics and ParsedError.Source
+	Name() string
+
+	// Start runs the source until ctx is cancelled
+	Start(ctx context.Context) error
+}
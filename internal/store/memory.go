@@ -58,7 +58,7 @@ func NewMemoryStore(opts ...MemoryStoreOption) *MemoryStore {
 	return s
 }
 
-// SaveError stores an error
+// SaveError stores a copy of an error
 func (s *MemoryStore) SaveError(err *Error) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -66,15 +66,29 @@ func (s *MemoryStore) SaveError(err *Error) error {
 	// Check if we already have this error by fingerprint
 	if existing, ok := s.errorsByFP[err.Fingerprint]; ok {
 		// Update existing error
-		existing.Count++
-		existing.LastSeen = err.Timestamp
+		existing.Count += max(err.Count, 1)
+		if err.Timestamp.After(existing.LastSeen) {
+			existing.LastSeen = err.Timestamp
+		}
 		if err.Timestamp.Before(existing.FirstSeen) {
 			existing.FirstSeen = err.Timestamp
 		}
+		// Templates generalize as they learn, keep the latest form
+		if err.Template != "" {
+			existing.Template = err.Template
+		}
+		// A threshold rule that became active outranks the rule the
+		// error was first stored under
+		if err.Priority.Weight() < existing.Priority.Weight() {
+			existing.Priority = err.Priority
+			existing.RuleMatched = err.RuleMatched
+			existing.RulesMatched = err.RulesMatched
+		}
 		return nil
 	}
 
 	// Store new error
+	err = err.clone()
 	s.errors[err.ID] = err
 	s.errorsByFP[err.Fingerprint] = err
 
@@ -86,29 +100,51 @@ func (s *MemoryStore) SaveError(err *Error) error {
 	return nil
 }
 
-// GetError retrieves an error by ID
+// RecordOccurrence adds count occurrences to the error with the given
+// fingerprint and advances its LastSeen. It returns a copy of the updated
+// error.
+func (s *MemoryStore) RecordOccurrence(fingerprint string, seenAt time.Time, count int) (*Error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.errorsByFP[fingerprint]
+	if !ok {
+		return nil, fmt.Errorf("error not found with fingerprint: %s", fingerprint)
+	}
+
+	existing.Count += max(count, 1)
+	if seenAt.After(existing.LastSeen) {
+		existing.LastSeen = seenAt
+	}
+	if seenAt.Before(existing.FirstSeen) {
+		existing.FirstSeen = seenAt
+	}
+	return existing.clone(), nil
+}
+
+// GetError retrieves a copy of an error by ID
 func (s *MemoryStore) GetError(id string) (*Error, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	if err, ok := s.errors[id]; ok {
-		return err, nil
+		return err.clone(), nil
 	}
 	return nil, fmt.Errorf("error not found: %s", id)
 }
 
-// GetErrorByFingerprint retrieves an error by fingerprint
+// GetErrorByFingerprint retrieves a copy of an error by fingerprint
 func (s *MemoryStore) GetErrorByFingerprint(fingerprint string) (*Error, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	if err, ok := s.errorsByFP[fingerprint]; ok {
-		return err, nil
+		return err.clone(), nil
 	}
 	return nil, fmt.Errorf("error not found with fingerprint: %s", fingerprint)
 }
 
-// ListErrors returns errors matching the filter
+// ListErrors returns copies of the errors matching the filter
 func (s *MemoryStore) ListErrors(filter ErrorFilter, opts PaginationOptions) ([]*Error, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -117,7 +153,7 @@ func (s *MemoryStore) ListErrors(filter ErrorFilter, opts PaginationOptions) ([]
 	var filtered []*Error
 	for _, err := range s.errors {
 		if s.matchesFilter(err, filter) {
-			filtered = append(filtered, err)
+			filtered = append(filtered, err.clone())
 		}
 	}
 
@@ -156,11 +192,28 @@ func (s *MemoryStore) UpdateError(err *Error) error {
 		return fmt.Errorf("error not found: %s", err.ID)
 	}
 
+	err = err.clone()
 	s.errors[err.ID] = err
 	s.errorsByFP[err.Fingerprint] = err
 	return nil
 }
 
+// MarkRemediated flags an error as remediated without replacing it, so
+// occurrences counted concurrently are kept
+func (s *MemoryStore) MarkRemediated(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err, ok := s.errors[id]
+	if !ok {
+		return fmt.Errorf("error not found: %s", id)
+	}
+
+	err.Remediated = true
+	err.RemediatedAt = &at
+	return nil
+}
+
 // DeleteError removes an error by ID
 func (s *MemoryStore) DeleteError(id string) error {
 	s.mu.Lock()
@@ -317,6 +370,7 @@ func (s *MemoryStore) GetStats() (*Stats, error) {
 	for _, err := range s.errors {
 		stats.ErrorsByPriority[err.Priority]++
 		stats.ErrorsByNamespace[err.Namespace]++
+		stats.TotalOccurrences += err.Count
 		if err.LastSeen.After(lastError) {
 			lastError = err.LastSeen
 		}
@@ -349,6 +403,12 @@ func (s *MemoryStore) Close() error {
 }
 
 func (s *MemoryStore) matchesFilter(err *Error, filter ErrorFilter) bool {
+	if filter.Source != "" && err.Source != filter.Source {
+		return false
+	}
+	if filter.Tenant != "" && err.Tenant != filter.Tenant {
+		return false
+	}
 	if filter.Namespace != "" && err.Namespace != filter.Namespace {
 		return false
 	}
@@ -364,6 +424,14 @@ func (s *MemoryStore) matchesFilter(err *Error, filter ErrorFilter) bool {
 	if !filter.Since.IsZero() && err.LastSeen.Before(filter.Since) {
 		return false
 	}
+	if filter.TemplateID != "" && err.TemplateID != filter.TemplateID {
+		return false
+	}
+	for k, v := range filter.Fields {
+		if err.Fields[k] != v {
+			return false
+		}
+	}
 	if filter.Search != "" {
 		search := strings.ToLower(filter.Search)
 		if !strings.Contains(strings.ToLower(err.Message), search) &&
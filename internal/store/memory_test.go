@@ -0,0 +1,116 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+)
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now()
+
+	original := &Error{ID: "e1", Fingerprint: "fp", Priority: rules.PriorityMedium, Count: 1, FirstSeen: now, LastSeen: now}
+	if err := s.SaveError(original); err != nil {
+		t.Fatal(err)
+	}
+	original.Count = 100
+
+	got, err := s.GetErrorByFingerprint("fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 1 {
+		t.Errorf("stored Count = %d, want 1: SaveError must not keep the caller's error", got.Count)
+	}
+
+	got.Count = 50
+	counted, err := s.RecordOccurrence("fp", now.Add(time.Second), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counted.Count != 2 {
+		t.Errorf("RecordOccurrence Count = %d, want 2: returned errors must be copies", counted.Count)
+	}
+
+	if err := s.MarkRemediated("e1", now); err != nil {
+		t.Fatal(err)
+	}
+	if counted.Remediated {
+		t.Error("MarkRemediated changed a previously returned error")
+	}
+	byID, _ := s.GetError("e1")
+	if !byID.Remediated || byID.Count != 2 {
+		t.Errorf("GetError = remediated %v, count %d; want true, 2", byID.Remediated, byID.Count)
+	}
+}
+
+func TestMemoryStoreSaveErrorFolds(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		second       Error
+		wantPriority rules.Priority
+		wantRule     string
+		wantFirst    time.Time
+		wantLast     time.Time
+	}{
+		{
+			name:         "later occurrence",
+			second:       Error{ID: "e2", Fingerprint: "fp", Timestamp: now.Add(time.Minute), Priority: rules.PriorityMedium, RuleMatched: "a"},
+			wantPriority: rules.PriorityMedium,
+			wantRule:     "a",
+			wantFirst:    now,
+			wantLast:     now.Add(time.Minute),
+		},
+		{
+			name:         "earlier occurrence",
+			second:       Error{ID: "e2", Fingerprint: "fp", Timestamp: now.Add(-time.Minute), Priority: rules.PriorityMedium, RuleMatched: "a"},
+			wantPriority: rules.PriorityMedium,
+			wantRule:     "a",
+			wantFirst:    now.Add(-time.Minute),
+			wantLast:     now,
+		},
+		{
+			name:         "escalated by a higher priority rule",
+			second:       Error{ID: "e2", Fingerprint: "fp", Timestamp: now, Priority: rules.PriorityCritical, RuleMatched: "burst"},
+			wantPriority: rules.PriorityCritical,
+			wantRule:     "burst",
+			wantFirst:    now,
+			wantLast:     now,
+		},
+		{
+			name:         "lower priority keeps the rule",
+			second:       Error{ID: "e2", Fingerprint: "fp", Timestamp: now, Priority: rules.PriorityLow, RuleMatched: "default"},
+			wantPriority: rules.PriorityMedium,
+			wantRule:     "a",
+			wantFirst:    now,
+			wantLast:     now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			s.SaveError(&Error{ID: "e1", Fingerprint: "fp", Timestamp: now, Priority: rules.PriorityMedium, RuleMatched: "a", Count: 1, FirstSeen: now, LastSeen: now})
+			second := tt.second
+			s.SaveError(&second)
+
+			got, err := s.GetErrorByFingerprint("fp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != "e1" || got.Count != 2 {
+				t.Errorf("got %s with count %d, want e1 with count 2", got.ID, got.Count)
+			}
+			if got.Priority != tt.wantPriority || got.RuleMatched != tt.wantRule {
+				t.Errorf("got %s/%s, want %s/%s", got.RuleMatched, got.Priority, tt.wantRule, tt.wantPriority)
+			}
+			if !got.FirstSeen.Equal(tt.wantFirst) || !got.LastSeen.Equal(tt.wantLast) {
+				t.Errorf("seen %v..%v, want %v..%v", got.FirstSeen, got.LastSeen, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
@@ -11,6 +11,8 @@ type Error struct {
 	ID           string
 	Fingerprint  string
 	Timestamp    time.Time
+	Source       string
+	Tenant       string
 	Namespace    string
 	Pod          string
 	Container    string
@@ -20,15 +22,31 @@ type Error struct {
 	FirstSeen    time.Time
 	LastSeen     time.Time
 	RuleMatched  string
+	RulesMatched []string // every matching rule in evaluation order
 	Remediated   bool
 	RemediatedAt *time.Time
 	Labels       map[string]string
+	Fields       map[string]string
+
+	// TemplateID and Template identify the learned message template the
+	// error was grouped by, if any
+	TemplateID string
+	Template   string
+}
+
+// clone copies an error so callers never share the store's instance,
+// which workers keep updating. Maps and slices are replaced rather than
+// modified once stored, so a shallow copy is enough.
+func (e *Error) clone() *Error {
+	c := *e
+	return &c
 }
 
 // RemediationLog represents a remediation action log entry
 type RemediationLog struct {
 	ID        string
 	ErrorID   string
+	Rule      string // rule whose remediation this is
 	Action    string
 	Target    string // namespace/pod or namespace/deployment
 	Status    string // success, failed, skipped
@@ -39,12 +57,16 @@ type RemediationLog struct {
 
 // ErrorFilter defines filtering options for error queries
 type ErrorFilter struct {
+	Source     string
+	Tenant     string
 	Namespace  string
 	Pod        string
 	Priority   rules.Priority
 	Remediated *bool
 	Since      time.Time
 	Search     string
+	TemplateID string
+	Fields     map[string]string // exact structured field values
 }
 
 // PaginationOptions defines pagination for queries
@@ -57,10 +79,14 @@ type PaginationOptions struct {
 type Store interface {
 	// Error operations
 	SaveError(err *Error) error
+	// RecordOccurrence counts further occurrences of a stored error
+	RecordOccurrence(fingerprint string, seenAt time.Time, count int) (*Error, error)
 	GetError(id string) (*Error, error)
 	GetErrorByFingerprint(fingerprint string) (*Error, error)
 	ListErrors(filter ErrorFilter, opts PaginationOptions) ([]*Error, int, error)
 	UpdateError(err *Error) error
+	// MarkRemediated flags an error as remediated at the given time
+	MarkRemediated(id string, at time.Time) error
 	DeleteError(id string) error
 	DeleteOldErrors(before time.Time) (int, error)
 
@@ -81,6 +107,7 @@ type Store interface {
 // Stats contains aggregate statistics
 type Stats struct {
 	TotalErrors       int
+	TotalOccurrences  int
 	ErrorsByPriority  map[rules.Priority]int
 	ErrorsByNamespace map[string]int
 	RemediationCount  int
@@ -2,11 +2,17 @@ package web
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	"github.com/kube-sentinel/kube-sentinel/internal/pipeline"
 	"github.com/kube-sentinel/kube-sentinel/internal/rules"
 	"github.com/kube-sentinel/kube-sentinel/internal/store"
 )
@@ -22,12 +28,15 @@ type dashboardData struct {
 }
 
 type errorsData struct {
-	Errors     []*store.Error
-	Total      int
-	Page       int
-	PageSize   int
-	Filter     store.ErrorFilter
-	Namespaces []string
+	Errors      []*store.Error
+	Total       int
+	Page        int
+	PageSize    int
+	Filter      store.ErrorFilter
+	FieldFilter string
+	Namespaces  []string
+	Sources     []string
+	Tenants     []string
 }
 
 type errorDetailData struct {
@@ -37,6 +46,7 @@ type errorDetailData struct {
 
 type rulesData struct {
 	Rules []rules.Rule
+	Stats map[string]rules.RuleStats
 }
 
 type historyData struct {
@@ -51,6 +61,8 @@ type settingsData struct {
 	DryRun          bool
 	MaxActionsPerHour int
 	ActionsThisHour int
+	Pipeline        []pipeline.StageStats
+	LokiCircuit     *loki.CircuitStats
 }
 
 // Page handlers
@@ -80,9 +92,13 @@ func (s *Server) handleErrors(w http.ResponseWriter, r *http.Request) {
 	pageSize := 20
 
 	filter := store.ErrorFilter{
-		Namespace: r.URL.Query().Get("namespace"),
-		Pod:       r.URL.Query().Get("pod"),
-		Search:    r.URL.Query().Get("search"),
+		Source:     r.URL.Query().Get("source"),
+		Tenant:     r.URL.Query().Get("tenant"),
+		Namespace:  r.URL.Query().Get("namespace"),
+		Pod:        r.URL.Query().Get("pod"),
+		Search:     r.URL.Query().Get("search"),
+		TemplateID: r.URL.Query().Get("template"),
+		Fields:     parseFieldFilters(r.URL.Query()["field"]),
 	}
 
 	if p := r.URL.Query().Get("priority"); p != "" {
@@ -96,24 +112,45 @@ func (s *Server) handleErrors(w http.ResponseWriter, r *http.Request) {
 		Limit:  pageSize,
 	})
 
-	// Get unique namespaces for filter dropdown
+	// Get unique namespaces and sources for filter dropdowns
 	allErrors, _, _ := s.store.ListErrors(store.ErrorFilter{}, store.PaginationOptions{Limit: 10000})
 	nsMap := make(map[string]bool)
+	srcMap := make(map[string]bool)
+	tenantMap := make(map[string]bool)
 	for _, e := range allErrors {
 		nsMap[e.Namespace] = true
+		if e.Source != "" {
+			srcMap[e.Source] = true
+		}
+		if e.Tenant != "" {
+			tenantMap[e.Tenant] = true
+		}
 	}
 	var namespaces []string
 	for ns := range nsMap {
 		namespaces = append(namespaces, ns)
 	}
+	var sources []string
+	for src := range srcMap {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	var tenants []string
+	for tenant := range tenantMap {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
 
 	data := errorsData{
-		Errors:     errors,
-		Total:      total,
-		Page:       page,
-		PageSize:   pageSize,
-		Filter:     filter,
-		Namespaces: namespaces,
+		Errors:      errors,
+		Total:       total,
+		Page:        page,
+		PageSize:    pageSize,
+		Filter:      filter,
+		FieldFilter: r.URL.Query().Get("field"),
+		Namespaces:  namespaces,
+		Sources:     sources,
+		Tenants:     tenants,
 	}
 
 	s.renderTemplate(w, "errors.html", data)
@@ -142,6 +179,10 @@ func (s *Server) handleErrorDetail(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
 	data := rulesData{
 		Rules: s.ruleEngine.GetRules(),
+		Stats: make(map[string]rules.RuleStats),
+	}
+	for _, stats := range s.ruleEngine.Stats() {
+		data.Stats[stats.Name] = stats
 	}
 
 	s.renderTemplate(w, "rules.html", data)
@@ -175,6 +216,13 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 		DryRun:          s.remEngine.IsDryRun(),
 		ActionsThisHour: s.remEngine.GetActionsThisHour(),
 	}
+	if s.pipeline != nil {
+		data.Pipeline = s.pipeline.Stats()
+	}
+	if s.lokiBreaker != nil {
+		stats := s.lokiBreaker.Stats()
+		data.LokiCircuit = &stats
+	}
 
 	s.renderTemplate(w, "settings.html", data)
 }
@@ -192,9 +240,13 @@ func (s *Server) handleAPIErrors(w http.ResponseWriter, r *http.Request) {
 	}
 
 	filter := store.ErrorFilter{
-		Namespace: r.URL.Query().Get("namespace"),
-		Pod:       r.URL.Query().Get("pod"),
-		Search:    r.URL.Query().Get("search"),
+		Source:     r.URL.Query().Get("source"),
+		Tenant:     r.URL.Query().Get("tenant"),
+		Namespace:  r.URL.Query().Get("namespace"),
+		Pod:        r.URL.Query().Get("pod"),
+		Search:     r.URL.Query().Get("search"),
+		TemplateID: r.URL.Query().Get("template"),
+		Fields:     parseFieldFilters(r.URL.Query()["field"]),
 	}
 
 	if p := r.URL.Query().Get("priority"); p != "" {
@@ -241,6 +293,7 @@ func (s *Server) handleAPIErrorDetail(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAPIRules(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, map[string]interface{}{
 		"rules": s.ruleEngine.GetRules(),
+		"stats": s.ruleEngine.Stats(),
 	})
 }
 
@@ -306,6 +359,52 @@ func (s *Server) handleAPIStats(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, stats)
 }
 
+func (s *Server) handleAPIPipeline(w http.ResponseWriter, r *http.Request) {
+	stages := []pipeline.StageStats{}
+	if s.pipeline != nil {
+		stages = s.pipeline.Stats()
+	}
+
+	s.jsonResponse(w, map[string]interface{}{
+		"stages": stages,
+	})
+}
+
+func (s *Server) handleAPITemplates(w http.ResponseWriter, r *http.Request) {
+	templates := []loki.Template{}
+	if s.miner != nil {
+		templates = s.miner.Templates()
+	}
+
+	s.jsonResponse(w, map[string]interface{}{
+		"enabled":   s.miner != nil,
+		"templates": templates,
+		"total":     len(templates),
+	})
+}
+
+func (s *Server) handleAPITemplateDetail(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if s.miner == nil {
+		s.jsonError(w, "template mining is disabled", http.StatusNotFound)
+		return
+	}
+
+	t, ok := s.miner.Template(id)
+	if !ok {
+		s.jsonError(w, "template not found", http.StatusNotFound)
+		return
+	}
+
+	errors, _, _ := s.store.ListErrors(store.ErrorFilter{TemplateID: id}, store.PaginationOptions{Limit: 100})
+
+	s.jsonResponse(w, map[string]interface{}{
+		"template": t,
+		"errors":   errors,
+	})
+}
+
 func (s *Server) handleAPISettings(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
 		var req struct {
@@ -322,11 +421,16 @@ func (s *Server) handleAPISettings(w http.ResponseWriter, r *http.Request) {
 		s.remEngine.SetDryRun(req.DryRun)
 	}
 
-	s.jsonResponse(w, map[string]interface{}{
+	resp := map[string]interface{}{
 		"enabled":           s.remEngine.IsEnabled(),
 		"dry_run":           s.remEngine.IsDryRun(),
 		"actions_this_hour": s.remEngine.GetActionsThisHour(),
-	})
+	}
+	if s.lokiBreaker != nil {
+		resp["loki_circuit"] = s.lokiBreaker.Stats()
+	}
+
+	s.jsonResponse(w, resp)
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -364,13 +468,56 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// handleReady reports ready while the process can serve. An open Loki
+// circuit breaker is reported in the body but doesn't fail the probe: the
+// push receivers and other sources keep working, and restarting or
+// unrouting the pod would not bring Loki back.
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
+	if s.lokiBreaker != nil {
+		if stats := s.lokiBreaker.Stats(); stats.State == loki.CircuitOpen {
+			fmt.Fprintf(w, "Ready (Loki circuit breaker open until %s: %s)", stats.RetryAt.Format(time.RFC3339), stats.LastError)
+			return
+		}
+	}
 	w.Write([]byte("Ready"))
 }
 
+// handleLokiHealth reports the Loki circuit breaker, with 503 while it is
+// open, for monitors that want to alert on Loki connectivity
+func (s *Server) handleLokiHealth(w http.ResponseWriter, r *http.Request) {
+	if s.lokiBreaker == nil {
+		s.jsonResponse(w, map[string]string{"state": "disabled"})
+		return
+	}
+
+	stats := s.lokiBreaker.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	if stats.State == loki.CircuitOpen {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(stats)
+}
+
 // Helper functions
 
+// parseFieldFilters parses "key=value" field filters, ignoring malformed ones
+func parseFieldFilters(values []string) map[string]string {
+	var fields map[string]string
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[key] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
 func (s *Server) renderTemplate(w http.ResponseWriter, name string, data interface{}) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	tmpl, ok := s.templates[name]
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	"github.com/kube-sentinel/kube-sentinel/internal/rules"
+	"github.com/kube-sentinel/kube-sentinel/internal/store"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ruleEngine, err := rules.NewEngine(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(":0", "", store.NewMemoryStore(), ruleEngine, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// openBreaker trips a breaker against a Loki stub that always fails
+func openBreaker(t *testing.T) *loki.CircuitBreaker {
+	t.Helper()
+
+	lokiStub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+	}))
+	defer lokiStub.Close()
+
+	breaker := loki.NewCircuitBreaker(1, time.Hour)
+	client := loki.NewClient(lokiStub.URL, loki.WithRetry(0, time.Millisecond, time.Millisecond), loki.WithCircuitBreaker(breaker))
+	if err := client.Ready(context.Background()); err == nil {
+		t.Fatal("Ready succeeded against a failing Loki")
+	}
+	if state := breaker.Stats().State; state != loki.CircuitOpen {
+		t.Fatalf("breaker state = %s, want open", state)
+	}
+	return breaker
+}
+
+func TestHealthEndpointsWithLokiBreaker(t *testing.T) {
+	tests := []struct {
+		name       string
+		breaker    func(t *testing.T) *loki.CircuitBreaker
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "ready without breaker",
+			breaker:    func(*testing.T) *loki.CircuitBreaker { return nil },
+			path:       "/ready",
+			wantStatus: http.StatusOK,
+			wantBody:   "Ready",
+		},
+		{
+			name:       "ready with closed breaker",
+			breaker:    func(*testing.T) *loki.CircuitBreaker { return loki.NewCircuitBreaker(5, time.Minute) },
+			path:       "/ready",
+			wantStatus: http.StatusOK,
+			wantBody:   "Ready",
+		},
+		{
+			name:       "ready with open breaker",
+			breaker:    openBreaker,
+			path:       "/ready",
+			wantStatus: http.StatusOK,
+			wantBody:   "Loki circuit breaker open",
+		},
+		{
+			name:       "loki health without breaker",
+			breaker:    func(*testing.T) *loki.CircuitBreaker { return nil },
+			path:       "/health/loki",
+			wantStatus: http.StatusOK,
+			wantBody:   `"state":"disabled"`,
+		},
+		{
+			name:       "loki health with closed breaker",
+			breaker:    func(*testing.T) *loki.CircuitBreaker { return loki.NewCircuitBreaker(5, time.Minute) },
+			path:       "/health/loki",
+			wantStatus: http.StatusOK,
+			wantBody:   `"state":"closed"`,
+		},
+		{
+			name:       "loki health with open breaker",
+			breaker:    openBreaker,
+			path:       "/health/loki",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `"state":"open"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			if b := tt.breaker(t); b != nil {
+				s.SetLokiBreaker(b)
+			}
+
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLokiHealthReportsLastError(t *testing.T) {
+	s := newTestServer(t)
+	s.SetLokiBreaker(openBreaker(t))
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/loki", nil))
+
+	var stats loki.CircuitStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stats.LastError, "ingester unavailable") {
+		t.Errorf("last error = %q, want the Loki response", stats.LastError)
+	}
+	if stats.RetryAt.Before(time.Now()) {
+		t.Errorf("retry at %v, want the end of the open timeout", stats.RetryAt)
+	}
+}
@@ -13,9 +13,12 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/kube-sentinel/kube-sentinel/internal/loki"
+	"github.com/kube-sentinel/kube-sentinel/internal/pipeline"
 	"github.com/kube-sentinel/kube-sentinel/internal/remediation"
 	"github.com/kube-sentinel/kube-sentinel/internal/rules"
 	"github.com/kube-sentinel/kube-sentinel/internal/store"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed templates/*.html
@@ -31,6 +34,9 @@ type Server struct {
 	store       store.Store
 	ruleEngine  *rules.Engine
 	remEngine   *remediation.Engine
+	pipeline    *pipeline.Pipeline
+	miner       *loki.TemplateMiner
+	lokiBreaker *loki.CircuitBreaker
 	logger      *slog.Logger
 	templates   map[string]*template.Template
 	router      *mux.Router
@@ -107,6 +113,9 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/api/remediations", s.handleAPIRemediations).Methods("GET")
 	s.router.HandleFunc("/api/stats", s.handleAPIStats).Methods("GET")
 	s.router.HandleFunc("/api/settings", s.handleAPISettings).Methods("GET", "POST")
+	s.router.HandleFunc("/api/pipeline", s.handleAPIPipeline).Methods("GET")
+	s.router.HandleFunc("/api/templates", s.handleAPITemplates).Methods("GET")
+	s.router.HandleFunc("/api/templates/{id}", s.handleAPITemplateDetail).Methods("GET")
 
 	// WebSocket for real-time updates
 	s.router.HandleFunc("/ws", s.handleWebSocket)
@@ -114,6 +123,34 @@ func (s *Server) setupRoutes() {
 	// Health endpoints
 	s.router.HandleFunc("/health", s.handleHealth).Methods("GET")
 	s.router.HandleFunc("/ready", s.handleReady).Methods("GET")
+	s.router.HandleFunc("/health/loki", s.handleLokiHealth).Methods("GET")
+
+	// Prometheus metrics
+	s.router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+}
+
+// HandleReceiver registers an ingestion endpoint such as the Loki push API.
+// It must be called before Start.
+func (s *Server) HandleReceiver(path string, handler http.Handler) {
+	s.router.Handle(path, handler).Methods("POST")
+}
+
+// SetPipeline sets the pipeline whose queue depths are reported on the
+// settings page and /api/pipeline
+func (s *Server) SetPipeline(p *pipeline.Pipeline) {
+	s.pipeline = p
+}
+
+// SetTemplates sets the template miner whose learned templates are served
+// on /api/templates
+func (s *Server) SetTemplates(m *loki.TemplateMiner) {
+	s.miner = m
+}
+
+// SetLokiBreaker sets the Loki circuit breaker whose state is reported on
+// /ready, /health/loki and the settings page
+func (s *Server) SetLokiBreaker(b *loki.CircuitBreaker) {
+	s.lokiBreaker = b
 }
 
 // Start begins serving HTTP requests